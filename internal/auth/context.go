@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type userIDKey struct{}
+
+/**
+* Stores the authenticated user's id in a request context, so that code which
+* only receives a context.Context (e.g. llm usage accounting) can see the caller.
+**/
+func ContextWithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+/**
+* Returns the user id stored by the auth middleware, false for anonymous requests.
+**/
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(uuid.UUID)
+	return userID, ok
+}
@@ -57,10 +57,29 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// store userId in the context for usage in the actual API handlers
+		// store userId in the context for usage in the actual API handlers,
+		// and in the request context for code that only receives a context.Context
 		c.Set("userId", userId)
+		c.Request = c.Request.WithContext(ContextWithUserID(c.Request.Context(), userId))
 
 		// passdown the flow to next hanlder
 		c.Next()
 	}
 }
+
+/**
+* Like AuthMiddleware, but lets requests without an Authorization header through
+* anonymously. When a token is sent it must be valid, and "userId" is set as usual.
+**/
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+
+		authenticate(c)
+	}
+}
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ai-workshop/internal/documents"
+)
+
+// Source 是 RAG 回應所依據的一個檢索片段，Index 對應提示詞與回答中的 [n] 編號
+type Source struct {
+	Index       int     `json:"index"`
+	ID          string  `json:"id"`
+	Score       float64 `json:"score"`
+	RerankScore float64 `json:"rerank_score,omitempty"`
+	SourceFile  string  `json:"source_file,omitempty"`
+	Offset      int     `json:"offset"`
+	Text        string  `json:"text"`
+}
+
+// Citation 是回答中實際引用到的來源，Positions 為各個 [n] 標記在回答中的字元位置
+type Citation struct {
+	Index      int    `json:"index"`
+	SourceID   string `json:"source_id"`
+	SourceFile string `json:"source_file,omitempty"`
+	Positions  []int  `json:"positions"`
+}
+
+// citationPattern 匹配 [1]、[1, 2]、[1，2]、[1、2] 等引用標記
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*[,，、]\s*\d+)*)\]`)
+
+// citationSeparator 分隔同一標記中的多個編號
+var citationSeparator = regexp.MustCompile(`\s*[,，、]\s*`)
+
+// buildSources 將檢索到的文檔依提示詞中的順序編號為來源
+func buildSources(docs []documents.Document) []Source {
+	sources := make([]Source, len(docs))
+	for i, doc := range docs {
+		sources[i] = Source{
+			Index:       i + 1,
+			ID:          doc.ID,
+			Score:       doc.Score,
+			RerankScore: doc.RerankScore,
+			SourceFile:  doc.SourceFile,
+			Offset:      doc.Offset,
+			Text:        doc.Text,
+		}
+	}
+	return sources
+}
+
+// parseCitations 解析回答中的 [n] 標記，依首次出現的順序回傳被引用的來源
+// 超出來源範圍的編號會被忽略
+func parseCitations(response string, sources []Source) []Citation {
+	citations := make([]Citation, 0)
+	byIndex := make(map[int]int)
+
+	for _, match := range citationPattern.FindAllStringSubmatchIndex(response, -1) {
+		position := utf8.RuneCountInString(response[:match[0]])
+		numbers := citationSeparator.Split(strings.TrimSpace(response[match[2]:match[3]]), -1)
+
+		for _, number := range numbers {
+			index, err := strconv.Atoi(number)
+			if err != nil || index < 1 || index > len(sources) {
+				continue
+			}
+
+			if i, ok := byIndex[index]; ok {
+				citations[i].Positions = append(citations[i].Positions, position)
+				continue
+			}
+
+			source := sources[index-1]
+			byIndex[index] = len(citations)
+			citations = append(citations, Citation{
+				Index:      index,
+				SourceID:   source.ID,
+				SourceFile: source.SourceFile,
+				Positions:  []int{position},
+			})
+		}
+	}
+
+	return citations
+}
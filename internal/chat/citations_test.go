@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ai-workshop/internal/config"
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+)
+
+// 超過 2^53 的 INT64 主鍵，以 float64 解析時會被四捨五入
+const largeMilvusID = "449884541286735873"
+
+// currentSchema 是新版集合的 describe 回應
+const currentSchema = `{"code": 0, "data": {"fields": [
+	{"name": "id"}, {"name": "vector"}, {"name": "text"}, {"name": "source_file"}, {"name": "chunk_index"},
+	{"name": "offset"}, {"name": "owner_id"}, {"name": "created_at"}, {"name": "metadata"}],
+	"indexes": [{"fieldName": "vector", "metricType": "COSINE"}]}}`
+
+// newSearchService 建立連到模擬 Milvus 的文檔服務，/v1/vector/search 固定返回 hits（JSON 陣列內容）
+func newSearchService(t *testing.T, hits string) *documents.Service {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/vector/collections":
+			w.Write([]byte(`{"code": 200, "data": ["documents_fake"]}`))
+		case "/v2/vectordb/collections/describe":
+			w.Write([]byte(currentSchema))
+		case "/v1/vector/search":
+			w.Write([]byte(`{"code": 200, "data": [` + hits + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := llm.NewFactory(&config.Config{FakeLLMEnabled: true, FakeLLMEmbeddingDimension: 8})
+	return documents.NewService(milvus.NewClient(&milvus.ClientConfig{Host: host, Port: port}), factory)
+}
+
+// TestSourceIDRoundTrip 確認向量搜尋回傳的來源 ID 與 Milvus 的主鍵完全一致，可直接用於查詢或刪除片段，分數為搜尋的相似度
+func TestSourceIDRoundTrip(t *testing.T) {
+	docService := newSearchService(t, `{"id": `+largeMilvusID+`, "text": "三月用電量", "distance": 0.9}`)
+
+	docs, err := docService.Search(context.Background(), "三月用電量", documents.SearchOptions{
+		TopK:          1,
+		EmbeddingType: llm.EmbeddingTypeFake,
+	})
+	if err != nil {
+		t.Fatalf("搜尋失敗: %v", err)
+	}
+
+	sources := buildSources(docs)
+	if len(sources) != 1 {
+		t.Fatalf("預期 1 個來源，實際 %d 個", len(sources))
+	}
+	if sources[0].ID != largeMilvusID {
+		t.Errorf("來源 ID 為 %s，預期 %s", sources[0].ID, largeMilvusID)
+	}
+	if sources[0].Score != 0.9 {
+		t.Errorf("來源分數為 %v，預期搜尋回應中的 0.9", sources[0].Score)
+	}
+}
+
+// TestMinScoreVectorHits 確認 min_score 以 Milvus 搜尋回應中的 distance（COSINE 相似度）過濾向量檢索結果
+func TestMinScoreVectorHits(t *testing.T) {
+	docService := newSearchService(t, `
+		{"id": 1, "text": "三月用電量", "distance": 0.9},
+		{"id": 2, "text": "四月用電量", "distance": 0.6},
+		{"id": 3, "text": "員工旅遊", "distance": 0.2}`)
+
+	docs, err := docService.Search(context.Background(), "三月用電量", documents.SearchOptions{
+		TopK:          3,
+		EmbeddingType: llm.EmbeddingTypeFake,
+	})
+	if err != nil {
+		t.Fatalf("搜尋失敗: %v", err)
+	}
+
+	var report ContextReport
+	kept := dropLowScores(docs, documents.SearchModeVector, 0.5, &report)
+	if len(kept) != 2 || kept[0].ID != "1" || kept[1].ID != "2" {
+		t.Fatalf("保留的文檔為 %+v，預期 ID 1 與 2", kept)
+	}
+	if len(report.Cut) != 1 || report.Cut[0].Score != 0.2 || report.Cut[0].Status != ContextLowScore {
+		t.Errorf("被捨棄的文檔為 %+v，預期 ID 3（分數 0.2）", report.Cut)
+	}
+}
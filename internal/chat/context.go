@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// ContextStrategy 是文檔超出 token 預算時的處理方式
+type ContextStrategy string
+
+const (
+	ContextTrim      ContextStrategy = "trim"      // 截斷放不下的文檔，剩餘預算太少時捨棄
+	ContextSummarize ContextStrategy = "summarize" // 由回答問題的模型將放不下的文檔摘要到剩餘預算內
+)
+
+// 文檔在上下文中的處理結果
+const (
+	ContextIncluded   = "included"    // 完整放入
+	ContextTrimmed    = "trimmed"     // 截斷後放入
+	ContextSummarized = "summarized"  // 摘要後放入
+	ContextLowScore   = "low_score"   // 相似度低於 min_score 而捨棄
+	ContextOverBudget = "over_budget" // 超出 token 預算而捨棄
+)
+
+const (
+	// answerReserveTokens 是計算預算時保留給回答的 token 數
+	answerReserveTokens = 2048
+	// docOverheadTokens 是每個文檔的編號與來源標示約佔的 token 數
+	docOverheadTokens = 16
+	// minPartialTokens 是截斷或摘要一個文檔至少需要的預算，更少時直接捨棄
+	minPartialTokens = 64
+)
+
+// ContextItem 是一個檢索文檔在上下文中的處理結果
+type ContextItem struct {
+	ID         string  `json:"id"`
+	SourceFile string  `json:"source_file,omitempty"`
+	Score      float64 `json:"score"`
+	Tokens     int     `json:"tokens"`                // 原始文本的 token 數（估算）
+	UsedTokens int     `json:"used_tokens,omitempty"` // 實際放入提示詞的 token 數
+	Status     string  `json:"status"`
+}
+
+// ContextReport 說明檢索使用了哪些查詢、哪些檢索文檔放進了提示詞，哪些被捨棄以及原因
+type ContextReport struct {
+	Queries    []RetrievalQuery `json:"queries,omitempty"` // 啟用查詢改寫時實際用於檢索的查詢
+	Budget     int              `json:"budget"`            // 文檔可用的 token 數，-1 表示不限制
+	UsedTokens int              `json:"used_tokens"`       // 文檔實際使用的 token 數
+	Included   []ContextItem    `json:"included"`
+	Cut        []ContextItem    `json:"cut"`
+}
+
+// unlimitedBudget 表示模型沒有已知的上下文長度且請求未指定 max_context_tokens
+const unlimitedBudget = -1
+
+// contextBudget 計算文檔可用的 token 數：模型上下文扣掉歷史、提示詞本身（promptTokens）與保留給回答的部分，
+// maxContextTokens 大於 0 時再以其為上限；兩者都沒有時返回 unlimitedBudget
+func contextBudget(contextWindow int, maxContextTokens int, history []llm.Message, promptTokens int) int {
+	if contextWindow <= 0 && maxContextTokens <= 0 {
+		return unlimitedBudget
+	}
+
+	budget := maxContextTokens
+	if contextWindow > 0 {
+		overhead := promptTokens + answerReserveTokens
+		for _, msg := range history {
+			overhead += llm.EstimateTokens(msg.Content)
+		}
+		available := max(contextWindow-overhead, 0)
+		if budget <= 0 || available < budget {
+			budget = available
+		}
+	}
+	return budget
+}
+
+// dropLowScores 捨棄向量相似度低於 minScore 的文檔
+// 只有帶向量相似度的文檔會被檢查：keyword 模式的分數與 hybrid 模式中只由關鍵字命中的文檔不受影響
+func dropLowScores(docs []documents.Document, mode documents.SearchMode, minScore float64, report *ContextReport) []documents.Document {
+	if minScore == 0 {
+		return docs
+	}
+
+	kept := make([]documents.Document, 0, len(docs))
+	for _, doc := range docs {
+		if similarity, ok := vectorSimilarity(doc, mode); ok && similarity < minScore {
+			item := newContextItem(doc)
+			item.Score = similarity
+			item.Status = ContextLowScore
+			report.Cut = append(report.Cut, item)
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return kept
+}
+
+// vectorSimilarity 返回文檔的向量相似度，沒有時返回 false
+func vectorSimilarity(doc documents.Document, mode documents.SearchMode) (float64, bool) {
+	switch mode {
+	case "", documents.SearchModeVector:
+		return doc.Score, true
+	case documents.SearchModeHybrid:
+		return doc.VectorScore, doc.VectorScore != 0
+	}
+	return 0, false
+}
+
+// fitContext 依排名將文檔放入 token 預算：放得下的完整放入，第一個放不下的依策略截斷或摘要，之後仍嘗試放入較短的文檔
+// summarizer 只在 ContextSummarize 時使用，摘要失敗時改為截斷
+func fitContext(ctx context.Context, query string, docs []documents.Document, budget int, strategy ContextStrategy, summarizer llm.LLMProvider, report *ContextReport) []documents.Document {
+	report.Budget = budget
+	remaining := budget
+	if budget == unlimitedBudget {
+		remaining = math.MaxInt
+	}
+
+	fitted := make([]documents.Document, 0, len(docs))
+	for _, doc := range docs {
+		item := newContextItem(doc)
+		cost := item.Tokens + docOverheadTokens
+
+		if cost <= remaining {
+			item.UsedTokens = item.Tokens
+			item.Status = ContextIncluded
+			remaining -= cost
+			fitted = append(fitted, doc)
+			report.Included = append(report.Included, item)
+			continue
+		}
+
+		available := remaining - docOverheadTokens
+		if available < minPartialTokens {
+			item.Status = ContextOverBudget
+			report.Cut = append(report.Cut, item)
+			continue
+		}
+
+		text, status := "", ContextTrimmed
+		if strategy == ContextSummarize && summarizer != nil {
+			summary, err := summarizeDocument(ctx, summarizer, query, doc.Text, available)
+			if err != nil {
+				log.Printf("摘要文檔 %s 失敗，改為截斷: %v", doc.ID, err)
+			} else {
+				text, status = summary, ContextSummarized
+			}
+		}
+		if text == "" {
+			text = trimToTokens(doc.Text, available)
+		} else if llm.EstimateTokens(text) > available {
+			text = trimToTokens(text, available)
+		}
+
+		doc.Text = text
+		item.UsedTokens = llm.EstimateTokens(text)
+		item.Status = status
+		remaining -= item.UsedTokens + docOverheadTokens
+		fitted = append(fitted, doc)
+		report.Included = append(report.Included, item)
+	}
+
+	if budget == unlimitedBudget {
+		for _, item := range report.Included {
+			report.UsedTokens += item.UsedTokens + docOverheadTokens
+		}
+	} else {
+		report.UsedTokens = budget - remaining
+	}
+	return fitted
+}
+
+func newContextItem(doc documents.Document) ContextItem {
+	return ContextItem{
+		ID:         doc.ID,
+		SourceFile: doc.SourceFile,
+		Score:      doc.Score,
+		Tokens:     llm.EstimateTokens(doc.Text) + llm.EstimateTokens(doc.SourceFile),
+	}
+}
+
+// trimToTokens 截取文本開頭不超過 maxTokens 的部分，以二分搜尋找出最長的字元數
+func trimToTokens(text string, maxTokens int) string {
+	runes := []rune(text)
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if llm.EstimateTokens(string(runes[:mid]))+1 <= maxTokens {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	if low == len(runes) {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:low])) + "…"
+}
+
+// summarizeDocument 請模型摘要文檔中與問題相關的內容，長度以剩餘預算換算為字數
+func summarizeDocument(ctx context.Context, summarizer llm.LLMProvider, query string, text string, maxTokens int) (string, error) {
+	// 估算時中日韓文字每字算兩個 token，以此換算保守的字數上限
+	maxChars := max(maxTokens/2, 1)
+
+	prompt := fmt.Sprintf("請摘要以下文檔中與問題相關的內容，保留數字、名稱與日期等細節，不超過 %d 個字，只輸出摘要。\n\n### 問題：\n%s\n\n### 文檔：\n%s\n\n### 摘要：\n", maxChars, query, text)
+	summary, err := summarizer.GenerateChatContent(ctx, []llm.Message{{Role: llm.RoleUser, Content: prompt}})
+	if err != nil {
+		return "", err
+	}
+
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", fmt.Errorf("摘要為空")
+	}
+	return summary, nil
+}
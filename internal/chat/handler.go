@@ -1,12 +1,20 @@
 package chat
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
-	"ai-workshop/internal/config"
+	"ai-workshop/internal/documents"
 	"ai-workshop/internal/llm"
+	"ai-workshop/internal/prompts"
+	"ai-workshop/internal/rerank"
+	"ai-workshop/internal/utils/errorutils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type RAGRequest struct {
@@ -18,27 +26,27 @@ type RAGResponse struct {
 }
 
 type Handler struct {
-	client  llm.LLMProvider
-	service *Service
+	factory      *llm.Factory
+	service      *Service
+	defaultModel llm.LLMType
 }
 
-func NewHandler(service *Service, llmType llm.LLMType, config *config.Config) *Handler {
-
-	factory := llm.NewFactory(config)
-
-	client, _ := factory.Create(llmType)
-
+// NewHandler 創建聊天處理器，請求未指定 model 時使用 defaultModel
+func NewHandler(service *Service, factory *llm.Factory, defaultModel llm.LLMType) *Handler {
 	return &Handler{
-		client:  client,
-		service: service,
+		factory:      factory,
+		service:      service,
+		defaultModel: defaultModel,
 	}
 }
 
 // HandleChat handles chat requests
 func (h *Handler) ChatHandler(c *gin.Context) {
 	var req struct {
-		Message string      `json:"message" binding:"required"`
-		Model   llm.LLMType `json:"model,omitempty"`
+		Message        string        `json:"message" binding:"required"`
+		Model          llm.LLMType   `json:"model,omitempty"`
+		Prompt         PromptOptions `json:"prompt,omitempty"` // 以模板包裝使用者訊息，例如加上角色設定的 system 訊息
+		ConversationID *uuid.UUID    `json:"conversation_id,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -46,30 +54,101 @@ func (h *Handler) ChatHandler(c *gin.Context) {
 		return
 	}
 
-	// 如果没有指定模型，默認使用 Gemini
-	if req.Model == "" {
-		req.Model = llm.LLMTypeGemini
+	client, ok := h.resolveProvider(c, &req.Model)
+	if !ok {
+		return
 	}
 
-	response, err := h.client.GenerateContent(c.Request.Context(), req.Message)
+	history, ok := h.loadHistory(c, req.ConversationID)
+	if !ok {
+		return
+	}
+
+	messages, prompt, err := h.service.ChatMessages(c.Request.Context(), req.Message, req.Prompt, history)
+	if err != nil {
+		c.JSON(prompts.ErrorStatus(err), gin.H{"error": "套用提示詞模板失敗: " + err.Error()})
+		return
+	}
+
+	response, err := client.GenerateChatContent(c.Request.Context(), messages)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成回應失敗: " + err.Error()})
 		return
 	}
 
+	if err := h.saveExchange(c, req.ConversationID, req.Message, response); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"response": response,
-		"model":    req.Model,
+		"response":        response,
+		"model":           req.Model,
+		"prompt":          prompt,
+		"conversation_id": req.ConversationID,
 	})
 }
 
-func (h *Handler) RagChatHandler(c *gin.Context) {
-	var req struct {
-		Message        string            `json:"message" binding:"required"`
-		Model          llm.LLMType       `json:"model,omitempty"`
-		EmbeddingModel llm.EmbeddingType `json:"embedding_model,omitempty"`
+// ragChatRequest 是 RAG 與 RAG 串流端點共用的請求
+type ragChatRequest struct {
+	Message        string            `json:"message" binding:"required"`
+	Model          llm.LLMType       `json:"model,omitempty"`
+	EmbeddingModel llm.EmbeddingType `json:"embedding_model,omitempty"`
+	Collection     string            `json:"collection,omitempty"` // 以集合名稱指定檢索範圍，對應寫入該集合的嵌入模型
+	Mode           string            `json:"mode,omitempty"`       // vector（預設）、keyword 或 hybrid
+	Rerank         rerank.Options    `json:"rerank,omitempty"`     // 重排方式與候選數量 N、保留數量 K
+
+	QueryRewrite QueryRewriteOptions `json:"query_rewrite,omitempty"` // 檢索前改寫為獨立問題、產生同義改寫或 HyDE
+
+	TopK             int             `json:"top_k,omitempty"`              // 放進提示詞的文檔數量，預設 3
+	MinScore         float64         `json:"min_score,omitempty"`          // 向量相似度下限
+	MaxContextTokens int             `json:"max_context_tokens,omitempty"` // 文檔合計的 token 上限
+	ContextStrategy  ContextStrategy `json:"context_strategy,omitempty"`   // 超出預算時 trim（預設）或 summarize
+
+	Prompt PromptOptions `json:"prompt,omitempty"` // 提示詞模板名稱、版本與變數，未指定時使用內建的 RAG 提示詞
+
+	ConversationID *uuid.UUID `json:"conversation_id,omitempty"`
+}
+
+// retrievalOptions 將請求轉為檢索設定，collection 與 embedding_model 同時指定時必須一致
+// 兩者都未指定時使用 defaultEmbedding（DEFAULT_EMBEDDING_MODEL）
+func (req ragChatRequest) retrievalOptions(defaultEmbedding llm.EmbeddingType) (RetrievalOptions, error) {
+	embeddingModel := req.EmbeddingModel
+	if req.Collection != "" {
+		model, err := llm.EmbeddingModelByCollection(req.Collection)
+		if err != nil {
+			return RetrievalOptions{}, err
+		}
+		if embeddingModel != "" && embeddingModel != model.Type {
+			return RetrievalOptions{}, fmt.Errorf("集合 %s 由 %s 寫入，與 embedding_model %s 不一致", req.Collection, model.Type, embeddingModel)
+		}
+		embeddingModel = model.Type
 	}
+	if embeddingModel == "" {
+		embeddingModel = defaultEmbedding
+	}
+
+	mode, err := documents.ParseSearchMode(req.Mode)
+	if err != nil {
+		return RetrievalOptions{}, err
+	}
+
+	return RetrievalOptions{
+		EmbeddingType:    embeddingModel,
+		Mode:             mode,
+		Rerank:           req.Rerank,
+		Rewrite:          req.QueryRewrite,
+		TopK:             req.TopK,
+		MinScore:         req.MinScore,
+		MaxContextTokens: req.MaxContextTokens,
+		ContextStrategy:  req.ContextStrategy,
+		Prompt:           req.Prompt,
+	}, nil
+}
+
+func (h *Handler) RagChatHandler(c *gin.Context) {
+	var req ragChatRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求格式"})
@@ -78,22 +157,253 @@ func (h *Handler) RagChatHandler(c *gin.Context) {
 
 	// TODO need to use new flow
 
-	// 如果未指定嵌入模型，使用默認的 OpenAI
-	embeddingModel := req.EmbeddingModel
-	if embeddingModel == "" {
-		embeddingModel = llm.EmbeddingTypeOpenAI
+	// 如果没有指定模型，使用默認模型
+	if req.Model == "" {
+		req.Model = h.defaultModel
+	}
+
+	retrieval, err := req.retrievalOptions(h.factory.DefaultEmbedding())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, ok := h.loadHistory(c, req.ConversationID)
+	if !ok {
+		return
 	}
 
 	// 生成 RAG 回應
-	response, err := h.service.GenerateRAGResponseWithEmbedding(c.Request.Context(), req.Message, req.Model, embeddingModel)
+	result, err := h.service.GenerateRAGResponseWithOptions(c.Request.Context(), req.Message, req.Model, retrieval, history)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成 RAG 回應失敗: " + err.Error()})
+		c.JSON(ragErrorStatus(err), gin.H{"error": "生成 RAG 回應失敗: " + err.Error()})
+		return
+	}
+
+	if err := h.saveExchange(c, req.ConversationID, req.Message, result.Response); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"response":        response,
+		"response":        result.Response,
+		"sources":         result.Sources,
+		"citations":       result.Citations,
+		"context":         result.Context,
+		"prompt":          result.Prompt,
 		"model":           req.Model,
-		"embedding_model": embeddingModel,
+		"embedding_model": retrieval.EmbeddingType,
+		"collection":      documents.CollectionNameFor(retrieval.EmbeddingType),
+		"mode":            retrieval.Mode,
+		"conversation_id": req.ConversationID,
+	})
+}
+
+// ChatStreamHandler 以 Server-Sent Events 串流聊天回應
+func (h *Handler) ChatStreamHandler(c *gin.Context) {
+	var req struct {
+		Message        string        `json:"message" binding:"required"`
+		Model          llm.LLMType   `json:"model,omitempty"`
+		Prompt         PromptOptions `json:"prompt,omitempty"` // 以模板包裝使用者訊息，例如加上角色設定的 system 訊息
+		ConversationID *uuid.UUID    `json:"conversation_id,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求格式"})
+		return
+	}
+
+	client, ok := h.resolveProvider(c, &req.Model)
+	if !ok {
+		return
+	}
+
+	history, ok := h.loadHistory(c, req.ConversationID)
+	if !ok {
+		return
+	}
+
+	messages, prompt, err := h.service.ChatMessages(c.Request.Context(), req.Message, req.Prompt, history)
+	if err != nil {
+		c.JSON(prompts.ErrorStatus(err), gin.H{"error": "套用提示詞模板失敗: " + err.Error()})
+		return
+	}
+
+	chunks, err := client.GenerateChatContentStream(c.Request.Context(), messages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成回應失敗: " + err.Error()})
+		return
+	}
+
+	streamSSE(c, chunks, func(response string) (gin.H, error) {
+		if err := h.saveExchange(c, req.ConversationID, req.Message, response); err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"model":           req.Model,
+			"prompt":          prompt,
+			"conversation_id": req.ConversationID,
+		}, nil
+	})
+}
+
+// RagChatStreamHandler 以 Server-Sent Events 串流 RAG 回應，最後送出包含來源、引用與上下文報告的事件
+func (h *Handler) RagChatStreamHandler(c *gin.Context) {
+	var req ragChatRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求格式"})
+		return
+	}
+
+	// 如果没有指定模型，使用默認模型
+	if req.Model == "" {
+		req.Model = h.defaultModel
+	}
+
+	retrieval, err := req.retrievalOptions(h.factory.DefaultEmbedding())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, ok := h.loadHistory(c, req.ConversationID)
+	if !ok {
+		return
+	}
+
+	chunks, result, err := h.service.StreamRAGResponseWithOptions(c.Request.Context(), req.Message, req.Model, retrieval, history)
+	if err != nil {
+		c.JSON(ragErrorStatus(err), gin.H{"error": "生成 RAG 回應失敗: " + err.Error()})
+		return
+	}
+
+	streamSSE(c, chunks, func(response string) (gin.H, error) {
+		if err := h.saveExchange(c, req.ConversationID, req.Message, response); err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"model":           req.Model,
+			"embedding_model": retrieval.EmbeddingType,
+			"collection":      documents.CollectionNameFor(retrieval.EmbeddingType),
+			"mode":            retrieval.Mode,
+			"sources":         result.Sources,
+			"citations":       parseCitations(response, result.Sources),
+			"context":         result.Context,
+			"prompt":          result.Prompt,
+			"conversation_id": req.ConversationID,
+		}, nil
+	})
+}
+
+// Capabilities 列出每個 LLM 提供者與嵌入模型在啟動時判定的可用狀態
+func (h *Handler) Capabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers":        h.factory.Providers(),
+		"embedding_models": h.factory.EmbeddingCapabilities(),
+		"default":          h.defaultModel,
+	})
+}
+
+// ListModels 列出已設定且可用的聊天模型
+func (h *Handler) ListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"models":  h.factory.AvailableModels(),
+		"default": h.defaultModel,
+	})
+}
+
+// ragErrorStatus 返回 RAG 錯誤對應的 HTTP 狀態碼，涵蓋檢索、提示詞模板、重排與 LLM 的錯誤
+func ragErrorStatus(err error) int {
+	if errors.Is(err, ErrInvalidRetrieval) {
+		return http.StatusBadRequest
+	}
+	if status := prompts.ErrorStatus(err); status != http.StatusInternalServerError {
+		return status
+	}
+	if status := rerank.HTTPStatus(err); status != http.StatusInternalServerError {
+		return status
+	}
+	return documents.SearchErrorStatus(err)
+}
+
+// resolveProvider 依請求的模型取得 LLM 提供者，未指定時填入默認模型
+// 失敗時直接寫入錯誤回應並回傳 false，未知的模型回傳 400，未設定的提供者回傳 503
+func (h *Handler) resolveProvider(c *gin.Context, model *llm.LLMType) (llm.LLMProvider, bool) {
+	if *model == "" {
+		*model = h.defaultModel
+	}
+
+	client, err := h.factory.Get(*model)
+	if err != nil {
+		c.JSON(llm.HTTPStatus(err), gin.H{"error": "無法使用模型 " + string(*model) + ": " + err.Error()})
+		return nil, false
+	}
+
+	return client, true
+}
+
+// loadHistory 讀取請求指定的對話歷史，失敗時直接寫入錯誤回應並回傳 false
+// 未指定 conversation_id 時回傳空歷史；指定時必須已登入且為對話擁有者
+func (h *Handler) loadHistory(c *gin.Context, conversationID *uuid.UUID) ([]llm.Message, bool) {
+	if conversationID == nil {
+		return nil, true
+	}
+
+	userId, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "使用對話功能需要登入"})
+		return nil, false
+	}
+
+	history, err := h.service.LoadHistory(c.Request.Context(), userId.(uuid.UUID), *conversationID)
+	if errors.Is(err, errorutils.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到對話"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "讀取對話失敗: " + err.Error()})
+		return nil, false
+	}
+
+	return history, true
+}
+
+// saveExchange 在請求指定對話時寫入本輪問答，未指定對話時不做任何事
+func (h *Handler) saveExchange(c *gin.Context, conversationID *uuid.UUID, message string, response string) error {
+	if conversationID == nil {
+		return nil
+	}
+	return h.service.SaveExchange(c.Request.Context(), *conversationID, message, response)
+}
+
+// streamSSE 將串流片段以 delta 事件推送給客戶端
+// 串流結束時以完整回應呼叫 finish，並將其回傳的內容作為 done 事件送出
+func streamSSE(c *gin.Context, chunks <-chan llm.StreamChunk, finish func(response string) (gin.H, error)) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	var response strings.Builder
+	c.Stream(func(w io.Writer) bool {
+		chunk, ok := <-chunks
+		if !ok {
+			done, err := finish(response.String())
+			if err != nil {
+				c.SSEvent("error", gin.H{"error": err.Error()})
+				return false
+			}
+			c.SSEvent("done", done)
+			return false
+		}
+
+		if chunk.Err != nil {
+			c.SSEvent("error", gin.H{"error": "生成回應失敗: " + chunk.Err.Error()})
+			return false
+		}
+
+		response.WriteString(chunk.Content)
+		c.SSEvent("delta", gin.H{"content": chunk.Content})
+		return true
 	})
 }
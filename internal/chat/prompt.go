@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/prompts"
+)
+
+// PromptOptions 指定回答使用的提示詞模板，零值為內建的 RAG 提示詞（一般聊天則直接送出使用者訊息）
+type PromptOptions struct {
+	Name      string            `json:"name,omitempty"`
+	Version   int               `json:"version,omitempty"`   // 0 為模板目前啟用的版本
+	Variables map[string]string `json:"variables,omitempty"` // 模板中以 {{.Vars.key}} 取用
+}
+
+// PromptRef 記錄回答實際使用的模板與版本，內建提示詞為 default 版本 0
+type PromptRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+// resolvePrompt 取得請求指定的模板，未指定時返回內建的 RAG 提示詞
+func (s *Service) resolvePrompt(ctx context.Context, opts PromptOptions) (*prompts.Template, error) {
+	if opts.Name == "" {
+		return prompts.Default(), nil
+	}
+	if s.prompts == nil {
+		return nil, fmt.Errorf("未設定提示詞模板服務")
+	}
+
+	tmpl, err := s.prompts.Resolve(ctx, opts.Name, opts.Version)
+	if err != nil {
+		return nil, fmt.Errorf("取得提示詞模板 %s 失敗: %w", opts.Name, err)
+	}
+	return tmpl, nil
+}
+
+// ChatMessages 組出一般聊天送給模型的訊息：未指定模板時直接附上使用者訊息，指定時以模板渲染（沒有文檔）
+func (s *Service) ChatMessages(ctx context.Context, message string, opts PromptOptions, history []llm.Message) ([]llm.Message, *PromptRef, error) {
+	if opts.Name == "" {
+		return appendUserMessage(history, message), nil, nil
+	}
+
+	tmpl, err := s.resolvePrompt(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := buildMessages(tmpl, message, nil, opts.Variables, history)
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, &PromptRef{Name: tmpl.Name, Version: tmpl.Version}, nil
+}
+
+// buildMessages 以模板組出送給模型的訊息：模板有 system 時放在最前面，接著是對話歷史與渲染後的使用者訊息
+func buildMessages(tmpl *prompts.Template, query string, docs []documents.Document, vars map[string]string, history []llm.Message) ([]llm.Message, error) {
+	rendered, err := tmpl.Render(prompts.Data{
+		Question:  query,
+		Documents: promptDocuments(docs),
+		Vars:      vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rendered.System == "" {
+		return appendUserMessage(history, rendered.Content), nil
+	}
+	messages := make([]llm.Message, 0, len(history)+2)
+	messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: rendered.System})
+	return append(messages, appendUserMessage(history, rendered.Content)...), nil
+}
+
+// promptTokens 估算模板在沒有文檔時約佔的 token 數，用於計算文檔的預算
+func promptTokens(tmpl *prompts.Template, query string, vars map[string]string) (int, error) {
+	rendered, err := tmpl.Render(prompts.Data{Question: query, Vars: vars})
+	if err != nil {
+		return 0, err
+	}
+	return llm.EstimateTokens(rendered.System) + llm.EstimateTokens(rendered.Content), nil
+}
+
+// promptDocuments 將檢索文檔轉為模板使用的格式，Index 與來源及回答中的 [n] 編號一致
+func promptDocuments(docs []documents.Document) []prompts.Document {
+	promptDocs := make([]prompts.Document, len(docs))
+	for i, doc := range docs {
+		promptDocs[i] = prompts.Document{
+			Index:      i + 1,
+			Text:       doc.Text,
+			SourceFile: doc.SourceFile,
+			Score:      doc.Score,
+		}
+	}
+	return promptDocs
+}
@@ -0,0 +1,264 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// 檢索查詢的來源
+const (
+	QueryOriginal   = "original"   // 使用者的原始訊息
+	QueryStandalone = "standalone" // 依對話歷史改寫的獨立問題
+	QueryParaphrase = "paraphrase" // 獨立問題的同義改寫
+	QueryHyDE       = "hyde"       // 假設性的回答（Hypothetical Document Embeddings）
+)
+
+const (
+	// maxParaphrases 是單一請求可要求的同義改寫數量上限
+	maxParaphrases = 5
+	// rewriteHistoryMessages 是改寫時放進提示詞的最近對話訊息數量
+	rewriteHistoryMessages = 6
+	// rewriteHistoryRunes 是改寫時每則歷史訊息的長度上限（字元）
+	rewriteHistoryRunes = 500
+	// mergeRRFK 是合併多個查詢結果時 RRF 的平滑常數，與混合搜尋相同
+	mergeRRFK = 60
+)
+
+// paraphrasePrefixPattern 匹配模型在改寫前加上的編號或項目符號，例如「1.」、「2、」、「- 」
+var paraphrasePrefixPattern = regexp.MustCompile(`^\s*(?:[-*•]|\d+\s*[.、)）]|\[\d+\])\s*`)
+
+// QueryRewriteOptions 是檢索前以 LLM 改寫查詢的設定，零值為直接以使用者訊息檢索
+type QueryRewriteOptions struct {
+	Standalone  bool        `json:"standalone,omitempty"`  // 依對話歷史將問題改寫為獨立的問題，沒有歷史時略過
+	Paraphrases int         `json:"paraphrases,omitempty"` // 額外產生的同義改寫數量，上限 maxParaphrases
+	HyDE        bool        `json:"hyde,omitempty"`        // 產生假設性的回答並以其檢索
+	Model       llm.LLMType `json:"model,omitempty"`       // 改寫使用的模型，預設為回答問題的模型
+}
+
+// enabled 表示是否需要在檢索前呼叫 LLM
+func (o QueryRewriteOptions) enabled() bool {
+	return o.Standalone || o.Paraphrases > 0 || o.HyDE
+}
+
+// RetrievalQuery 是一個實際用於檢索的查詢
+type RetrievalQuery struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+// expandQuery 依設定產生檢索使用的查詢，第一個為主要查詢（獨立問題，未改寫時為原始訊息），重排與摘要都以它為準
+// 同義改寫與 HyDE 以主要查詢為基礎並行產生；任何一步失敗時記錄錯誤並略過，不讓整個回答失敗
+func expandQuery(ctx context.Context, rewriter llm.LLMProvider, query string, history []llm.Message, opts QueryRewriteOptions) []RetrievalQuery {
+	primary := RetrievalQuery{Text: query, Kind: QueryOriginal}
+	if opts.Standalone && len(history) > 0 {
+		standalone, err := rewriteStandalone(ctx, rewriter, query, history)
+		if err != nil {
+			log.Printf("改寫獨立問題失敗，改用原始訊息: %v", err)
+		} else {
+			primary = RetrievalQuery{Text: standalone, Kind: QueryStandalone}
+		}
+	}
+
+	var (
+		wg          sync.WaitGroup
+		paraphrases []string
+		hypothesis  string
+	)
+	if opts.Paraphrases > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if paraphrases, err = generateParaphrases(ctx, rewriter, primary.Text, opts.Paraphrases); err != nil {
+				log.Printf("產生同義改寫失敗: %v", err)
+			}
+		}()
+	}
+	if opts.HyDE {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if hypothesis, err = generateHypothesis(ctx, rewriter, primary.Text); err != nil {
+				log.Printf("產生假設性回答失敗: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	queries := []RetrievalQuery{primary}
+	seen := map[string]bool{primary.Text: true}
+	add := func(text, kind string) {
+		if text == "" || seen[text] {
+			return
+		}
+		seen[text] = true
+		queries = append(queries, RetrievalQuery{Text: text, Kind: kind})
+	}
+	for _, paraphrase := range paraphrases {
+		add(paraphrase, QueryParaphrase)
+	}
+	add(hypothesis, QueryHyDE)
+	return queries
+}
+
+// rewriteStandalone 請模型依對話歷史將最後的問題改寫為不需要上下文也能理解的問題
+// 提示詞附上今天的日期，讓「上個月」等相對時間能改寫為具體的日期
+func rewriteStandalone(ctx context.Context, rewriter llm.LLMProvider, query string, history []llm.Message) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("請根據對話歷史，將使用者最後的問題改寫為一個不需要對話歷史也能理解的獨立問題：補上代名詞與省略的主詞所指的對象，並將相對時間換成具體的日期。")
+	sb.WriteString("保留問題原本的語言，不要回答問題，只輸出改寫後的問題。\n\n")
+	sb.WriteString(fmt.Sprintf("今天的日期：%s\n\n", time.Now().Format("2006-01-02")))
+
+	sb.WriteString("### 對話歷史：\n")
+	for _, msg := range recentHistory(history) {
+		sb.WriteString(fmt.Sprintf("%s：%s\n", historyLabel(msg.Role), msg.Content))
+	}
+	sb.WriteString("\n### 最後的問題：\n")
+	sb.WriteString(query)
+	sb.WriteString("\n\n### 獨立問題：\n")
+
+	response, err := rewriter.GenerateChatContent(ctx, []llm.Message{{Role: llm.RoleUser, Content: sb.String()}})
+	if err != nil {
+		return "", err
+	}
+
+	standalone := strings.TrimSpace(response)
+	if standalone == "" {
+		return "", fmt.Errorf("改寫結果為空")
+	}
+	return standalone, nil
+}
+
+// generateParaphrases 請模型以不同說法改寫問題，最多返回 n 個
+func generateParaphrases(ctx context.Context, rewriter llm.LLMProvider, query string, n int) ([]string, error) {
+	prompt := fmt.Sprintf("請用 %d 種不同的說法改寫以下問題，用於搜尋文檔：使用同義詞或不同的表達方式，保留原意與原本的語言。每行輸出一個問題，不要編號，不要輸出其他內容。\n\n### 問題：\n%s\n\n### 改寫：\n", n, query)
+	response, err := rewriter.GenerateChatContent(ctx, []llm.Message{{Role: llm.RoleUser, Content: prompt}})
+	if err != nil {
+		return nil, err
+	}
+
+	paraphrases := parseParaphrases(response, n)
+	if len(paraphrases) == 0 {
+		return nil, fmt.Errorf("無法解析同義改寫: %q", response)
+	}
+	return paraphrases, nil
+}
+
+// parseParaphrases 將回應拆成每行一個問題，去除編號與項目符號，最多返回 n 個
+func parseParaphrases(response string, n int) []string {
+	paraphrases := make([]string, 0, n)
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(paraphrasePrefixPattern.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		paraphrases = append(paraphrases, line)
+		if len(paraphrases) == n {
+			break
+		}
+	}
+	return paraphrases
+}
+
+// generateHypothesis 請模型寫一段可能出現在文件中的回答，以回答的文字檢索通常比問題本身更接近相關片段
+func generateHypothesis(ctx context.Context, rewriter llm.LLMProvider, query string) (string, error) {
+	prompt := fmt.Sprintf("請針對以下問題寫一段可能出現在文件中的回答，約 100 到 200 字。即使不確定也直接寫出具體的內容，不要加上說明或註記，保留問題原本的語言。\n\n### 問題：\n%s\n\n### 回答：\n", query)
+	response, err := rewriter.GenerateChatContent(ctx, []llm.Message{{Role: llm.RoleUser, Content: prompt}})
+	if err != nil {
+		return "", err
+	}
+
+	hypothesis := strings.TrimSpace(response)
+	if hypothesis == "" {
+		return "", fmt.Errorf("假設性回答為空")
+	}
+	return hypothesis, nil
+}
+
+// recentHistory 返回最近的 rewriteHistoryMessages 則使用者與助手訊息，過長的訊息會被截斷
+func recentHistory(history []llm.Message) []llm.Message {
+	recent := make([]llm.Message, 0, rewriteHistoryMessages)
+	for i := len(history) - 1; i >= 0 && len(recent) < rewriteHistoryMessages; i-- {
+		msg := history[i]
+		if msg.Role != llm.RoleUser && msg.Role != llm.RoleAssistant {
+			continue
+		}
+		if text := []rune(msg.Content); len(text) > rewriteHistoryRunes {
+			msg.Content = string(text[:rewriteHistoryRunes]) + "…"
+		}
+		recent = append(recent, msg)
+	}
+
+	// 反轉回時間順序
+	for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+		recent[i], recent[j] = recent[j], recent[i]
+	}
+	return recent
+}
+
+func historyLabel(role llm.MessageRole) string {
+	if role == llm.RoleAssistant {
+		return "助手"
+	}
+	return "使用者"
+}
+
+// mergeResults 以 RRF 合併多個查詢的檢索結果並依 ID 去除重複，返回前 limit 筆
+// 同一個文檔在不同查詢中的 Score、VectorScore 與 KeywordScore 各取最高者，min_score 因此以最接近的查詢的向量相似度判斷
+// 只有一個查詢時原樣返回，各查詢的結果已由搜尋限制為 limit 筆
+func mergeResults(results [][]documents.Document, limit int) []documents.Document {
+	if len(results) == 1 {
+		return results[0]
+	}
+
+	type merged struct {
+		doc   documents.Document
+		fused float64
+		order int
+	}
+	byID := make(map[string]*merged)
+	for _, docs := range results {
+		for rank, doc := range docs {
+			entry, ok := byID[doc.ID]
+			if !ok {
+				entry = &merged{doc: doc, order: len(byID)}
+				byID[doc.ID] = entry
+			} else {
+				entry.doc.Score = max(entry.doc.Score, doc.Score)
+				entry.doc.VectorScore = max(entry.doc.VectorScore, doc.VectorScore)
+				entry.doc.KeywordScore = max(entry.doc.KeywordScore, doc.KeywordScore)
+			}
+			entry.fused += 1.0 / float64(mergeRRFK+rank+1)
+		}
+	}
+
+	entries := make([]*merged, 0, len(byID))
+	for _, entry := range byID {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].fused != entries[j].fused {
+			return entries[i].fused > entries[j].fused
+		}
+		return entries[i].order < entries[j].order
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	docs := make([]documents.Document, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry.doc
+	}
+	return docs
+}
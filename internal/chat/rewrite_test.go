@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// failingRewriter 的聊天呼叫一律失敗
+type failingRewriter struct {
+	*llm.FakeProvider
+}
+
+func (failingRewriter) GenerateChatContent(ctx context.Context, messages []llm.Message) (string, error) {
+	return "", errors.New("模型無法使用")
+}
+
+// TestParseParaphrases 確認去除編號與項目符號、略過空行，並限制數量
+func TestParseParaphrases(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		n        int
+		want     []string
+	}{
+		{"沒有編號", "三月用多少電\n三月的耗電量", 5, []string{"三月用多少電", "三月的耗電量"}},
+		{"數字編號", "1. 三月用多少電\n2、三月的耗電量\n3) 三月電費\n4）三月度數", 5, []string{"三月用多少電", "三月的耗電量", "三月電費", "三月度數"}},
+		{"項目符號與方括號", "- 三月用多少電\n* 三月的耗電量\n• 三月電費\n[4] 三月度數", 5, []string{"三月用多少電", "三月的耗電量", "三月電費", "三月度數"}},
+		{"略過空行", "\n  1. 三月用多少電  \n\n2.\n", 5, []string{"三月用多少電"}},
+		{"最多 n 個", "a\nb\nc", 2, []string{"a", "b"}},
+		{"問題中的數字不受影響", "2024 年 3 月用電量", 5, []string{"2024 年 3 月用電量"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseParaphrases(tt.response, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("解析結果為 %q，預期 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeResults 確認多個查詢的結果依 RRF 排序、依 ID 去除重複並保留最高的分數，只有一個查詢時原樣返回
+func TestMergeResults(t *testing.T) {
+	doc := func(id string, score float64) documents.Document {
+		return documents.Document{ID: id, Score: score, VectorScore: score}
+	}
+
+	tests := []struct {
+		name      string
+		results   [][]documents.Document
+		limit     int
+		wantIDs   []string
+		wantScore map[string]float64
+	}{
+		{
+			name:      "單一查詢原樣返回",
+			results:   [][]documents.Document{{doc("b", 0.5), doc("a", 0.9)}},
+			limit:     1,
+			wantIDs:   []string{"b", "a"},
+			wantScore: map[string]float64{"a": 0.9, "b": 0.5},
+		},
+		{
+			name: "出現在多個查詢中的文檔排在前面",
+			results: [][]documents.Document{
+				{doc("a", 0.9), doc("b", 0.8), doc("c", 0.7)},
+				{doc("c", 0.95), doc("d", 0.6)},
+			},
+			wantIDs:   []string{"c", "a", "b", "d"},
+			wantScore: map[string]float64{"a": 0.9, "b": 0.8, "c": 0.95, "d": 0.6},
+		},
+		{
+			name: "同分時依第一次出現的順序",
+			results: [][]documents.Document{
+				{doc("a", 0.9), doc("b", 0.8)},
+				{doc("b", 0.7), doc("a", 0.6)},
+			},
+			wantIDs:   []string{"a", "b"},
+			wantScore: map[string]float64{"a": 0.9, "b": 0.8},
+		},
+		{
+			name: "只保留 limit 筆",
+			results: [][]documents.Document{
+				{doc("a", 0.9), doc("b", 0.8)},
+				{doc("c", 0.7), doc("b", 0.85)},
+			},
+			limit:     2,
+			wantIDs:   []string{"b", "a"},
+			wantScore: map[string]float64{"a": 0.9, "b": 0.85},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeResults(tt.results, tt.limit)
+
+			ids := make([]string, len(merged))
+			for i, doc := range merged {
+				ids[i] = doc.ID
+				if doc.Score != tt.wantScore[doc.ID] || doc.VectorScore != tt.wantScore[doc.ID] {
+					t.Errorf("%s 的分數為 %v / %v，預期 %v", doc.ID, doc.Score, doc.VectorScore, tt.wantScore[doc.ID])
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("合併結果為 %v，預期 %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// TestExpandQuery 確認各種改寫設定產生的查詢，以及改寫失敗時退回原始訊息
+func TestExpandQuery(t *testing.T) {
+	rewriter := llm.NewFakeProvider([]llm.FakeResponse{
+		{Contains: "不需要對話歷史也能理解", Response: "2024 年 3 月的用電量是多少"},
+		{Contains: "種不同的說法", Response: "1. 2024 年 3 月用了多少電\n2. 2024 年 3 月的用電量是多少\n3. 2024 年 3 月耗電量"},
+		{Contains: "可能出現在文件中的回答", Response: "2024 年 3 月的用電量為 12,000 度。"},
+	})
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "2024 年 2 月的用電量是多少"},
+		{Role: llm.RoleAssistant, Content: "2 月為 11,000 度。"},
+	}
+
+	tests := []struct {
+		name     string
+		rewriter llm.LLMProvider
+		history  []llm.Message
+		opts     QueryRewriteOptions
+		want     []RetrievalQuery
+	}{
+		{
+			name:     "不改寫",
+			rewriter: rewriter,
+			history:  history,
+			want:     []RetrievalQuery{{Text: "那三月呢", Kind: QueryOriginal}},
+		},
+		{
+			name:     "沒有歷史時不改寫獨立問題",
+			rewriter: rewriter,
+			opts:     QueryRewriteOptions{Standalone: true},
+			want:     []RetrievalQuery{{Text: "那三月呢", Kind: QueryOriginal}},
+		},
+		{
+			name:     "獨立問題、同義改寫與 HyDE，與主要查詢相同的改寫被去除",
+			rewriter: rewriter,
+			history:  history,
+			opts:     QueryRewriteOptions{Standalone: true, Paraphrases: 3, HyDE: true},
+			want: []RetrievalQuery{
+				{Text: "2024 年 3 月的用電量是多少", Kind: QueryStandalone},
+				{Text: "2024 年 3 月用了多少電", Kind: QueryParaphrase},
+				{Text: "2024 年 3 月耗電量", Kind: QueryParaphrase},
+				{Text: "2024 年 3 月的用電量為 12,000 度。", Kind: QueryHyDE},
+			},
+		},
+		{
+			name:     "改寫失敗時退回原始訊息",
+			rewriter: failingRewriter{llm.NewFakeProvider(nil)},
+			history:  history,
+			opts:     QueryRewriteOptions{Standalone: true, Paraphrases: 2, HyDE: true},
+			want:     []RetrievalQuery{{Text: "那三月呢", Kind: QueryOriginal}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expandQuery(context.Background(), tt.rewriter, "那三月呢", tt.history, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("查詢為 %+v，預期 %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,99 +2,352 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"log"
+	"sync"
 
-	"ai-workshop/internal/config"
+	"ai-workshop/internal/conversation"
 	"ai-workshop/internal/documents"
 	"ai-workshop/internal/llm"
+	"ai-workshop/internal/prompts"
+	"ai-workshop/internal/rerank"
+
+	"github.com/google/uuid"
 )
 
-// Service 是 RAG 服務的實現
-type Service struct {
-	docService       *documents.Service
-	embeddingService *llm.OpenAIProvider
-	llmFactory       *llm.Factory
+// noDocumentsResponse 是找不到相關文檔時的固定回應
+const noDocumentsResponse = "沒有找到相關文檔，請嘗試其他問題。"
+
+const (
+	// ragTopK 是 RAG 預設提供給模型的文檔數量
+	ragTopK = 3
+	// maxRAGTopK 是單一請求可要求的文檔數量上限
+	maxRAGTopK = 50
+)
+
+// ErrInvalidRetrieval 表示請求的檢索設定無效
+var ErrInvalidRetrieval = errors.New("無效的檢索設定")
+
+// RetrievalOptions 是 RAG 檢索文檔的設定，零值為使用預設嵌入模型的向量搜尋、取 3 筆且不重排
+type RetrievalOptions struct {
+	EmbeddingType llm.EmbeddingType
+	Mode          documents.SearchMode
+	Rerank        rerank.Options      // 啟用時先取回 N 筆候選，重排後保留 K 筆
+	Rewrite       QueryRewriteOptions // 檢索前以 LLM 改寫查詢，零值為直接以使用者訊息檢索
+
+	TopK             int             // 放進提示詞的文檔數量，預設 ragTopK；rerank.top_k 有設定時以其為準
+	MinScore         float64         // 向量相似度低於此值的文檔不放進提示詞，0 為不過濾
+	MaxContextTokens int             // 文檔合計的 token 上限，0 為只受模型上下文長度限制
+	ContextStrategy  ContextStrategy // 文檔超出預算時的處理方式，預設 trim
+
+	Prompt PromptOptions // 回答使用的提示詞模板，零值為內建的 RAG 提示詞
 }
 
-// NewService 創建一個新的 RAG 服務
-func NewService(config *config.Config) (*Service, error) {
-	// 創建文檔服務
-	docService := documents.NewService(config)
+// normalize 填入預設值並檢查設定，未指定嵌入模型時使用 defaultEmbedding
+func (o RetrievalOptions) normalize(defaultEmbedding llm.EmbeddingType) (RetrievalOptions, error) {
+	if o.EmbeddingType == "" {
+		o.EmbeddingType = defaultEmbedding
+	}
+	if o.TopK <= 0 {
+		o.TopK = ragTopK
+	}
+	if o.TopK > maxRAGTopK || o.Rerank.TopK > maxRAGTopK {
+		return o, fmt.Errorf("%w: top_k 不可超過 %d", ErrInvalidRetrieval, maxRAGTopK)
+	}
+	if o.MinScore < -1 || o.MinScore > 1 {
+		return o, fmt.Errorf("%w: min_score 需介於 -1 與 1 之間（餘弦相似度）", ErrInvalidRetrieval)
+	}
+	if o.Rewrite.Paraphrases < 0 || o.Rewrite.Paraphrases > maxParaphrases {
+		return o, fmt.Errorf("%w: query_rewrite.paraphrases 需介於 0 與 %d 之間", ErrInvalidRetrieval, maxParaphrases)
+	}
+	if o.MaxContextTokens < 0 {
+		return o, fmt.Errorf("%w: max_context_tokens 不可為負數", ErrInvalidRetrieval)
+	}
+	switch o.ContextStrategy {
+	case "":
+		o.ContextStrategy = ContextTrim
+	case ContextTrim, ContextSummarize:
+	default:
+		return o, fmt.Errorf("%w: 未知的 context_strategy %s，可用 trim 或 summarize", ErrInvalidRetrieval, o.ContextStrategy)
+	}
+	return o, nil
+}
 
-	// 創建嵌入服務
-	embeddingService := llm.NewOpenAiProvider(config.OpenAiAPIKey)
+// RAGResult 是 RAG 回應以及其所依據的來源與引用，Context 說明哪些檢索文檔放進了提示詞，Prompt 為使用的模板
+type RAGResult struct {
+	Response  string         `json:"response"`
+	Sources   []Source       `json:"sources"`
+	Citations []Citation     `json:"citations"`
+	Context   *ContextReport `json:"context"`
+	Prompt    PromptRef      `json:"prompt"`
+}
 
-	// 創建 LLM 工廠
-	llmFactory := llm.NewFactory(config)
+// Service 是 RAG 服務的實現
+type Service struct {
+	docService    *documents.Service
+	llmFactory    *llm.Factory
+	conversations *conversation.Service
+	rerankers     *rerank.Rerankers
+	prompts       *prompts.Service
+}
 
+// NewService 創建一個新的 RAG 服務，docService 由外部注入以共用同一個 Milvus 連線與嵌入提供者
+// promptService 提供請求以名稱指定的提示詞模板
+func NewService(docService *documents.Service, llmFactory *llm.Factory, conversations *conversation.Service, rerankers *rerank.Rerankers, promptService *prompts.Service) (*Service, error) {
 	return &Service{
-		docService:       docService,
-		embeddingService: embeddingService,
-		llmFactory:       llmFactory,
+		docService:    docService,
+		llmFactory:    llmFactory,
+		conversations: conversations,
+		rerankers:     rerankers,
+		prompts:       promptService,
 	}, nil
 }
 
 // GenerateRAGResponse 生成 RAG 回應
-func (s *Service) GenerateRAGResponse(ctx context.Context, query string, modelType llm.LLMType) (string, error) {
-	// 使用默認的嵌入提供者
-	return s.GenerateRAGResponseWithEmbedding(ctx, query, modelType, llm.EmbeddingTypeOpenAI)
+func (s *Service) GenerateRAGResponse(ctx context.Context, query string, modelType llm.LLMType) (*RAGResult, error) {
+	// 使用默認的嵌入提供者與向量搜尋
+	return s.GenerateRAGResponseWithOptions(ctx, query, modelType, RetrievalOptions{}, nil)
 }
 
-// GenerateRAGResponseWithEmbedding 使用指定的嵌入提供者生成 RAG 回應
-func (s *Service) GenerateRAGResponseWithEmbedding(ctx context.Context, query string, modelType llm.LLMType, embeddingType llm.EmbeddingType) (string, error) {
-	// 1. 搜尋相關文檔（默認獲取前3個最相關的文檔）
-	docs, err := s.docService.SearchSimilarDocumentsWithEmbedding(query, 3, embeddingType)
+// GenerateRAGResponseWithOptions 依檢索設定生成 RAG 回應，history 為先前的對話歷史（可為 nil）
+func (s *Service) GenerateRAGResponseWithOptions(ctx context.Context, query string, modelType llm.LLMType, opts RetrievalOptions, history []llm.Message) (*RAGResult, error) {
+	// 1. 獲取指定的 LLM 提供者（先檢查模型，避免未知模型也觸發檢索）
+	llmProvider, err := s.getProvider(modelType)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 取得提示詞模板
+	tmpl, err := s.resolvePrompt(ctx, opts.Prompt)
 	if err != nil {
-		return "", fmt.Errorf("搜尋相關文檔失敗: %v", err)
+		return nil, err
 	}
+	promptRef := PromptRef{Name: tmpl.Name, Version: tmpl.Version}
 
+	// 3. 搜尋相關文檔並放入 token 預算
+	docs, report, err := s.prepareContext(ctx, query, modelType, llmProvider, tmpl, opts, history)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := buildSources(docs)
 	if len(docs) == 0 {
-		return "沒有找到相關文檔，請嘗試其他問題。", nil
+		return &RAGResult{Response: noDocumentsResponse, Sources: sources, Citations: []Citation{}, Context: report, Prompt: promptRef}, nil
 	}
 
-	// 2. 構建提示詞
-	prompt := buildRAGPrompt(query, docs)
+	// 4. 以模板構建提示詞
+	messages, err := buildMessages(tmpl, query, docs, opts.Prompt.Variables, history)
+	if err != nil {
+		return nil, err
+	}
 
-	// 如果没有指定模型，默認使用 OpenAI
-	if modelType == "" {
-		modelType = llm.LLMTypeOpenAI
+	// 5. 使用 LLM 生成回應
+	response, err := llmProvider.GenerateChatContent(ctx, messages)
+	if err != nil {
+		return nil, fmt.Errorf("生成回應失敗: %v", err)
+	}
+
+	// 6. 解析回答中的引用標記
+	return &RAGResult{
+		Response:  response,
+		Sources:   sources,
+		Citations: parseCitations(response, sources),
+		Context:   report,
+		Prompt:    promptRef,
+	}, nil
+}
+
+// StreamRAGResponseWithOptions 以串流方式生成 RAG 回應，同時回傳檢索到的來源與上下文報告
+// 回傳的 RAGResult 沒有 Response 與 Citations，由呼叫端在串流結束後以完整回應解析引用
+func (s *Service) StreamRAGResponseWithOptions(ctx context.Context, query string, modelType llm.LLMType, opts RetrievalOptions, history []llm.Message) (<-chan llm.StreamChunk, *RAGResult, error) {
+	llmProvider, err := s.getProvider(modelType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := s.resolvePrompt(ctx, opts.Prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docs, report, err := s.prepareContext(ctx, query, modelType, llmProvider, tmpl, opts, history)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &RAGResult{Sources: buildSources(docs), Context: report, Prompt: PromptRef{Name: tmpl.Name, Version: tmpl.Version}}
+	if len(docs) == 0 {
+		chunks := make(chan llm.StreamChunk, 1)
+		chunks <- llm.StreamChunk{Content: noDocumentsResponse}
+		close(chunks)
+		return chunks, result, nil
+	}
+
+	messages, err := buildMessages(tmpl, query, docs, opts.Prompt.Variables, history)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunks, err := llmProvider.GenerateChatContentStream(ctx, messages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成回應失敗: %v", err)
+	}
+
+	return chunks, result, nil
+}
+
+// prepareContext 檢索文檔、捨棄相似度過低的文檔，再依模型的上下文長度與 max_context_tokens 放入 token 預算
+// 啟用查詢改寫時先由 LLM 產生檢索用的查詢，提示詞中的問題仍為使用者的原始訊息；預算扣掉的提示詞長度以 tmpl 渲染估算
+func (s *Service) prepareContext(ctx context.Context, query string, modelType llm.LLMType, llmProvider llm.LLMProvider, tmpl *prompts.Template, opts RetrievalOptions, history []llm.Message) ([]documents.Document, *ContextReport, error) {
+	opts, err := opts.normalize(s.llmFactory.DefaultEmbedding())
+	if err != nil {
+		return nil, nil, err
+	}
+	overhead, err := promptTokens(tmpl, query, opts.Prompt.Variables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queries := []RetrievalQuery{{Text: query, Kind: QueryOriginal}}
+	if opts.Rewrite.enabled() {
+		rewriter := llmProvider
+		if opts.Rewrite.Model != "" {
+			if rewriter, err = s.getProvider(opts.Rewrite.Model); err != nil {
+				return nil, nil, err
+			}
+		}
+		queries = expandQuery(ctx, rewriter, query, history, opts.Rewrite)
+	}
+
+	docs, err := s.retrieve(ctx, queries, modelType, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &ContextReport{Included: []ContextItem{}, Cut: []ContextItem{}}
+	if opts.Rewrite.enabled() {
+		report.Queries = queries
+	}
+	docs = dropLowScores(docs, opts.Mode, opts.MinScore, report)
+
+	budget := contextBudget(s.llmFactory.ContextWindow(modelType), opts.MaxContextTokens, history, overhead)
+	docs = fitContext(ctx, queries[0].Text, docs, budget, opts.ContextStrategy, llmProvider, report)
+	return docs, report, nil
+}
+
+// retrieve 以每個查詢搜尋相關文檔並合併去重，opts 需先經過 normalize
+// 啟用重排時先取回 N 筆候選再以主要查詢（queries[0]）重排保留 K 筆；重排器呼叫失敗時記錄錯誤並改用檢索的排名，不讓整個回答失敗
+func (s *Service) retrieve(ctx context.Context, queries []RetrievalQuery, modelType llm.LLMType, opts RetrievalOptions) ([]documents.Document, error) {
+	rerankOpts, err := opts.Rerank.Normalize(opts.TopK)
+	if err != nil {
+		return nil, err
+	}
+	if rerankOpts.Model == "" {
+		rerankOpts.Model = modelType
+	}
+
+	var reranker rerank.Reranker
+	if rerankOpts.Enabled() && s.rerankers != nil {
+		if reranker, err = s.rerankers.For(rerankOpts, opts.EmbeddingType); err != nil {
+			return nil, err
+		}
 	}
 
-	// 3. 獲取指定的 LLM 提供者
-	llmProvider, err := s.llmFactory.Create(modelType)
+	topK := rerankOpts.TopK
+	if reranker != nil {
+		topK = rerankOpts.Candidates
+	}
+	docs, err := s.search(ctx, queries, documents.SearchOptions{
+		TopK:          topK,
+		EmbeddingType: opts.EmbeddingType,
+		Mode:          opts.Mode,
+	})
 	if err != nil {
-		return "", fmt.Errorf("創建 LLM 客戶端失敗: %v", err)
+		return nil, err
+	}
+	if reranker == nil {
+		return docs, nil
 	}
-	defer llmProvider.Close()
 
-	// 4. 使用 LLM 生成回應
-	response, err := llmProvider.GenerateContent(ctx, prompt)
+	reranked, err := reranker.Rerank(ctx, queries[0].Text, docs, rerankOpts.TopK)
 	if err != nil {
-		return "", fmt.Errorf("生成回應失敗: %v", err)
+		log.Printf("重排失敗（%s），改用檢索的排名: %v", rerankOpts.Method, err)
+		if len(docs) > rerankOpts.TopK {
+			docs = docs[:rerankOpts.TopK]
+		}
+		return docs, nil
+	}
+	return reranked, nil
+}
+
+// search 並行以每個查詢搜尋，多個查詢的結果以 mergeResults 合併為 opts.TopK 筆，任一查詢失敗時返回錯誤
+func (s *Service) search(ctx context.Context, queries []RetrievalQuery, opts documents.SearchOptions) ([]documents.Document, error) {
+	results := make([][]documents.Document, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.docService.Search(ctx, query.Text, opts)
+		}()
 	}
+	wg.Wait()
 
-	return response, nil
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("搜尋相關文檔失敗: %w", err)
+		}
+	}
+	return mergeResults(results, opts.TopK), nil
 }
 
-// buildRAGPrompt 構建 RAG 提示詞
-func buildRAGPrompt(query string, docs []documents.Document) string {
-	var sb strings.Builder
+// getProvider 從工廠取得指定的 LLM 提供者，未指定時默認使用 OpenAI
+// 未知的模型會回傳包裝 llm.ErrUnknownModel 的錯誤
+func (s *Service) getProvider(modelType llm.LLMType) (llm.LLMProvider, error) {
+	if modelType == "" {
+		modelType = llm.LLMTypeOpenAI
+	}
+
+	llmProvider, err := s.llmFactory.Get(modelType)
+	if err != nil {
+		return nil, fmt.Errorf("創建 LLM 客戶端失敗: %w", err)
+	}
+
+	return llmProvider, nil
+}
 
-	// 添加系統指令
-	sb.WriteString("你是一個智能助手。請基於以下提供的上下文資料來回答用戶的問題。如果無法從上下文中找到答案，請誠實地說明你不知道，不要編造答案。\n\n")
+// LoadHistory 讀取使用者擁有的對話歷史，並轉換為 LLM 訊息
+func (s *Service) LoadHistory(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) ([]llm.Message, error) {
+	stored, err := s.conversations.History(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
 
-	// 添加上下文（相關文檔）
-	sb.WriteString("### 上下文資料：\n")
-	for i, doc := range docs {
-		sb.WriteString(fmt.Sprintf("文檔 %d：%s\n\n", i+1, doc.Text))
+	history := make([]llm.Message, len(stored))
+	for i, msg := range stored {
+		history[i] = llm.Message{
+			Role:    llm.MessageRole(msg.Role),
+			Content: msg.Content,
+		}
 	}
 
-	// 添加用戶問題
-	sb.WriteString("### 用戶問題：\n")
-	sb.WriteString(query)
-	sb.WriteString("\n\n")
-	sb.WriteString("### 回答：\n")
+	return history, nil
+}
+
+// SaveExchange 將本輪的使用者訊息與助手回應寫入對話
+func (s *Service) SaveExchange(ctx context.Context, conversationID uuid.UUID, userMessage string, response string) error {
+	if err := s.conversations.AppendExchange(ctx, conversationID, userMessage, response); err != nil {
+		return fmt.Errorf("儲存對話失敗: %v", err)
+	}
+	return nil
+}
 
-	return sb.String()
+// appendUserMessage 在對話歷史後附上新的使用者訊息，不修改原本的歷史
+func appendUserMessage(history []llm.Message, content string) []llm.Message {
+	messages := make([]llm.Message, 0, len(history)+1)
+	messages = append(messages, history...)
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: content})
 }
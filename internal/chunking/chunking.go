@@ -0,0 +1,125 @@
+package chunking
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Strategy 表示切塊策略
+type Strategy string
+
+const (
+	// StrategyFixed 依固定字元數切塊，相鄰塊之間保留重疊
+	StrategyFixed Strategy = "fixed"
+	// StrategySentence 以句子為單位組合成塊，並盡量在段落結尾處切開
+	StrategySentence Strategy = "sentence"
+	// StrategyMarkdown 先依 Markdown 標題分節，再於各節內以句子組合成塊
+	StrategyMarkdown Strategy = "markdown"
+)
+
+const (
+	DefaultSize    = 800 // 預設每塊最大字元數
+	DefaultOverlap = 100 // 預設相鄰塊重疊字元數
+)
+
+// Options 是切塊設定，Size 與 Overlap 以字元（rune）計算，中日韓文字與英文字母同樣算一個字元
+type Options struct {
+	Strategy Strategy `json:"strategy"`
+	Size     int      `json:"size"`
+	Overlap  int      `json:"overlap"`
+}
+
+// DefaultOptions 回傳預設的切塊設定
+func DefaultOptions() Options {
+	return Options{
+		Strategy: StrategySentence,
+		Size:     DefaultSize,
+		Overlap:  DefaultOverlap,
+	}
+}
+
+// Validate 檢查設定是否合法
+func (o Options) Validate() error {
+	switch o.Strategy {
+	case StrategyFixed, StrategySentence, StrategyMarkdown:
+	default:
+		return fmt.Errorf("不支援的切塊策略: %q", o.Strategy)
+	}
+	if o.Size <= 0 {
+		return fmt.Errorf("切塊大小必須大於 0")
+	}
+	if o.Overlap < 0 || o.Overlap >= o.Size {
+		return fmt.Errorf("重疊字元數必須介於 0 與切塊大小之間")
+	}
+	return nil
+}
+
+// Chunk 是切出的一個文本片段
+type Chunk struct {
+	Index   int    `json:"index"`             // 片段在整份文本中的序號（從 0 開始）
+	Text    string `json:"text"`              // 片段內容
+	Offset  int    `json:"offset"`            // 片段在原文中的起始字元位置
+	Heading string `json:"heading,omitempty"` // Markdown 標題路徑，例如 "安裝 > 設定"
+}
+
+// Split 依設定將文本切塊
+func Split(text string, opts Options) ([]Chunk, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	runes := []rune(text)
+
+	var chunks []Chunk
+	switch opts.Strategy {
+	case StrategyFixed:
+		chunks = splitFixed(runes, 0, len(runes), opts)
+	case StrategySentence:
+		chunks = splitSentences(runes, 0, len(runes), opts)
+	case StrategyMarkdown:
+		chunks = splitMarkdown(runes, opts)
+	}
+
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks, nil
+}
+
+// newChunk 以原文 [start, end) 範圍建立片段，去除前後空白並修正起始位置
+// 範圍內只有空白時回傳 false
+func newChunk(runes []rune, start, end int) (Chunk, bool) {
+	for start < end && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+	if start >= end {
+		return Chunk{}, false
+	}
+	return Chunk{Text: string(runes[start:end]), Offset: start}, true
+}
+
+// splitFixed 以固定大小的視窗切割原文 [start, end) 範圍，每次前進 Size-Overlap 個字元
+func splitFixed(runes []rune, start, end int, opts Options) []Chunk {
+	var chunks []Chunk
+	step := opts.Size - opts.Overlap
+
+	for pos := start; pos < end; pos += step {
+		windowEnd := min(pos+opts.Size, end)
+		if chunk, ok := newChunk(runes, pos, windowEnd); ok {
+			chunks = append(chunks, chunk)
+		}
+		if windowEnd == end {
+			break
+		}
+	}
+	return chunks
+}
+
+// normalizeHeading 將標題文字中的多餘空白收斂
+func normalizeHeading(heading string) string {
+	return strings.Join(strings.Fields(heading), " ")
+}
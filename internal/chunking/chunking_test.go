@@ -0,0 +1,188 @@
+package chunking
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkChunks 確認每個片段不超過 Size、與原文 Offset 處的內容一致，且序號連續
+func checkChunks(t *testing.T, text string, chunks []Chunk, opts Options) {
+	t.Helper()
+
+	runes := []rune(text)
+	for i, chunk := range chunks {
+		length := len([]rune(chunk.Text))
+		if length > opts.Size {
+			t.Errorf("第 %d 個片段有 %d 個字元，超過 %d: %q", i, length, opts.Size, chunk.Text)
+		}
+		if chunk.Offset < 0 || chunk.Offset+length > len(runes) || string(runes[chunk.Offset:chunk.Offset+length]) != chunk.Text {
+			t.Errorf("第 %d 個片段的 Offset %d 與原文不符: %q", i, chunk.Offset, chunk.Text)
+		}
+		if chunk.Index != i {
+			t.Errorf("第 %d 個片段的序號為 %d", i, chunk.Index)
+		}
+	}
+}
+
+func chunkTexts(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+// TestSplit 確認各策略的切點、重疊與起始位置
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		opts        Options
+		want        []string
+		wantOffsets []int
+	}{
+		{
+			name:        "固定大小與重疊",
+			text:        "一二三四五六七八九十",
+			opts:        Options{Strategy: StrategyFixed, Size: 4, Overlap: 1},
+			want:        []string{"一二三四", "四五六七", "七八九十"},
+			wantOffsets: []int{0, 3, 6},
+		},
+		{
+			name:        "固定大小去除頭尾空白",
+			text:        "ab  cdef",
+			opts:        Options{Strategy: StrategyFixed, Size: 4, Overlap: 0},
+			want:        []string{"ab", "cdef"},
+			wantOffsets: []int{0, 4},
+		},
+		{
+			name:        "中文句子不加空白也能切開",
+			text:        "今天天氣很好。明天會下雨！後天呢？",
+			opts:        Options{Strategy: StrategySentence, Size: 8, Overlap: 0},
+			want:        []string{"今天天氣很好。", "明天會下雨！", "後天呢？"},
+			wantOffsets: []int{0, 7, 13},
+		},
+		{
+			name:        "句子組合成塊並重疊完整句子",
+			text:        "今天天氣很好。明天會下雨！後天呢？",
+			opts:        Options{Strategy: StrategySentence, Size: 13, Overlap: 6},
+			want:        []string{"今天天氣很好。明天會下雨！", "明天會下雨！後天呢？"},
+			wantOffsets: []int{0, 7},
+		},
+		{
+			name:        "右引號跟著句尾",
+			text:        "他說：「好。」然後離開。",
+			opts:        Options{Strategy: StrategySentence, Size: 7, Overlap: 0},
+			want:        []string{"他說：「好。」", "然後離開。"},
+			wantOffsets: []int{0, 7},
+		},
+		{
+			name:        "半形句點後方沒有空白時不切開",
+			text:        "版本 1.5 已發布. 請更新.",
+			opts:        Options{Strategy: StrategySentence, Size: 12, Overlap: 0},
+			want:        []string{"版本 1.5 已發布.", "請更新."},
+			wantOffsets: []int{0, 12},
+		},
+		{
+			name:        "長句切割後各段之間的空白也計入大小",
+			text:        "ab" + strings.Repeat(" ", 12) + "cd.",
+			opts:        Options{Strategy: StrategySentence, Size: 10, Overlap: 0},
+			want:        []string{"ab", "cd."},
+			wantOffsets: []int{0, 14},
+		},
+		{
+			name:        "Markdown 依標題分節，程式碼區塊內的 # 不是標題",
+			text:        "# 安裝\n說明文字。\n## 設定\n設定步驟。\n```\n# 不是標題\n```\n# 使用\n用法。",
+			opts:        Options{Strategy: StrategyMarkdown, Size: 100, Overlap: 0},
+			want:        []string{"# 安裝\n說明文字。", "## 設定\n設定步驟。\n```\n# 不是標題\n```", "# 使用\n用法。"},
+			wantOffsets: []int{0, 11, 38},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := Split(tt.text, tt.opts)
+			if err != nil {
+				t.Fatalf("切塊失敗: %v", err)
+			}
+			checkChunks(t, tt.text, chunks, tt.opts)
+
+			if got := chunkTexts(chunks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("片段為 %q，預期 %q", got, tt.want)
+			}
+			offsets := make([]int, len(chunks))
+			for i, chunk := range chunks {
+				offsets[i] = chunk.Offset
+			}
+			if !reflect.DeepEqual(offsets, tt.wantOffsets) {
+				t.Errorf("起始位置為 %v，預期 %v", offsets, tt.wantOffsets)
+			}
+		})
+	}
+}
+
+// TestMarkdownHeadings 確認片段的標題路徑依層級更新
+func TestMarkdownHeadings(t *testing.T) {
+	text := "前言。\n# 安裝\n說明。\n## 設定\n步驟。\n### 進階 ###\n細節。\n## 升級\n注意。\n# 使用\n用法。"
+	chunks, err := Split(text, Options{Strategy: StrategyMarkdown, Size: 100, Overlap: 0})
+	if err != nil {
+		t.Fatalf("切塊失敗: %v", err)
+	}
+
+	headings := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		headings[i] = chunk.Heading
+	}
+	want := []string{"", "安裝", "安裝 > 設定", "安裝 > 設定 > 進階", "安裝 > 升級", "使用"}
+	if !reflect.DeepEqual(headings, want) {
+		t.Errorf("標題路徑為 %q，預期 %q", headings, want)
+	}
+}
+
+// TestSplitMaxSize 確認各種設定下的片段都不超過 Size，且內容與 Offset 一致
+func TestSplitMaxSize(t *testing.T) {
+	text := strings.Repeat("本月用電量較上月增加百分之十二，主要來自空調。", 5) + "\n\n" +
+		"The HVAC load rose 12% in March.   It   was   mostly   due   to   cooling.\n\n" +
+		strings.Repeat("沒有標點的很長的一段文字", 20) + "\n\n" +
+		"# 建議\n調整溫度設定。   關閉閒置設備！\n"
+
+	for _, strategy := range []Strategy{StrategyFixed, StrategySentence, StrategyMarkdown} {
+		for _, size := range []int{10, 37, 120} {
+			for _, overlap := range []int{0, size / 4} {
+				opts := Options{Strategy: strategy, Size: size, Overlap: overlap}
+				chunks, err := Split(text, opts)
+				if err != nil {
+					t.Fatalf("%+v: 切塊失敗: %v", opts, err)
+				}
+				if len(chunks) == 0 {
+					t.Fatalf("%+v: 沒有切出片段", opts)
+				}
+				checkChunks(t, text, chunks, opts)
+			}
+		}
+	}
+}
+
+// TestOptionsValidate 確認無效的設定被拒絕
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"預設值", DefaultOptions(), false},
+		{"未知的策略", Options{Strategy: "paragraph", Size: 10}, true},
+		{"大小為 0", Options{Strategy: StrategyFixed, Size: 0}, true},
+		{"重疊為負數", Options{Strategy: StrategyFixed, Size: 10, Overlap: -1}, true},
+		{"重疊不小於大小", Options{Strategy: StrategyFixed, Size: 10, Overlap: 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("錯誤為 %v，預期有錯誤: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
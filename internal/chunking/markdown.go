@@ -0,0 +1,91 @@
+package chunking
+
+import (
+	"strings"
+)
+
+// markdownSection 是一個 Markdown 標題之下（至下一個標題之前）的原文範圍
+type markdownSection struct {
+	start, end int
+	heading    string
+}
+
+// splitMarkdown 依 Markdown 標題分節，再於各節內以句子組合成塊
+// 程式碼區塊內以 # 開頭的行不視為標題
+func splitMarkdown(runes []rune, opts Options) []Chunk {
+	var chunks []Chunk
+	for _, section := range markdownSections(runes) {
+		for _, chunk := range splitSentences(runes, section.start, section.end, opts) {
+			chunk.Heading = section.heading
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// markdownSections 掃描每一行找出標題，標題行本身歸入其所屬的節
+func markdownSections(runes []rune) []markdownSection {
+	var sections []markdownSection
+	var path []string // 各層級目前的標題
+	current := markdownSection{}
+	inFence := false
+
+	for lineStart := 0; lineStart < len(runes); {
+		lineEnd := lineStart
+		for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+			lineEnd++
+		}
+		line := strings.TrimSpace(string(runes[lineStart:lineEnd]))
+
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+		} else if level, title := parseHeading(line); !inFence && level > 0 {
+			current.end = lineStart
+			if current.end > current.start {
+				sections = append(sections, current)
+			}
+
+			if len(path) >= level {
+				path = path[:level-1]
+			}
+			for len(path) < level-1 {
+				path = append(path, "")
+			}
+			path = append(path, title)
+
+			current = markdownSection{start: lineStart, heading: joinHeadingPath(path)}
+		}
+
+		lineStart = lineEnd + 1
+	}
+
+	current.end = len(runes)
+	if current.end > current.start {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// parseHeading 解析 ATX 標題（# 到 ######），不是標題時 level 為 0
+func parseHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level == len(line) || (line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	return level, normalizeHeading(title)
+}
+
+// joinHeadingPath 以 " > " 串接非空的標題層級
+func joinHeadingPath(path []string) string {
+	parts := make([]string, 0, len(path))
+	for _, p := range path {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
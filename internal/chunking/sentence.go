@@ -0,0 +1,128 @@
+package chunking
+
+// span 是原文中的一段範圍 [start, end)
+type span struct {
+	start, end   int
+	paragraphEnd bool // 此段落結束於段落邊界（空行或文本結尾）
+}
+
+func (s span) length() int {
+	return s.end - s.start
+}
+
+// isSentenceTerminator 判斷字元是否結束一個句子
+// 全形標點（。！？；）無論後方是否有空白都視為句尾，半形標點則需要後方為空白，避免切開小數或網址
+func isSentenceTerminator(runes []rune, i int) bool {
+	switch runes[i] {
+	case '。', '！', '？', '；', '…':
+		return true
+	case '.', '!', '?', ';':
+		return i+1 >= len(runes) || runes[i+1] == ' ' || runes[i+1] == '\t' || runes[i+1] == '\n' || runes[i+1] == '\r'
+	}
+	return false
+}
+
+// isClosingPunctuation 判斷字元是否為緊接在句尾後的右引號或右括號
+func isClosingPunctuation(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '」', '』', '）', '”', '’', '】', '》':
+		return true
+	}
+	return false
+}
+
+// sentenceSpans 將原文 [start, end) 切成句子，換行也視為句子邊界
+func sentenceSpans(runes []rune, start, end int) []span {
+	var spans []span
+	sentenceStart := start
+
+	for i := start; i < end; i++ {
+		boundary := false
+		if runes[i] == '\n' {
+			boundary = true
+		} else if isSentenceTerminator(runes, i) {
+			for i+1 < end && isClosingPunctuation(runes[i+1]) {
+				i++
+			}
+			boundary = true
+		}
+		if !boundary {
+			continue
+		}
+
+		// 句尾之後若緊接空行則為段落結尾
+		j := i + 1
+		newlines := 0
+		if runes[i] == '\n' {
+			newlines++
+		}
+		for j < end && (runes[j] == '\n' || runes[j] == '\r' || runes[j] == ' ' || runes[j] == '\t') {
+			if runes[j] == '\n' {
+				newlines++
+			}
+			j++
+		}
+
+		spans = append(spans, span{start: sentenceStart, end: j, paragraphEnd: newlines >= 2 || j >= end})
+		sentenceStart = j
+		i = j - 1
+	}
+
+	if sentenceStart < end {
+		spans = append(spans, span{start: sentenceStart, end: end, paragraphEnd: true})
+	}
+	return spans
+}
+
+// splitSentences 以句子為單位組合成不超過 Size 的片段
+// 片段已超過一半大小且剛好在段落結尾時會提早切開；單一句子超過 Size 時改用固定大小切割
+// 相鄰片段會重複前一片段結尾處總長不超過 Overlap 的完整句子
+// 長度以片段在原文中的範圍計算，句子之間（包括長句切割後各段之間）的空白也算在內，片段不會超過 Size
+func splitSentences(runes []rune, start, end int, opts Options) []Chunk {
+	var spans []span
+	for _, s := range sentenceSpans(runes, start, end) {
+		if s.length() <= opts.Size {
+			spans = append(spans, s)
+			continue
+		}
+		pieces := splitFixed(runes, s.start, s.end, opts)
+		for i, c := range pieces {
+			length := len([]rune(c.Text))
+			spans = append(spans, span{start: c.Offset, end: c.Offset + length, paragraphEnd: i == len(pieces)-1 && s.paragraphEnd})
+		}
+	}
+
+	var chunks []Chunk
+	for first := 0; first < len(spans); {
+		last := first
+		size := spans[first].length()
+		for last+1 < len(spans) && spans[last+1].end-spans[first].start <= opts.Size {
+			if spans[last].paragraphEnd && size >= opts.Size/2 {
+				break
+			}
+			last++
+			size = spans[last].end - spans[first].start
+		}
+
+		if chunk, ok := newChunk(runes, spans[first].start, spans[last].end); ok {
+			chunks = append(chunks, chunk)
+		}
+
+		if last+1 >= len(spans) {
+			break
+		}
+
+		// 從結尾往回找可放入重疊範圍的句子，且至少前進一個句子
+		// 重疊部分不得擠掉下一個新句子，否則會產生只有重疊內容的片段
+		next := last + 1
+		for k := last; k > first; k-- {
+			if spans[last].end-spans[k].start > opts.Overlap || spans[last+1].end-spans[k].start > opts.Size {
+				break
+			}
+			next = k
+		}
+		first = next
+	}
+
+	return chunks
+}
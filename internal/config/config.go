@@ -16,12 +16,77 @@ type Config struct {
 	GeminiAPIKey string
 	OpenAiAPIKey string
 
+	// local OpenAI-compatible server (Ollama, vLLM, llama.cpp), disabled when the base url is empty
+	LocalLLMBaseURL            string
+	LocalLLMAPIKey             string
+	LocalLLMChatModel          string
+	LocalLLMEmbeddingModel     string
+	LocalLLMEmbeddingDimension int
+	LocalLLMEmbeddingMaxTokens int // tokens the local embedding model accepts per input, longer inputs are rejected
+	LocalLLMContextWindow      int // tokens the local chat model accepts, prompt and answer together
+
+	// deterministic fake provider for CI and offline development
+	FakeLLMEnabled            bool
+	FakeLLMScript             string
+	FakeLLMEmbeddingDimension int
+
+	// chat model used when a request does not specify one
+	DefaultLLM string
+	// embedding model used by rag, document search and uploads when a request does not specify one
+	DefaultEmbeddingModel string
+
+	// retry, rate limit and circuit breaker settings shared by all llm providers
+	LLMMaxAttempts      int
+	LLMRetryBaseDelay   time.Duration
+	LLMRetryMaxDelay    time.Duration
+	LLMRateLimit        float64
+	LLMRateBurst        int
+	LLMRateLimits       string // per provider/model overrides, e.g. "openai/text-embedding-3-small=50,gemini=5"
+	LLMBreakerThreshold int
+	LLMBreakerCooldown  time.Duration
+
+	// per-operation timeouts for llm calls, retries included
+	LLMChatTimeout           time.Duration
+	LLMStreamTimeout         time.Duration
+	LLMEmbeddingTimeout      time.Duration
+	LLMBatchEmbeddingTimeout time.Duration
+
+	// reduced output dimensions for the openai 3-series embedding models, e.g. "openai-3-large=1024"
+	EmbeddingDimensions string
+
+	// batch embedding limits, 0 leaves only the embedding model's own limits
+	EmbeddingBatchMaxInputs   int
+	EmbeddingBatchMaxTokens   int
+	EmbeddingBatchConcurrency int
+
+	// embedding cache: in-memory lru size (0 disables it) and the optional postgres tier
+	EmbeddingCacheSize    int
+	EmbeddingCachePersist bool
+
+	// llm usage accounting and per-model prices (USD per 1M tokens) for cost estimates,
+	// e.g. "gpt-4o=2.5/10,text-embedding-3-small=0.02"
+	LLMUsageEnabled bool
+	LLMPrices       string
+
+	// cross-encoder reranker behind a Cohere / Jina compatible rerank api, disabled when
+	// the endpoint is empty
+	RerankEndpoint string
+	RerankAPIKey   string
+	RerankModel    string
+	RerankTimeout  time.Duration
+
 	// vector db config
 	MilvusHost     string
 	MilvusPort     string
 	MilvusRESTPort string
 	MilvusUsername string
 	MilvusPassword string
+	MilvusDBName   string
+	MilvusTimeout  time.Duration
+
+	// serve milvus over https, optionally accepting self-signed certificates
+	MilvusTLS                   bool
+	MilvusTLSInsecureSkipVerify bool
 
 	// postgres db
 	PostgresHost     string
@@ -65,19 +130,82 @@ func (c *Config) LoadConfig() error {
 	// --- Config Setup ---
 
 	// -- llm keys --
-	c.GeminiAPIKey = util.GetEnvString("GEMINI_API_KEY", "")
-	c.OpenAiAPIKey = util.GetEnvString("OPENAI_API_KEY", "")
-
-	fmt.Printf("env: %s\n", c.OpenAiAPIKey)
-	fmt.Printf("env: %s\n", c.GeminiAPIKey)
-
+	c.GeminiAPIKey = util.GetEnvSecret("GEMINI_API_KEY", "")
+	c.OpenAiAPIKey = util.GetEnvSecret("OPENAI_API_KEY", "")
+
+	// -- fake llm --
+	c.FakeLLMEnabled = util.GetEnvBool("FAKE_LLM_ENABLED", false)
+	c.FakeLLMScript = util.GetEnvString("FAKE_LLM_SCRIPT", "")
+	c.FakeLLMEmbeddingDimension = util.GetEnvInt("FAKE_LLM_EMBEDDING_DIMENSION", 256)
+	c.DefaultLLM = util.GetEnvString("DEFAULT_LLM", "openai")
+	c.DefaultEmbeddingModel = util.GetEnvString("DEFAULT_EMBEDDING_MODEL", "openai-ada-002")
+
+	// every provider key is optional, a missing key only disables that provider
+	// (the llm factory reports availability on /api/capabilities); only whether
+	// a key is set is logged, never the key itself
 	if c.GeminiAPIKey == "" {
-		log.Fatal("GEMINI_API_KEY 環境變量未設置")
+		log.Printf("GEMINI_API_KEY 環境變量未設置，Gemini 已停用")
+	} else {
+		log.Printf("GEMINI_API_KEY 環境變量已設置")
 	}
 	if c.OpenAiAPIKey == "" {
-		log.Fatal("OPENAI_API_KEY 環境變量未設置")
+		log.Printf("OPENAI_API_KEY 環境變量未設置，OpenAI 已停用")
 	} else {
-		log.Printf(c.OpenAiAPIKey + "OPENAI_API_KEY 環境變量已設置")
+		log.Printf("OPENAI_API_KEY 環境變量已設置")
+	}
+
+	// -- llm resilience --
+	c.LLMMaxAttempts = util.GetEnvInt("LLM_MAX_ATTEMPTS", 4)
+	c.LLMRetryBaseDelay = util.GetEnvDuration("LLM_RETRY_BASE_DELAY", 500*time.Millisecond)
+	c.LLMRetryMaxDelay = util.GetEnvDuration("LLM_RETRY_MAX_DELAY", 30*time.Second)
+	c.LLMRateLimit = util.GetEnvFloat("LLM_RATE_LIMIT", 10)
+	c.LLMRateBurst = util.GetEnvInt("LLM_RATE_BURST", 10)
+	c.LLMRateLimits = util.GetEnvString("LLM_RATE_LIMITS", "")
+	c.LLMBreakerThreshold = util.GetEnvInt("LLM_BREAKER_THRESHOLD", 5)
+	c.LLMBreakerCooldown = util.GetEnvDuration("LLM_BREAKER_COOLDOWN", 30*time.Second)
+	c.LLMChatTimeout = util.GetEnvDuration("LLM_CHAT_TIMEOUT", 60*time.Second)
+	c.LLMStreamTimeout = util.GetEnvDuration("LLM_STREAM_TIMEOUT", 5*time.Minute)
+	c.LLMEmbeddingTimeout = util.GetEnvDuration("LLM_EMBEDDING_TIMEOUT", 30*time.Second)
+	c.LLMBatchEmbeddingTimeout = util.GetEnvDuration("LLM_BATCH_EMBEDDING_TIMEOUT", 2*time.Minute)
+
+	// -- embedding dimensions --
+	c.EmbeddingDimensions = util.GetEnvString("EMBEDDING_DIMENSIONS", "")
+
+	// -- batch embeddings --
+	c.EmbeddingBatchMaxInputs = util.GetEnvInt("EMBEDDING_BATCH_MAX_INPUTS", 0)
+	c.EmbeddingBatchMaxTokens = util.GetEnvInt("EMBEDDING_BATCH_MAX_TOKENS", 0)
+	c.EmbeddingBatchConcurrency = util.GetEnvInt("EMBEDDING_BATCH_CONCURRENCY", 4)
+
+	// -- embedding cache --
+	c.EmbeddingCacheSize = util.GetEnvInt("EMBEDDING_CACHE_SIZE", 5000)
+	c.EmbeddingCachePersist = util.GetEnvBool("EMBEDDING_CACHE_PERSIST", false)
+
+	// -- llm usage --
+	c.LLMUsageEnabled = util.GetEnvBool("LLM_USAGE_ENABLED", true)
+	c.LLMPrices = util.GetEnvString("LLM_PRICES", "")
+
+	// -- reranking --
+	c.RerankEndpoint = util.GetEnvString("RERANK_ENDPOINT", "")
+	c.RerankAPIKey = util.GetEnvSecret("RERANK_API_KEY", "")
+	c.RerankModel = util.GetEnvString("RERANK_MODEL", "")
+	c.RerankTimeout = util.GetEnvDuration("RERANK_TIMEOUT", 30*time.Second)
+
+	// -- local llm --
+	c.LocalLLMBaseURL = util.GetEnvString("LOCAL_LLM_BASE_URL", "")
+	c.LocalLLMAPIKey = util.GetEnvSecret("LOCAL_LLM_API_KEY", "")
+	c.LocalLLMChatModel = util.GetEnvString("LOCAL_LLM_CHAT_MODEL", "llama3.1")
+	c.LocalLLMEmbeddingModel = util.GetEnvString("LOCAL_LLM_EMBEDDING_MODEL", "nomic-embed-text")
+	c.LocalLLMEmbeddingDimension = util.GetEnvInt("LOCAL_LLM_EMBEDDING_DIMENSION", 768)
+	c.LocalLLMEmbeddingMaxTokens = util.GetEnvInt("LOCAL_LLM_EMBEDDING_MAX_TOKENS", 2048)
+	c.LocalLLMContextWindow = util.GetEnvInt("LOCAL_LLM_CONTEXT_WINDOW", 8192)
+
+	if c.LocalLLMBaseURL != "" {
+		log.Printf("Local LLM configuration: base_url=%s, chat_model=%s, embedding_model=%s (%d dims, %d max tokens)",
+			c.LocalLLMBaseURL,
+			c.LocalLLMChatModel,
+			c.LocalLLMEmbeddingModel,
+			c.LocalLLMEmbeddingDimension,
+			c.LocalLLMEmbeddingMaxTokens)
 	}
 
 	// -- vector db --
@@ -85,21 +213,26 @@ func (c *Config) LoadConfig() error {
 	c.MilvusPort = util.GetEnvString("MILVUS_PORT", "19530")
 	c.MilvusRESTPort = util.GetEnvString("MILVUS_REST_PORT", "9091")
 	c.MilvusUsername = util.GetEnvString("MILVUS_USERNAME", "root")
-	c.MilvusPassword = util.GetEnvString("MILVUS_PASSWORD", "milvus")
+	c.MilvusPassword = util.GetEnvSecret("MILVUS_PASSWORD", "Milvus")
+	c.MilvusDBName = util.GetEnvString("MILVUS_DB_NAME", "default")
+	c.MilvusTimeout = util.GetEnvDuration("MILVUS_TIMEOUT", 10*time.Second)
+	c.MilvusTLS = util.GetEnvBool("MILVUS_TLS", false)
+	c.MilvusTLSInsecureSkipVerify = util.GetEnvBool("MILVUS_TLS_INSECURE_SKIP_VERIFY", false)
 
-	log.Printf("Successfully loaded Gemini API Key")
 	log.Printf("Running in local development mode")
-	log.Printf("Milvus configuration: host=%s, port=%s, rest_port=%s",
+	log.Printf("Milvus configuration: host=%s, port=%s, rest_port=%s, db=%s, tls=%t",
 		c.MilvusHost,
 		c.MilvusPort,
-		c.MilvusRESTPort)
+		c.MilvusRESTPort,
+		c.MilvusDBName,
+		c.MilvusTLS)
 
 	// -- Postgres DB --
 	c.PostgresHost = util.GetEnvString("POSTGRES_HOST", "localhost")
 	c.PostgresHost = util.GetEnvString("POSTGRES_HOST", "127.0.0.1")
 	c.PostgresPort = util.GetEnvString("POSTGRES_PORT", "5555")
 	c.PostgresUser = util.GetEnvString("POSTGRES_USER", "user")
-	c.PostgresPassword = util.GetEnvString("POSTGRES_PASSWORD", "password")
+	c.PostgresPassword = util.GetEnvSecret("POSTGRES_PASSWORD", "password")
 	c.PostgresDBName = util.GetEnvString("POSTGRES_DB", "ai_poc_db")
 
 	return nil
@@ -133,7 +266,11 @@ func (c *Config) monitorMilvusService(ctx context.Context) {
 * checks mulvis health.
 **/
 func (c *Config) checkMilvusHealth() {
-	resp, err := http.Get(fmt.Sprintf("http://%s:%s/api/v1/health", c.MilvusHost, c.MilvusRESTPort))
+	scheme := "http"
+	if c.MilvusTLS {
+		scheme = "https"
+	}
+	resp, err := http.Get(fmt.Sprintf("%s://%s:%s/api/v1/health", scheme, c.MilvusHost, c.MilvusRESTPort))
 
 	if err != nil {
 		c.MilvusServiceHealty = false
@@ -162,7 +299,7 @@ func (c *Config) checkMilvusHealth() {
 **/
 func (c *Config) handleErrors() {
 	for err := range c.errorChan {
-		fmt.Errorf("Error detected with mulvis service during health check: %s\n", err)
+		log.Printf("Error detected with mulvis service during health check: %s", err)
 	}
 }
 
@@ -0,0 +1,107 @@
+package conversation
+
+import (
+	"ai-workshop/internal/utils/errorutils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// CreateConversation creates an empty conversation owned by the current user
+func (h *Handler) CreateConversation(c *gin.Context) {
+	var req CreateConversationRequest
+	userId, _ := c.Get("userId")
+
+	// body is optional, an empty body creates an untitled conversation
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+	}
+
+	conversation, err := h.service.CreateConversation(c.Request.Context(), userId.(uuid.UUID), req.Title)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": conversation,
+	})
+}
+
+// ListConversations lists the current user's conversations, most recent first
+func (h *Handler) ListConversations(c *gin.Context) {
+	userId, _ := c.Get("userId")
+
+	conversations, err := h.service.ListConversations(c.Request.Context(), userId.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list conversations: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": conversations,
+	})
+}
+
+// GetConversation returns a conversation with its full message history
+func (h *Handler) GetConversation(c *gin.Context) {
+	userId, _ := c.Get("userId")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation id"})
+		return
+	}
+
+	conversation, err := h.service.GetConversation(c.Request.Context(), userId.(uuid.UUID), id)
+	if errors.Is(err, errorutils.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversation: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": conversation,
+	})
+}
+
+// DeleteConversation deletes a conversation and all of its messages
+func (h *Handler) DeleteConversation(c *gin.Context) {
+	userId, _ := c.Get("userId")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation id"})
+		return
+	}
+
+	err = h.service.DeleteConversation(c.Request.Context(), userId.(uuid.UUID), id)
+	if errors.Is(err, errorutils.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Conversation deleted successfully",
+	})
+}
@@ -0,0 +1,19 @@
+package conversation
+
+import "ai-workshop/internal/models"
+
+// message roles stored in the messages table
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type CreateConversationRequest struct {
+	Title string `json:"title"`
+}
+
+type ConversationDetail struct {
+	models.Conversation
+	Messages []models.ConversationMessage `json:"messages"`
+}
@@ -0,0 +1,141 @@
+package conversation
+
+import (
+	"ai-workshop/internal/models"
+	"ai-workshop/internal/utils/errorutils"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository interface {
+	Create(ctx context.Context, conversation *models.Conversation) error
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Conversation, error)
+	GetByID(ctx context.Context, userID, id uuid.UUID) (*models.Conversation, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	ListMessages(ctx context.Context, conversationID uuid.UUID) ([]models.ConversationMessage, error)
+	AppendMessages(ctx context.Context, conversationID uuid.UUID, title string, messages []models.ConversationMessage) error
+}
+
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRepository) Create(ctx context.Context, conversation *models.Conversation) error {
+	query := `
+		INSERT INTO conversations (user_id, title)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, conversation.UserID, conversation.Title).
+		Scan(&conversation.ID, &conversation.CreatedAt, &conversation.UpdatedAt)
+
+	return errorutils.AnalyzeDBErr(err)
+}
+
+func (r *PostgresRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Conversation, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, title
+		FROM conversations
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+	`
+
+	conversations := []models.Conversation{}
+	err := r.db.SelectContext(ctx, &conversations, query, userID)
+	return conversations, err
+}
+
+/**
+* Gets a conversation only if it is owned by the given user, otherwise
+* ErrNotFound is returned so that other users' conversations are not leaked.
+**/
+func (r *PostgresRepository) GetByID(ctx context.Context, userID, id uuid.UUID) (*models.Conversation, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, title
+		FROM conversations
+		WHERE id = $1 AND user_id = $2
+	`
+
+	var conversation models.Conversation
+	if err := r.db.GetContext(ctx, &conversation, query, id, userID); err != nil {
+		return nil, errorutils.AnalyzeDBErr(err)
+	}
+
+	return &conversation, nil
+}
+
+func (r *PostgresRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	query := `DELETE FROM conversations WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errorutils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) ListMessages(ctx context.Context, conversationID uuid.UUID) ([]models.ConversationMessage, error) {
+	query := `
+		SELECT id, created_at, conversation_id, role, content
+		FROM messages
+		WHERE conversation_id = $1
+		ORDER BY seq ASC
+	`
+
+	messages := []models.ConversationMessage{}
+	err := r.db.SelectContext(ctx, &messages, query, conversationID)
+	return messages, err
+}
+
+/**
+* Appends messages to a conversation in one transaction and bumps its
+* updated_at. The title is only applied when the conversation has none yet.
+**/
+func (r *PostgresRepository) AppendMessages(ctx context.Context, conversationID uuid.UUID, title string, messages []models.ConversationMessage) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, message := range messages {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO messages (conversation_id, role, content) VALUES ($1, $2, $3)`,
+			conversationID, message.Role, message.Content,
+		)
+		if err != nil {
+			return errorutils.AnalyzeDBErr(err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversations
+		SET updated_at = CURRENT_TIMESTAMP,
+			title = CASE WHEN title = '' THEN $2 ELSE title END
+		WHERE id = $1
+	`, conversationID, title)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	return tx.Commit()
+}
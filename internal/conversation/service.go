@@ -0,0 +1,95 @@
+package conversation
+
+import (
+	"ai-workshop/internal/models"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// maximum number of runes of the first user message used as a default title
+const titleMaxLength = 50
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func (s *Service) CreateConversation(ctx context.Context, userID uuid.UUID, title string) (*models.Conversation, error) {
+	conversation := &models.Conversation{
+		UserID: userID,
+		Title:  title,
+	}
+
+	if err := s.repo.Create(ctx, conversation); err != nil {
+		return nil, err
+	}
+
+	return conversation, nil
+}
+
+func (s *Service) ListConversations(ctx context.Context, userID uuid.UUID) ([]models.Conversation, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+/**
+* Gets a conversation owned by the user together with all of its messages.
+**/
+func (s *Service) GetConversation(ctx context.Context, userID, id uuid.UUID) (*ConversationDetail, error) {
+	conversation, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.repo.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConversationDetail{
+		Conversation: *conversation,
+		Messages:     messages,
+	}, nil
+}
+
+func (s *Service) DeleteConversation(ctx context.Context, userID, id uuid.UUID) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+/**
+* Returns the ordered message history of a conversation owned by the user.
+**/
+func (s *Service) History(ctx context.Context, userID, id uuid.UUID) ([]models.ConversationMessage, error) {
+	conversation, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListMessages(ctx, conversation.ID)
+}
+
+/**
+* Stores one user/assistant exchange. Untitled conversations are titled after
+* their first user message.
+**/
+func (s *Service) AppendExchange(ctx context.Context, conversationID uuid.UUID, userContent, assistantContent string) error {
+	messages := []models.ConversationMessage{
+		{ConversationID: conversationID, Role: RoleUser, Content: userContent},
+		{ConversationID: conversationID, Role: RoleAssistant, Content: assistantContent},
+	}
+
+	return s.repo.AppendMessages(ctx, conversationID, defaultTitle(userContent), messages)
+}
+
+func defaultTitle(content string) string {
+	runes := []rune(content)
+	if len(runes) > titleMaxLength {
+		return string(runes[:titleMaxLength]) + "..."
+	}
+	return content
+}
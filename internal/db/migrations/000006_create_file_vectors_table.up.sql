@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS file_vectors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    file_name TEXT NOT NULL,
+    collection_name TEXT NOT NULL,
+    embedding_type VARCHAR(50) NOT NULL,
+    vector_id TEXT NOT NULL, -- Milvus primary key, kept as text to preserve INT64 precision
+    chunk_index INT NOT NULL,
+
+    UNIQUE (collection_name, vector_id)
+);
+
+CREATE INDEX idx_file_vectors_file_name ON file_vectors (file_name, chunk_index);
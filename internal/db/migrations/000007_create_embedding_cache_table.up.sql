@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS embedding_cache (
+    model TEXT NOT NULL, -- provider/api model, e.g. openai/text-embedding-3-small
+    content_hash CHAR(64) NOT NULL, -- SHA-256 of the normalized text
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    dimension INT NOT NULL,
+    embedding REAL[] NOT NULL,
+
+    PRIMARY KEY (model, content_hash)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS llm_usage (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL for anonymous requests
+    endpoint TEXT NOT NULL DEFAULT '',
+    provider VARCHAR(50) NOT NULL,
+    model TEXT NOT NULL,
+    operation VARCHAR(50) NOT NULL,
+
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    embedding_tokens INT NOT NULL DEFAULT 0,
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    estimated BOOLEAN NOT NULL DEFAULT FALSE, -- token counts computed locally, the provider reported none
+
+    success BOOLEAN NOT NULL,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_llm_usage_created_at ON llm_usage (created_at);
+CREATE INDEX idx_llm_usage_user_created ON llm_usage (user_id, created_at);
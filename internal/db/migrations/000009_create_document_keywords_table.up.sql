@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS document_keywords (
+    collection_name TEXT NOT NULL,
+    vector_id TEXT NOT NULL, -- Milvus primary key, kept as text to preserve INT64 precision
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    lexemes TSVECTOR NOT NULL, -- terms from documents.KeywordTerms, CJK text is split into characters and bigrams
+
+    PRIMARY KEY (collection_name, vector_id)
+);
+
+CREATE INDEX idx_document_keywords_lexemes ON document_keywords USING GIN (lexemes);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS prompt_template_versions;
+DROP TABLE IF EXISTS prompt_templates;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    active_version INT NOT NULL DEFAULT 1 -- version used by chat and rag requests that name this template
+);
+
+CREATE TABLE IF NOT EXISTS prompt_template_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    system TEXT NOT NULL DEFAULT '', -- optional system message, go text/template syntax
+    content TEXT NOT NULL,           -- user message, go text/template syntax
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    UNIQUE (template_id, version)
+);
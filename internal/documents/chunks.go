@@ -0,0 +1,191 @@
+package documents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+)
+
+// Chunk 是要寫入向量資料庫的一個文本片段，每個片段各自成為一筆向量資料
+type Chunk struct {
+	Text       string                 `json:"text"`
+	SourceFile string                 `json:"source_file"`        // 所屬的來源檔案（或文件 ID）
+	ChunkIndex int                    `json:"chunk_index"`        // 片段在來源中的序號
+	Offset     int                    `json:"offset"`             // 片段在來源文本中的起始字元位置
+	OwnerID    string                 `json:"owner_id,omitempty"` // 上傳者的使用者 ID
+	Metadata   map[string]interface{} `json:"metadata,omitempty"` // 頁碼、工作表、標題等結構資訊
+}
+
+// InsertChunksWithEmbedding 為每個片段生成嵌入向量，並逐筆寫入對應的集合，返回各片段的向量 ID
+func (s *Service) InsertChunksWithEmbedding(ctx context.Context, chunks []Chunk, embeddingType llm.EmbeddingType) ([]string, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("沒有可插入的文本片段")
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embedder, err := s.embedder(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := embedder.CreateBatchEmbeddingsWith(ctx, embeddingType, texts)
+	if err != nil {
+		return nil, fmt.Errorf("批量生成嵌入向量失敗: %w", err)
+	}
+
+	return s.InsertChunkVectors(ctx, chunks, vectors, embeddingType)
+}
+
+// InsertChunkVectors 將已生成嵌入向量的片段寫入對應的集合，vectors 需與 chunks 一一對應
+// 返回的向量 ID 與 chunks 順序相同，寫入後同時加入關鍵字索引
+func (s *Service) InsertChunkVectors(ctx context.Context, chunks []Chunk, vectors [][]float32, embeddingType llm.EmbeddingType) ([]string, error) {
+	if len(chunks) != len(vectors) {
+		return nil, fmt.Errorf("片段數量 %d 與向量數量 %d 不一致", len(chunks), len(vectors))
+	}
+
+	embedder, err := s.embedder(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
+	// 確保集合存在
+	dimension, err := embedder.GetDimensionFor(embeddingType)
+	if err != nil {
+		return nil, fmt.Errorf("獲取嵌入維度失敗: %v", err)
+	}
+
+	if err := s.ensureCollectionWithDimension(ctx, dimension, embeddingType); err != nil {
+		return nil, fmt.Errorf("確保集合存在失敗: %w", err)
+	}
+
+	insertData := make([]map[string]interface{}, len(chunks))
+	for i, chunk := range chunks {
+		insertData[i] = newRow(chunk, vectors[i])
+	}
+
+	collectionName := getCollectionName(embeddingType)
+	ids, err := s.milvusClient.InsertVectors(ctx, collectionName, insertData)
+	if err != nil {
+		return nil, fmt.Errorf("插入向量失敗: %v", err)
+	}
+	if len(ids) != len(chunks) {
+		return nil, fmt.Errorf("插入 %d 個片段但只取得 %d 個向量 ID", len(chunks), len(ids))
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	s.indexKeywords(ctx, collectionName, ids, texts)
+	return ids, nil
+}
+
+// newRow 建立一筆插入資料，集合定義的每個純量欄位都必須有值
+func newRow(chunk Chunk, vector []float32) map[string]interface{} {
+	metadata := chunk.Metadata
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		milvus.FieldVector:     vector,
+		milvus.FieldText:       chunk.Text,
+		milvus.FieldSourceFile: chunk.SourceFile,
+		milvus.FieldChunkIndex: chunk.ChunkIndex,
+		milvus.FieldOffset:     chunk.Offset,
+		milvus.FieldOwnerID:    chunk.OwnerID,
+		milvus.FieldCreatedAt:  time.Now().Unix(),
+		milvus.FieldMetadata:   metadata,
+	}
+}
+
+// documentFromRow 將搜尋或查詢結果轉換為文檔，缺少 text 欄位時返回 false
+// 舊資料可能沒有來源等欄位，缺少時保留零值
+func documentFromRow(row map[string]interface{}) (Document, bool) {
+	text, ok := row[milvus.FieldText].(string)
+	if !ok {
+		return Document{}, false
+	}
+
+	// 搜尋與查詢結果的數字都以 json.Number 解析，INT64 主鍵保持原本的精度
+	var id string
+	switch value := row[milvus.FieldID].(type) {
+	case string:
+		id = value
+	case json.Number:
+		id = value.String()
+	default:
+		id = fmt.Sprintf("%v", value)
+	}
+
+	doc := Document{
+		ID:   id,
+		Text: text,
+	}
+	// v1 搜尋以 distance 返回相似度（集合使用 COSINE，越大越相似），其他來源則使用 score
+	if value, ok := numberValue(row["distance"]); ok {
+		doc.Score = value
+	} else if value, ok := numberValue(row["score"]); ok {
+		doc.Score = value
+	}
+	doc.SourceFile, _ = row[milvus.FieldSourceFile].(string)
+	doc.OwnerID, _ = row[milvus.FieldOwnerID].(string)
+	doc.Metadata, _ = row[milvus.FieldMetadata].(map[string]interface{})
+	if value, ok := numberValue(row[milvus.FieldChunkIndex]); ok {
+		doc.ChunkIndex = int(value)
+	}
+	if value, ok := numberValue(row[milvus.FieldOffset]); ok {
+		doc.Offset = int(value)
+	}
+	if value, ok := numberValue(row[milvus.FieldCreatedAt]); ok {
+		doc.CreatedAt = int64(value)
+	}
+	if values, ok := row[milvus.FieldVector].([]interface{}); ok {
+		doc.Vector = make([]float32, 0, len(values))
+		for _, v := range values {
+			if f, ok := numberValue(v); ok {
+				doc.Vector = append(doc.Vector, float32(f))
+			}
+		}
+	}
+
+	return doc, true
+}
+
+// lastRowID 返回一頁查詢結果最後一筆的主鍵，作為下一頁的 cursor（見 milvus.Client.ListVectors 的排序說明）
+func lastRowID(rows []map[string]interface{}) (int64, bool) {
+	if len(rows) == 0 {
+		return 0, false
+	}
+
+	switch value := rows[len(rows)-1][milvus.FieldID].(type) {
+	case json.Number:
+		id, err := value.Int64()
+		return id, err == nil
+	case string:
+		id, err := strconv.ParseInt(value, 10, 64)
+		return id, err == nil
+	}
+	return 0, false
+}
+
+// numberValue 將 JSON 解析出的數字（float64 或 json.Number）轉為 float64
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -2,25 +2,29 @@
 package documents
 
 import (
-	"ai-workshop/internal/config"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type Handler struct {
 	service *Service
 }
 
-func NewHandler(config *config.Config) *Handler {
+func NewHandler(service *Service) *Handler {
 	return &Handler{
-		service: NewService(config),
+		service: service,
 	}
 }
 
 // ListCollections 列出所有集合
 func (h *Handler) ListCollections(c *gin.Context) {
-	collections, err := h.service.ListCollections()
+	collections, err := h.service.ListCollections(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -30,8 +34,8 @@ func (h *Handler) ListCollections(c *gin.Context) {
 
 // CreateCollection 創建集合的 API
 func (h *Handler) CreateCollection(c *gin.Context) {
-	if err := h.service.CreateDocumentCollection(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.CreateDocumentCollection(c.Request.Context()); err != nil {
+		c.JSON(llm.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "集合創建成功"})
@@ -49,9 +53,9 @@ func (h *Handler) InsertDocument(c *gin.Context) {
 	}
 
 	// 呼叫更新後的 service 方法，它會自動生成 ID
-	id, err := h.service.InsertDocument(req.Text)
+	id, err := h.service.InsertDocument(c.Request.Context(), req.Text)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(llm.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -62,9 +66,38 @@ func (h *Handler) InsertDocument(c *gin.Context) {
 	})
 }
 
-// ListVectors 列出文件的 API
+// ListVectors 分頁列出文件的 API
+// 查詢參數：limit、offset 或 cursor（上一頁的 next_cursor）、q（文字包含）、embedding_model、with_vectors
 func (h *Handler) ListVectors(c *gin.Context) {
-	docs, err := h.service.ListVectors()
+	var req struct {
+		Limit          int               `form:"limit"`
+		Offset         int               `form:"offset"`
+		Cursor         string            `form:"cursor"`
+		Query          string            `form:"q"`
+		EmbeddingModel llm.EmbeddingType `form:"embedding_model"`
+		WithVectors    bool              `form:"with_vectors"`
+	}
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的查詢參數: " + err.Error()})
+		return
+	}
+
+	if req.EmbeddingModel == "" {
+		req.EmbeddingModel = h.service.DefaultEmbeddingType()
+	}
+
+	docs, err := h.service.ListVectorsWithEmbedding(c.Request.Context(), req.EmbeddingModel, ListOptions{
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+		Cursor:      req.Cursor,
+		Contains:    req.Query,
+		WithVectors: req.WithVectors,
+	})
+	if errors.Is(err, ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -83,7 +116,7 @@ func (h *Handler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteDocument(req.ID); err != nil {
+	if err := h.service.DeleteDocument(c.Request.Context(), req.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -102,7 +135,7 @@ func (h *Handler) DeleteDocuments(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteDocuments(req.IDs); err != nil {
+	if err := h.service.DeleteDocuments(c.Request.Context(), req.IDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -110,9 +143,18 @@ func (h *Handler) DeleteDocuments(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "文件批量刪除成功"})
 }
 
-// DeleteCollection 刪除整個集合的 API
+// DeleteCollection 刪除整個集合的 API，可用查詢參數 embedding_model 指定集合，預設為默認嵌入模型的集合
 func (h *Handler) DeleteCollection(c *gin.Context) {
-	if err := h.service.DeleteCollection(); err != nil {
+	embeddingModel := llm.EmbeddingType(c.Query("embedding_model"))
+	if embeddingModel == "" {
+		embeddingModel = h.service.DefaultEmbeddingType()
+	}
+	if _, err := llm.LookupEmbeddingModel(embeddingModel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.DeleteCollectionWithEmbedding(c.Request.Context(), embeddingModel); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -120,10 +162,19 @@ func (h *Handler) DeleteCollection(c *gin.Context) {
 }
 
 // SearchDocuments 搜尋相似文檔的 API
+// 可用 filter 傳入 Milvus 過濾表達式，或以 owner_id、source_file、tag、mine 組合常用的過濾條件
+// mode 為 vector（預設）、keyword 或 hybrid
 func (h *Handler) SearchDocuments(c *gin.Context) {
 	var req struct {
-		Query string `json:"query" binding:"required"`
-		TopK  int    `json:"topK"`
+		Query          string            `json:"query" binding:"required"`
+		TopK           int               `json:"topK"`
+		EmbeddingModel llm.EmbeddingType `json:"embedding_model,omitempty"`
+		Mode           string            `json:"mode,omitempty"`
+		Filter         string            `json:"filter,omitempty"`
+		OwnerID        string            `json:"owner_id,omitempty"`
+		SourceFile     string            `json:"source_file,omitempty"`
+		Tag            string            `json:"tag,omitempty"`
+		Mine           bool              `json:"mine,omitempty"` // 只搜尋登入使用者上傳的文件
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -133,15 +184,77 @@ func (h *Handler) SearchDocuments(c *gin.Context) {
 
 	// 如果沒有指定 topK，則默認為 5
 	if req.TopK <= 0 {
-		req.TopK = 5
+		req.TopK = DefaultSearchTopK
+	}
+
+	if req.EmbeddingModel == "" {
+		req.EmbeddingModel = h.service.DefaultEmbeddingType()
+	}
+
+	mode, err := ParseSearchMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters := []string{req.Filter}
+	if req.Mine {
+		userId, ok := c.Get("userId")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "mine 需要登入"})
+			return
+		}
+		filters = append(filters, milvus.EqualsFilter(milvus.FieldOwnerID, userId.(uuid.UUID).String()))
+	}
+	if req.OwnerID != "" {
+		filters = append(filters, milvus.EqualsFilter(milvus.FieldOwnerID, req.OwnerID))
+	}
+	if req.SourceFile != "" {
+		filters = append(filters, milvus.EqualsFilter(milvus.FieldSourceFile, req.SourceFile))
+	}
+	if req.Tag != "" {
+		filters = append(filters, milvus.TagFilter(req.Tag))
 	}
 
 	// 搜尋相似文檔
-	docs, err := h.service.SearchSimilarDocuments(req.Query, req.TopK)
+	docs, err := h.service.Search(c.Request.Context(), req.Query, SearchOptions{
+		TopK:          req.TopK,
+		EmbeddingType: req.EmbeddingModel,
+		Mode:          mode,
+		Filter:        milvus.AndFilters(filters...),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(SearchErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, docs)
 }
+
+// RebuildKeywordIndex 依 Milvus 的現有資料重建指定嵌入模型集合的關鍵字索引
+func (h *Handler) RebuildKeywordIndex(c *gin.Context) {
+	var req struct {
+		EmbeddingModel llm.EmbeddingType `json:"embedding_model,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求格式"})
+		return
+	}
+
+	if req.EmbeddingModel == "" {
+		req.EmbeddingModel = h.service.DefaultEmbeddingType()
+	}
+
+	indexed, err := h.service.RebuildKeywordIndex(c.Request.Context(), req.EmbeddingModel)
+	if err != nil {
+		c.JSON(SearchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "關鍵字索引重建完成",
+		"collection": CollectionNameFor(req.EmbeddingModel),
+		"indexed":    indexed,
+	})
+}
@@ -0,0 +1,169 @@
+package documents
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxTermLength 是單一詞彙的長度上限（字元），更長的字串多半是編碼內容或雜訊
+const maxTermLength = 64
+
+// KeywordEntry 是要寫入關鍵字索引的一個片段
+type KeywordEntry struct {
+	ID   string // Milvus 向量 ID
+	Text string
+}
+
+// KeywordHit 是關鍵字搜尋命中的片段與其分數，分數只用於排序
+type KeywordHit struct {
+	ID    string
+	Score float64
+}
+
+// KeywordIndex 是與 Milvus 集合並行維護的全文索引，以向量 ID 對應同一個片段
+// 索引只保存詞彙，文本與 metadata 仍以 Milvus 為準
+type KeywordIndex interface {
+	Index(ctx context.Context, collection string, entries []KeywordEntry) error
+	Delete(ctx context.Context, collection string, ids []string) error
+	DeleteCollection(ctx context.Context, collection string) error
+	Search(ctx context.Context, collection string, terms []string, limit int) ([]KeywordHit, error)
+}
+
+// SetKeywordIndex 設定關鍵字索引，未設定時只能使用向量搜尋
+func (s *Service) SetKeywordIndex(index KeywordIndex) {
+	s.keywords = index
+}
+
+// indexKeywords 將剛寫入 Milvus 的片段加入關鍵字索引
+// 失敗時只記錄錯誤：向量已寫入，片段仍可透過向量搜尋找到，可用 RebuildKeywordIndex 補齊
+func (s *Service) indexKeywords(ctx context.Context, collection string, ids []string, texts []string) {
+	if s.keywords == nil {
+		return
+	}
+
+	entries := make([]KeywordEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = KeywordEntry{ID: id, Text: texts[i]}
+	}
+	if err := s.keywords.Index(ctx, collection, entries); err != nil {
+		log.Printf("警告: 寫入集合 %s 的關鍵字索引失敗: %v", collection, err)
+	}
+}
+
+// removeKeywords 從關鍵字索引刪除已從 Milvus 刪除的片段
+// 失敗時只記錄錯誤：殘留的索引列在搜尋時會因 Milvus 查無資料而被略過
+func (s *Service) removeKeywords(ctx context.Context, collection string, ids []string) {
+	if s.keywords == nil {
+		return
+	}
+	if err := s.keywords.Delete(ctx, collection, ids); err != nil {
+		log.Printf("警告: 刪除集合 %s 的關鍵字索引失敗: %v", collection, err)
+	}
+}
+
+// KeywordTerms 將文本切成關鍵字索引的詞彙
+// 英數字以連續的字母與數字為一個詞並轉為小寫；中日韓文字沒有空白分詞，每個字與相鄰兩字（bigram）各自成為一個詞
+// 全形字元會先正規化為半形，因此「ＧＰＵ」與「gpu」視為同一個詞
+func KeywordTerms(text string) []string {
+	words, runs := splitTerms(text)
+
+	terms := newTermSet()
+	for _, word := range words {
+		terms.add(word)
+	}
+	for _, run := range runs {
+		for i := range run {
+			terms.add(string(run[i]))
+			if i+1 < len(run) {
+				terms.add(string(run[i : i+2]))
+			}
+		}
+	}
+	return terms.values
+}
+
+// queryTerms 將查詢切成搜尋用的詞彙
+// 連續的中日韓文字只取 bigram，避免「的」「是」等常見單字命中大量片段；只有單獨一個字時才以單字搜尋
+func queryTerms(query string) []string {
+	words, runs := splitTerms(query)
+
+	terms := newTermSet()
+	for _, word := range words {
+		terms.add(word)
+	}
+	for _, run := range runs {
+		if len(run) == 1 {
+			terms.add(string(run))
+			continue
+		}
+		for i := 0; i+1 < len(run); i++ {
+			terms.add(string(run[i : i+2]))
+		}
+	}
+	return terms.values
+}
+
+// splitTerms 將正規化後的文本拆成英數字詞與連續的中日韓文字
+func splitTerms(text string) ([]string, [][]rune) {
+	var words []string
+	var runs [][]rune
+	var word strings.Builder
+	var run []rune
+
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = nil
+		}
+	}
+
+	for _, r := range strings.ToLower(norm.NFKC.String(text)) {
+		switch {
+		case isCJK(r):
+			if word.Len() > 0 {
+				flush()
+			}
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(run) > 0 {
+				flush()
+			}
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return words, runs
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// termSet 依出現順序保存不重複的詞彙
+type termSet struct {
+	seen   map[string]bool
+	values []string
+}
+
+func newTermSet() *termSet {
+	return &termSet{seen: make(map[string]bool)}
+}
+
+func (t *termSet) add(term string) {
+	if term == "" || len([]rune(term)) > maxTermLength || t.seen[term] {
+		return
+	}
+	t.seen[term] = true
+	t.values = append(t.values, term)
+}
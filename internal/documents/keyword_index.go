@@ -0,0 +1,101 @@
+package documents
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresKeywordIndex 將片段的詞彙以 tsvector 保存在 document_keywords 資料表
+// 詞彙由 KeywordTerms 在應用程式中切好，直接以 array_to_tsvector 寫入，不經過 Postgres 的分詞器，
+// 因此不需要安裝中文分詞擴充套件
+type PostgresKeywordIndex struct {
+	db *sqlx.DB
+}
+
+func NewPostgresKeywordIndex(db *sqlx.DB) KeywordIndex {
+	return &PostgresKeywordIndex{
+		db: db,
+	}
+}
+
+// Index 在同一個交易中寫入所有片段，已存在的片段以新的詞彙覆寫
+func (i *PostgresKeywordIndex) Index(ctx context.Context, collection string, entries []KeywordEntry) error {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		terms := KeywordTerms(entry.Text)
+		if len(terms) == 0 {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO document_keywords (collection_name, vector_id, lexemes)
+			VALUES ($1, $2, array_to_tsvector($3))
+			ON CONFLICT (collection_name, vector_id) DO UPDATE SET lexemes = EXCLUDED.lexemes
+		`, collection, entry.ID, pq.Array(terms))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (i *PostgresKeywordIndex) Delete(ctx context.Context, collection string, ids []string) error {
+	_, err := i.db.ExecContext(ctx, `
+		DELETE FROM document_keywords
+		WHERE collection_name = $1 AND vector_id = ANY($2)
+	`, collection, pq.Array(ids))
+	return err
+}
+
+func (i *PostgresKeywordIndex) DeleteCollection(ctx context.Context, collection string) error {
+	_, err := i.db.ExecContext(ctx, `DELETE FROM document_keywords WHERE collection_name = $1`, collection)
+	return err
+}
+
+// Search 找出包含任一詞彙的片段，依 ts_rank 排序：命中越多詞彙分數越高，較長的片段會依長度降低分數
+func (i *PostgresKeywordIndex) Search(ctx context.Context, collection string, terms []string, limit int) ([]KeywordHit, error) {
+	if len(terms) == 0 {
+		return []KeywordHit{}, nil
+	}
+
+	query := `
+		SELECT vector_id, ts_rank(lexemes, query, 1) AS score
+		FROM document_keywords, CAST($2 AS tsquery) AS query
+		WHERE collection_name = $1 AND lexemes @@ query
+		ORDER BY score DESC, vector_id
+		LIMIT $3
+	`
+
+	rows := []struct {
+		ID    string  `db:"vector_id"`
+		Score float64 `db:"score"`
+	}{}
+	if err := i.db.SelectContext(ctx, &rows, query, collection, orQuery(terms), limit); err != nil {
+		return nil, err
+	}
+
+	hits := make([]KeywordHit, len(rows))
+	for idx, row := range rows {
+		hits[idx] = KeywordHit{ID: row.ID, Score: row.Score}
+	}
+	return hits, nil
+}
+
+// orQuery 將詞彙組成 'a' | 'b' 形式的 tsquery 常值，以引號包住的詞彙不會再被正規化
+func orQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	escaper := strings.NewReplacer(`\`, `\\`, `'`, `''`)
+	for i, term := range terms {
+		quoted[i] = "'" + escaper.Replace(term) + "'"
+	}
+	return strings.Join(quoted, " | ")
+}
@@ -0,0 +1,266 @@
+package documents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+)
+
+// SearchMode 是檢索文檔的方式
+type SearchMode string
+
+const (
+	SearchModeVector  SearchMode = "vector"  // 以嵌入向量搜尋語意相近的片段
+	SearchModeKeyword SearchMode = "keyword" // 以關鍵字索引搜尋包含查詢詞彙的片段，不需要嵌入提供者
+	SearchModeHybrid  SearchMode = "hybrid"  // 兩者各自搜尋後以 reciprocal rank fusion 合併
+)
+
+const (
+	DefaultSearchTopK = 5
+
+	// rrfK 是 reciprocal rank fusion 的平滑常數，分數為各結果列表中 1/(rrfK+名次) 的總和
+	rrfK = 60
+
+	// 混合搜尋時兩種搜尋各取回 topK 的幾倍候選再合併，至少 minHybridCandidates 筆
+	hybridCandidateFactor = 4
+	minHybridCandidates   = 20
+
+	// 關鍵字命中的片段需再以 Milvus 套用過濾條件，因此多取一些候選
+	keywordCandidateFactor = 5
+
+	// 重建關鍵字索引時每次從 Milvus 讀取的筆數
+	rebuildPageSize = 1000
+)
+
+var (
+	// ErrInvalidSearchMode 表示請求的搜尋模式不存在
+	ErrInvalidSearchMode = errors.New("無效的搜尋模式")
+	// ErrKeywordIndexUnavailable 表示未設定關鍵字索引，只能使用向量搜尋
+	ErrKeywordIndexUnavailable = errors.New("未設定關鍵字索引")
+)
+
+// ParseSearchMode 解析請求中的搜尋模式，空字串為 vector
+func ParseSearchMode(value string) (SearchMode, error) {
+	switch mode := SearchMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return SearchModeVector, nil
+	case SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %s，可用 vector、keyword 或 hybrid", ErrInvalidSearchMode, value)
+}
+
+// SearchOptions 是搜尋文檔的設定
+type SearchOptions struct {
+	TopK          int               // 返回的文檔數量，預設 DefaultSearchTopK
+	EmbeddingType llm.EmbeddingType // 決定搜尋的集合與查詢向量的嵌入模型
+	Mode          SearchMode        // 空字串為 vector
+	Filter        string            // 純量過濾表達式，三種模式都會套用
+}
+
+// Search 依搜尋模式檢索文檔
+// vector 模式的分數為向量相似度，keyword 模式為關鍵字排名分數，hybrid 模式為 RRF 分數並附上兩者各自的分數
+func (s *Service) Search(ctx context.Context, query string, opts SearchOptions) ([]Document, error) {
+	if opts.TopK <= 0 {
+		opts.TopK = DefaultSearchTopK
+	}
+
+	switch opts.Mode {
+	case "", SearchModeVector:
+		return s.SearchSimilarDocumentsWithFilter(ctx, query, opts.TopK, opts.EmbeddingType, opts.Filter)
+	case SearchModeKeyword:
+		return s.searchKeywords(ctx, query, opts.TopK, opts.EmbeddingType, opts.Filter)
+	case SearchModeHybrid:
+		return s.searchHybrid(ctx, query, opts.TopK, opts.EmbeddingType, opts.Filter)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrInvalidSearchMode, opts.Mode)
+}
+
+// searchKeywords 以關鍵字索引找出候選片段，再從 Milvus 讀取內容並套用過濾條件
+// 索引中殘留但已從 Milvus 刪除的片段會在這一步被略過
+func (s *Service) searchKeywords(ctx context.Context, query string, topK int, embeddingType llm.EmbeddingType, filter string) ([]Document, error) {
+	if s.keywords == nil {
+		return nil, ErrKeywordIndexUnavailable
+	}
+
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return []Document{}, nil
+	}
+
+	collectionName := getCollectionName(embeddingType)
+	hits, err := s.keywords.Search(ctx, collectionName, terms, topK*keywordCandidateFactor)
+	if err != nil {
+		return nil, fmt.Errorf("關鍵字搜尋失敗: %v", err)
+	}
+	if len(hits) == 0 {
+		return []Document{}, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	rows, err := s.milvusClient.ListVectors(ctx, collectionName, milvus.QueryOptions{
+		Filter: milvus.AndFilters(milvus.IDsFilter(ids), filter),
+		Limit:  len(ids),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("讀取關鍵字搜尋結果失敗: %v", err)
+	}
+
+	byID := make(map[string]Document, len(rows))
+	for _, row := range rows {
+		if doc, ok := documentFromRow(row); ok {
+			byID[doc.ID] = doc
+		}
+	}
+
+	// 依關鍵字排名返回
+	documents := make([]Document, 0, topK)
+	for _, hit := range hits {
+		doc, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		doc.Score = hit.Score
+		documents = append(documents, doc)
+		if len(documents) == topK {
+			break
+		}
+	}
+	return documents, nil
+}
+
+// searchHybrid 分別進行向量與關鍵字搜尋，再以 reciprocal rank fusion 合併排名
+func (s *Service) searchHybrid(ctx context.Context, query string, topK int, embeddingType llm.EmbeddingType, filter string) ([]Document, error) {
+	if s.keywords == nil {
+		return nil, ErrKeywordIndexUnavailable
+	}
+
+	candidates := max(topK*hybridCandidateFactor, minHybridCandidates)
+
+	vectorDocs, err := s.SearchSimilarDocumentsWithFilter(ctx, query, candidates, embeddingType, filter)
+	if err != nil {
+		return nil, err
+	}
+	keywordDocs, err := s.searchKeywords(ctx, query, candidates, embeddingType, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return fuseRRF(vectorDocs, keywordDocs, topK), nil
+}
+
+// fuseRRF 以 reciprocal rank fusion 合併兩個排名列表，只依名次計分，因此不需要校正兩種分數的尺度
+func fuseRRF(vectorDocs []Document, keywordDocs []Document, topK int) []Document {
+	fused := make(map[string]*Document)
+	var order []string
+
+	add := func(docs []Document, keepScore func(doc *Document, score float64)) {
+		for rank, doc := range docs {
+			entry, ok := fused[doc.ID]
+			if !ok {
+				copied := doc
+				copied.Score = 0
+				entry = &copied
+				fused[doc.ID] = entry
+				order = append(order, doc.ID)
+			}
+			entry.Score += 1 / float64(rrfK+rank+1)
+			keepScore(entry, doc.Score)
+		}
+	}
+	add(vectorDocs, func(doc *Document, score float64) { doc.VectorScore = score })
+	add(keywordDocs, func(doc *Document, score float64) { doc.KeywordScore = score })
+
+	documents := make([]Document, len(order))
+	for i, id := range order {
+		documents[i] = *fused[id]
+	}
+	// 同分時保留向量搜尋的順序
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Score > documents[j].Score
+	})
+
+	if len(documents) > topK {
+		documents = documents[:topK]
+	}
+	return documents
+}
+
+// RebuildKeywordIndex 依 Milvus 集合的現有資料重建關鍵字索引，返回索引的片段數量
+// 用於補齊啟用關鍵字索引前寫入的資料，或修復寫入索引失敗的片段
+func (s *Service) RebuildKeywordIndex(ctx context.Context, embeddingType llm.EmbeddingType) (int, error) {
+	if s.keywords == nil {
+		return 0, ErrKeywordIndexUnavailable
+	}
+
+	collectionName := getCollectionName(embeddingType)
+	if err := s.keywords.DeleteCollection(ctx, collectionName); err != nil {
+		return 0, fmt.Errorf("清除關鍵字索引失敗: %v", err)
+	}
+
+	exists, err := s.milvusClient.CollectionExists(ctx, collectionName)
+	if err != nil {
+		return 0, fmt.Errorf("檢查集合存在失敗: %v", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	// 以主鍵 cursor 分頁讀取整個集合，每頁以最後一筆的主鍵作為下一頁的起點
+	indexed := 0
+	filter := "id > 0"
+	for {
+		rows, err := s.milvusClient.ListVectors(ctx, collectionName, milvus.QueryOptions{
+			Filter: filter,
+			Limit:  rebuildPageSize,
+		})
+		if err != nil {
+			return indexed, fmt.Errorf("讀取集合 %s 失敗: %v", collectionName, err)
+		}
+		if len(rows) == 0 {
+			return indexed, nil
+		}
+
+		entries := make([]KeywordEntry, 0, len(rows))
+		for _, row := range rows {
+			if doc, ok := documentFromRow(row); ok {
+				entries = append(entries, KeywordEntry{ID: doc.ID, Text: doc.Text})
+			}
+		}
+		if err := s.keywords.Index(ctx, collectionName, entries); err != nil {
+			return indexed, fmt.Errorf("寫入關鍵字索引失敗: %v", err)
+		}
+		indexed += len(entries)
+
+		if len(rows) < rebuildPageSize {
+			return indexed, nil
+		}
+		cursor, ok := lastRowID(rows)
+		if !ok {
+			return indexed, fmt.Errorf("集合 %s 的查詢結果沒有可用的主鍵", collectionName)
+		}
+		filter = fmt.Sprintf("%s > %d", milvus.FieldID, cursor)
+	}
+}
+
+// SearchErrorStatus 返回搜尋錯誤對應的 HTTP 狀態碼：無效的模式為 400，集合需要重建為 409，未設定關鍵字索引為 503，其餘依 llm.HTTPStatus
+func SearchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidSearchMode):
+		return http.StatusBadRequest
+	case errors.Is(err, milvus.ErrOutdatedSchema):
+		return http.StatusConflict
+	case errors.Is(err, ErrKeywordIndexUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return llm.HTTPStatus(err)
+}
@@ -0,0 +1,190 @@
+package documents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ai-workshop/internal/config"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+)
+
+// recordingKeywordIndex 記錄寫入的片段 ID，供測試檢查重建結果
+type recordingKeywordIndex struct {
+	indexed map[string]int
+}
+
+func (r *recordingKeywordIndex) Index(ctx context.Context, collection string, entries []KeywordEntry) error {
+	for _, entry := range entries {
+		r.indexed[entry.ID]++
+	}
+	return nil
+}
+
+func (r *recordingKeywordIndex) Delete(ctx context.Context, collection string, ids []string) error {
+	return nil
+}
+
+func (r *recordingKeywordIndex) DeleteCollection(ctx context.Context, collection string) error {
+	r.indexed = make(map[string]int)
+	return nil
+}
+
+func (r *recordingKeywordIndex) Search(ctx context.Context, collection string, terms []string, limit int) ([]KeywordHit, error) {
+	return nil, nil
+}
+
+// TestRebuildKeywordIndexPages 確認重建時以上一頁最後一筆的主鍵翻頁，跨頁的每個片段都只被索引一次
+func TestRebuildKeywordIndexPages(t *testing.T) {
+	const base = int64(449884541286735873)
+	const total = rebuildPageSize*2 + 500
+
+	var filters []string
+	ids := make([]int64, total)
+	for i := range ids {
+		ids[i] = base + int64(i)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/vector/collections":
+			w.Write([]byte(`{"code": 200, "data": ["documents_fake"]}`))
+		case "/v2/vectordb/entities/query":
+			var req struct {
+				Filter string `json:"filter"`
+				Limit  int    `json:"limit"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("解析查詢請求失敗: %v", err)
+			}
+			filters = append(filters, req.Filter)
+			cursor, err := strconv.ParseInt(strings.TrimPrefix(req.Filter, "id > "), 10, 64)
+			if err != nil {
+				t.Errorf("無法解析過濾條件 %q", req.Filter)
+			}
+
+			var page []int64
+			for _, id := range ids {
+				if id > cursor && len(page) < req.Limit {
+					page = append(page, id)
+				}
+			}
+			// 與 Milvus 相同，返回符合條件中主鍵最小的 limit 筆，依主鍵遞增排序
+
+			rows := make([]string, len(page))
+			for i, id := range page {
+				rows[i] = fmt.Sprintf(`{"id": %d, "text": "片段 %d"}`, id, id)
+			}
+			w.Write([]byte(`{"code": 0, "data": [` + strings.Join(rows, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := llm.NewFactory(&config.Config{FakeLLMEnabled: true, FakeLLMEmbeddingDimension: 8})
+	service := NewService(milvus.NewClient(&milvus.ClientConfig{Host: host, Port: port}), factory)
+	keywords := &recordingKeywordIndex{indexed: make(map[string]int)}
+	service.SetKeywordIndex(keywords)
+
+	indexed, err := service.RebuildKeywordIndex(context.Background(), llm.EmbeddingTypeFake)
+	if err != nil {
+		t.Fatalf("重建關鍵字索引失敗: %v", err)
+	}
+	if indexed != total {
+		t.Errorf("索引了 %d 個片段，預期 %d 個", indexed, total)
+	}
+	wantFilters := []string{
+		"id > 0",
+		fmt.Sprintf("id > %d", ids[rebuildPageSize-1]),
+		fmt.Sprintf("id > %d", ids[2*rebuildPageSize-1]),
+	}
+	if strings.Join(filters, "; ") != strings.Join(wantFilters, "; ") {
+		t.Errorf("查詢條件為 %v，預期 %v", filters, wantFilters)
+	}
+	for _, id := range ids {
+		if count := keywords.indexed[strconv.FormatInt(id, 10)]; count != 1 {
+			t.Errorf("片段 %d 被索引 %d 次，預期 1 次", id, count)
+			break
+		}
+	}
+}
+
+// TestOutdatedCollectionSchema 確認舊版結構的集合在搜尋時返回 409，新版結構只向 Milvus 確認一次
+func TestOutdatedCollectionSchema(t *testing.T) {
+	tests := []struct {
+		name          string
+		fields        string
+		metricType    string
+		wantStatus    int
+		wantDescribes int
+	}{
+		{"舊版三欄位結構", `{"name": "id"}, {"name": "vector"}, {"name": "text"}`, "L2", http.StatusConflict, 2},
+		{"新版結構", `{"name": "id"}, {"name": "vector"}, {"name": "text"}, {"name": "source_file"}, {"name": "chunk_index"},
+			{"name": "offset"}, {"name": "owner_id"}, {"name": "created_at"}, {"name": "metadata"}`, "COSINE", http.StatusOK, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			describes := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/v1/vector/collections":
+					w.Write([]byte(`{"code": 200, "data": ["documents_fake"]}`))
+				case "/v2/vectordb/collections/describe":
+					describes++
+					fmt.Fprintf(w, `{"code": 0, "data": {"fields": [%s], "indexes": [{"fieldName": "vector", "metricType": %q}]}}`, tt.fields, tt.metricType)
+				case "/v1/vector/search":
+					w.Write([]byte(`{"code": 200, "data": [{"id": 1, "text": "三月用電量", "distance": 0.9}]}`))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			serverURL, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			host, port, err := net.SplitHostPort(serverURL.Host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			factory := llm.NewFactory(&config.Config{FakeLLMEnabled: true, FakeLLMEmbeddingDimension: 8})
+			service := NewService(milvus.NewClient(&milvus.ClientConfig{Host: host, Port: port}), factory)
+
+			for i := 0; i < 2; i++ {
+				_, err := service.Search(context.Background(), "三月用電量", SearchOptions{TopK: 1, EmbeddingType: llm.EmbeddingTypeFake})
+				status := http.StatusOK
+				if err != nil {
+					status = SearchErrorStatus(err)
+				}
+				if status != tt.wantStatus {
+					t.Errorf("第 %d 次搜尋的狀態碼為 %d，預期 %d（錯誤: %v）", i+1, status, tt.wantStatus, err)
+				}
+			}
+			if describes != tt.wantDescribes {
+				t.Errorf("查詢集合結構 %d 次，預期 %d 次", describes, tt.wantDescribes)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package documents
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"time"
+	"strconv"
+	"sync"
 
-	"ai-workshop/internal/config"
+	"ai-workshop/internal/chunking"
 	"ai-workshop/internal/llm"
 	"ai-workshop/internal/milvus"
 
@@ -21,266 +24,361 @@ type Document struct {
 	Text   string    `json:"text"`
 	Vector []float32 `json:"vector,omitempty"`
 	Score  float64   `json:"score,omitempty"`
+
+	// 混合搜尋時分別保留向量相似度與關鍵字分數，Score 則為合併後的 RRF 分數
+	VectorScore  float64 `json:"vector_score,omitempty"`
+	KeywordScore float64 `json:"keyword_score,omitempty"`
+	RerankScore  float64 `json:"rerank_score,omitempty"` // 重排器給出的分數，只有經過重排的結果才有
+
+	// 來源資訊，僅由檔案匯入的文檔才會有
+	SourceFile string `json:"source_file,omitempty"` // 來源檔案名稱
+	ChunkIndex int    `json:"chunk_index,omitempty"` // 片段在來源檔案中的序號
+	Offset     int    `json:"offset,omitempty"`      // 文本在來源檔案中的起始字元位置
+
+	OwnerID   string                 `json:"owner_id,omitempty"`   // 上傳者的使用者 ID
+	CreatedAt int64                  `json:"created_at,omitempty"` // 寫入時間（Unix 秒）
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`   // 頁碼、標題、標籤等結構資訊
 }
 
 type Service struct {
-	milvusClient    *milvus.Client
-	embeddingClient *llm.OpenAIProvider
+	milvusClient *milvus.Client
+	llmFactory   *llm.Factory
+	keywords     KeywordIndex // 可為 nil，此時只能使用向量搜尋
+
+	// 已確認結構為新版的集合名稱，每個集合只向 Milvus 查詢一次
+	checkedCollections sync.Map
 }
 
-// NewService 創建文件服務
-func NewService(appConfig *config.Config) *Service {
-	config := &milvus.ClientConfig{
-		BaseURL: "http://localhost:19530",
-		Timeout: 10 * time.Second,
-	}
+// NewService 創建文件服務，milvusClient 由外部注入，整個應用程式共用同一個連線
+// 嵌入向量依 EmbeddingType 向 llmFactory 取得對應的提供者（OpenAI 或 Gemini）
+func NewService(milvusClient *milvus.Client, llmFactory *llm.Factory) *Service {
 	return &Service{
-		milvusClient:    milvus.NewClient(config),
-		embeddingClient: llm.NewOpenAiProvider(appConfig.OpenAiAPIKey),
+		milvusClient: milvusClient,
+		llmFactory:   llmFactory,
 	}
 }
 
+// embedder 取得指定嵌入類型的提供者
+func (s *Service) embedder(embeddingType llm.EmbeddingType) (llm.EmbeddingProvider, error) {
+	embedder, err := s.llmFactory.EmbeddingProviderFor(embeddingType)
+	if err != nil {
+		return nil, fmt.Errorf("取得嵌入提供者失敗: %w", err)
+	}
+	return embedder, nil
+}
+
+// DefaultEmbeddingType 回傳未指定嵌入模型時使用的嵌入模型（DEFAULT_EMBEDDING_MODEL）
+func (s *Service) DefaultEmbeddingType() llm.EmbeddingType {
+	return s.llmFactory.DefaultEmbedding()
+}
+
 // ListCollections 列出所有集合
-func (s *Service) ListCollections() ([]string, error) {
-	return s.milvusClient.ListCollections()
+func (s *Service) ListCollections(ctx context.Context) ([]string, error) {
+	return s.milvusClient.ListCollections(ctx)
 }
 
-// CreateDocumentCollection 創建文件集合
-func (s *Service) CreateDocumentCollection() error {
-	// 獲取默認嵌入維度
-	dimension, err := s.embeddingClient.GetDimensionFor(llm.EmbeddingTypeOpenAI)
+// CreateDocumentCollection 創建文件集合（默認嵌入模型的集合）
+func (s *Service) CreateDocumentCollection(ctx context.Context) error {
+	model, err := llm.LookupEmbeddingModel(s.DefaultEmbeddingType())
 	if err != nil {
-		dimension = llm.OpenAIModelDimension // 使用默認值
+		return err
 	}
 
-	err = s.milvusClient.CreateCollection(CollectionName, dimension)
-	if err != nil {
+	if err := s.milvusClient.CreateCollection(ctx, model.Collection, model.Dimension); err != nil {
 		return fmt.Errorf("創建集合失敗: %v", err)
 	}
 	return nil
 }
 
 // InsertDocument 插入單個文件（使用默認嵌入提供者）
-func (s *Service) InsertDocument(text string) (string, error) {
+func (s *Service) InsertDocument(ctx context.Context, text string) (string, error) {
 	// 使用 UUID 生成唯一 ID
 	id := uuid.New().String()
-	return id, s.InsertDocumentWithID(id, text, llm.EmbeddingTypeOpenAI)
+	return id, s.InsertDocumentWithID(ctx, id, text, s.DefaultEmbeddingType())
 }
 
 // InsertDocumentWithID 使用指定 ID 插入單個文件（內部使用）
-func (s *Service) InsertDocumentWithID(id string, text string, embeddingType llm.EmbeddingType) error {
-	// 1. 生成文本的嵌入向量
-	vector, err := s.embeddingClient.CreateEmbeddingWith(embeddingType, text)
-	if err != nil {
-		return fmt.Errorf("生成嵌入向量失敗: %v", err)
-	}
-
-	// 確保集合存在
-	dimension, err := s.embeddingClient.GetDimensionFor(embeddingType)
-	if err != nil {
-		return fmt.Errorf("獲取嵌入維度失敗: %v", err)
-	}
-
-	err = s.ensureCollectionWithDimension(dimension, embeddingType)
+// 較長的文本會依預設設定切塊，每個片段各自成為一筆向量，並以文件 ID 作為來源識別
+func (s *Service) InsertDocumentWithID(ctx context.Context, id string, text string, embeddingType llm.EmbeddingType) error {
+	textChunks, err := chunking.Split(text, chunking.DefaultOptions())
 	if err != nil {
-		return fmt.Errorf("確保集合存在失敗: %v", err)
+		return fmt.Errorf("文本切塊失敗: %v", err)
 	}
 
-	// 2. 插入到 Milvus
-	vectors := []map[string]interface{}{
-		{
-			"vector": vector,
-			"text":   text,
-		},
+	chunks := make([]Chunk, len(textChunks))
+	for i, c := range textChunks {
+		chunks[i] = Chunk{
+			Text:       c.Text,
+			SourceFile: id,
+			ChunkIndex: c.Index,
+			Offset:     c.Offset,
+		}
 	}
 
-	collectionName := getCollectionName(embeddingType)
-	if err := s.milvusClient.InsertVectors(collectionName, vectors); err != nil {
-		return fmt.Errorf("插入向量失敗: %v", err)
+	if _, err := s.InsertChunksWithEmbedding(ctx, chunks, embeddingType); err != nil {
+		return err
 	}
 
-	fmt.Printf("成功插入文件到集合 %s，文本: %s\n", collectionName, text)
+	log.Printf("成功插入文件 %s 到集合 %s，共 %d 個片段", id, getCollectionName(embeddingType), len(chunks))
 	return nil
 }
 
 // InsertBatchDocuments 批量插入文件（使用默認嵌入提供者）
-func (s *Service) InsertBatchDocuments(documents []Document) error {
-	return s.InsertBatchDocumentsWithEmbedding(documents, llm.EmbeddingTypeOpenAI)
+func (s *Service) InsertBatchDocuments(ctx context.Context, documents []Document) error {
+	return s.InsertBatchDocumentsWithEmbedding(ctx, documents, s.DefaultEmbeddingType())
 }
 
 // InsertBatchDocumentsWithEmbedding 使用指定嵌入提供者批量插入文件
-func (s *Service) InsertBatchDocumentsWithEmbedding(documents []Document, embeddingType llm.EmbeddingType) error {
+func (s *Service) InsertBatchDocumentsWithEmbedding(ctx context.Context, documents []Document, embeddingType llm.EmbeddingType) error {
 	texts := make([]string, len(documents))
 	for i, doc := range documents {
 		texts[i] = doc.Text
 	}
 
+	embedder, err := s.embedder(embeddingType)
+	if err != nil {
+		return err
+	}
+
 	// 批量生成嵌入向量
-	vectors, err := s.embeddingClient.CreateBatchEmbeddingsWith(embeddingType, texts)
+	vectors, err := embedder.CreateBatchEmbeddingsWith(ctx, embeddingType, texts)
 	if err != nil {
-		return fmt.Errorf("批量生成嵌入向量失敗: %v", err)
+		return fmt.Errorf("批量生成嵌入向量失敗: %w", err)
 	}
 
 	// 確保集合存在
-	dimension, err := s.embeddingClient.GetDimensionFor(embeddingType)
+	dimension, err := embedder.GetDimensionFor(embeddingType)
 	if err != nil {
 		return fmt.Errorf("獲取嵌入維度失敗: %v", err)
 	}
 
-	err = s.ensureCollectionWithDimension(dimension, embeddingType)
+	err = s.ensureCollectionWithDimension(ctx, dimension, embeddingType)
 	if err != nil {
-		return fmt.Errorf("確保集合存在失敗: %v", err)
+		return fmt.Errorf("確保集合存在失敗: %w", err)
 	}
 
 	// 準備插入數據
 	insertData := make([]map[string]interface{}, len(documents))
 	for i, doc := range documents {
-		insertData[i] = map[string]interface{}{
-			"vector": vectors[i],
-			"text":   doc.Text,
-		}
+		insertData[i] = newRow(Chunk{
+			Text:       doc.Text,
+			SourceFile: doc.SourceFile,
+			ChunkIndex: doc.ChunkIndex,
+			Offset:     doc.Offset,
+			OwnerID:    doc.OwnerID,
+			Metadata:   doc.Metadata,
+		}, vectors[i])
 	}
 
 	collectionName := getCollectionName(embeddingType)
-	err = s.milvusClient.InsertVectors(collectionName, insertData)
+	ids, err := s.milvusClient.InsertVectors(ctx, collectionName, insertData)
 	if err != nil {
 		return fmt.Errorf("批量插入向量失敗: %v", err)
 	}
+	if len(ids) == len(texts) {
+		s.indexKeywords(ctx, collectionName, ids, texts)
+	}
 	return nil
 }
 
-// ListVectors 列出所有文件（使用默認嵌入提供者）
-func (s *Service) ListVectors() ([]Document, error) {
-	return s.ListVectorsWithEmbedding(llm.EmbeddingTypeOpenAI)
+// ListOptions 是列出文件的分頁與過濾設定
+type ListOptions struct {
+	Limit       int    // 每頁筆數，預設 DefaultListLimit
+	Offset      int    // 略過的筆數，設定 Cursor 時忽略
+	Cursor      string // 上一頁返回的 NextCursor，適合翻閱超過 milvus.MaxQueryWindow 筆的集合
+	Contains    string // 只列出 text 包含此字串的文件
+	Filter      string // 額外的純量過濾表達式
+	WithVectors bool   // 是否返回向量
+}
+
+// ListResult 是一頁文件列表
+type ListResult struct {
+	Documents  []Document `json:"documents"`
+	Total      int        `json:"total"` // 符合過濾條件的文件總數
+	Offset     int        `json:"offset"`
+	Limit      int        `json:"limit"`
+	NextCursor string     `json:"next_cursor,omitempty"` // 還有下一頁時為本頁最後一筆（也是最大）的 ID
 }
 
-// ListVectorsWithEmbedding 使用指定嵌入提供者列出所有文件
-func (s *Service) ListVectorsWithEmbedding(embeddingType llm.EmbeddingType) ([]Document, error) {
+// ErrInvalidCursor 表示分頁 cursor 不是有效的文件 ID
+var ErrInvalidCursor = errors.New("無效的 cursor")
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 1000
+)
+
+// ListVectors 分頁列出文件（使用默認嵌入提供者）
+func (s *Service) ListVectors(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	return s.ListVectorsWithEmbedding(ctx, s.DefaultEmbeddingType(), opts)
+}
+
+// ListVectorsWithEmbedding 使用指定嵌入提供者分頁列出文件
+func (s *Service) ListVectorsWithEmbedding(ctx context.Context, embeddingType llm.EmbeddingType, opts ListOptions) (*ListResult, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	filter := opts.Filter
+	if opts.Contains != "" {
+		filter = milvus.AndFilters(filter, milvus.ContainsFilter(milvus.FieldText, opts.Contains))
+	}
+
+	// cursor 分頁以主鍵大於上一頁最後一筆作為條件
+	pageFilter := filter
+	if opts.Cursor != "" {
+		cursor, err := strconv.ParseInt(opts.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, opts.Cursor)
+		}
+		pageFilter = milvus.AndFilters(filter, fmt.Sprintf("%s > %d", milvus.FieldID, cursor))
+		opts.Offset = 0
+	}
+
 	collectionName := getCollectionName(embeddingType)
-	vectors, err := s.milvusClient.ListVectors(collectionName)
-	log.Printf("ListVectors vectors: %v", vectors)
-	log.Printf("ListVectors CollectionName: %v", collectionName)
+	rows, err := s.milvusClient.ListVectors(ctx, collectionName, milvus.QueryOptions{
+		Filter:      pageFilter,
+		Limit:       opts.Limit,
+		Offset:      opts.Offset,
+		WithVectors: opts.WithVectors,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("獲取向量列表失敗: %v", err)
 	}
 
-	documents := make([]Document, 0, len(vectors))
-	for _, v := range vectors {
-		// 將所有類型的 ID 轉換為字符串
-		var idStr string
-		switch idVal := v["id"].(type) {
-		case int64:
-			idStr = fmt.Sprintf("%d", idVal)
-		case int:
-			idStr = fmt.Sprintf("%d", idVal)
-		case float64:
-			idStr = fmt.Sprintf("%d", int64(idVal))
-		case float32:
-			idStr = fmt.Sprintf("%d", int64(idVal))
-		case string:
-			idStr = idVal
-		default:
-			log.Printf("警告: 無法處理 ID 類型 %T: %v", v["id"], v["id"])
-			continue
-		}
+	countFilter := filter
+	if countFilter == "" {
+		countFilter = "id > 0"
+	}
+	total, err := s.milvusClient.CountVectors(ctx, collectionName, countFilter)
+	if err != nil {
+		return nil, fmt.Errorf("計算文件數量失敗: %v", err)
+	}
 
-		// 處理 text 欄位
-		var text string
-		if textVal, ok := v["text"].(string); ok {
-			text = textVal
-		} else {
-			log.Printf("警告: 無法處理 text 類型 %T: %v", v["text"], v["text"])
+	documents := make([]Document, 0, len(rows))
+	for _, row := range rows {
+		doc, ok := documentFromRow(row)
+		if !ok {
+			log.Printf("警告: 無法處理 text 類型 %T: %v", row["text"], row["text"])
 			continue
 		}
-
-		// 創建文檔對象
-		doc := Document{
-			ID:   idStr,
-			Text: text,
-		}
-		log.Printf("處理文檔 - 原始ID: %v, 轉換後ID: %s", v["id"], idStr)
 		documents = append(documents, doc)
 	}
 
-	log.Printf("ListVectors 處理完成，共 %d 個文檔", len(documents))
-	return documents, nil
+	result := &ListResult{
+		Documents: documents,
+		Total:     total,
+		Offset:    opts.Offset,
+		Limit:     opts.Limit,
+	}
+	if len(rows) == opts.Limit {
+		if cursor, ok := lastRowID(rows); ok {
+			result.NextCursor = strconv.FormatInt(cursor, 10)
+		}
+	}
+	return result, nil
 }
 
 // DeleteDocument 刪除文件（使用默認嵌入提供者）
-func (s *Service) DeleteDocument(id string) error {
-	return s.DeleteDocumentWithEmbedding(id, llm.EmbeddingTypeOpenAI)
+func (s *Service) DeleteDocument(ctx context.Context, id string) error {
+	return s.DeleteDocumentWithEmbedding(ctx, id, s.DefaultEmbeddingType())
 }
 
 // DeleteDocumentWithEmbedding 使用指定嵌入提供者刪除文件
-func (s *Service) DeleteDocumentWithEmbedding(id string, embeddingType llm.EmbeddingType) error {
+func (s *Service) DeleteDocumentWithEmbedding(ctx context.Context, id string, embeddingType llm.EmbeddingType) error {
 	ids := []string{id}
 	collectionName := getCollectionName(embeddingType)
-	err := s.milvusClient.DeleteVectors(collectionName, ids)
+	err := s.milvusClient.DeleteVectors(ctx, collectionName, ids)
 	if err != nil {
 		return fmt.Errorf("刪除文件失敗: %v", err)
 	}
+	s.removeKeywords(ctx, collectionName, ids)
 	return nil
 }
 
 // DeleteDocuments 批量刪除文件（使用默認嵌入提供者）
-func (s *Service) DeleteDocuments(ids []string) error {
-	return s.DeleteDocumentsWithEmbedding(ids, llm.EmbeddingTypeOpenAI)
+func (s *Service) DeleteDocuments(ctx context.Context, ids []string) error {
+	return s.DeleteDocumentsWithEmbedding(ctx, ids, s.DefaultEmbeddingType())
 }
 
 // DeleteDocumentsWithEmbedding 使用指定嵌入提供者批量刪除文件
-func (s *Service) DeleteDocumentsWithEmbedding(ids []string, embeddingType llm.EmbeddingType) error {
+func (s *Service) DeleteDocumentsWithEmbedding(ctx context.Context, ids []string, embeddingType llm.EmbeddingType) error {
 	collectionName := getCollectionName(embeddingType)
-	err := s.milvusClient.DeleteVectors(collectionName, ids)
+	err := s.milvusClient.DeleteVectors(ctx, collectionName, ids)
 	if err != nil {
 		return fmt.Errorf("批量刪除文件失敗: %v", err)
 	}
+	s.removeKeywords(ctx, collectionName, ids)
 	return nil
 }
 
 // DeleteCollection 刪除整個文件集合（使用默認嵌入提供者）
-func (s *Service) DeleteCollection() error {
-	return s.DeleteCollectionWithEmbedding(llm.EmbeddingTypeOpenAI)
+func (s *Service) DeleteCollection(ctx context.Context) error {
+	return s.DeleteCollectionWithEmbedding(ctx, s.DefaultEmbeddingType())
 }
 
-// DeleteCollectionWithEmbedding 使用指定嵌入提供者刪除整個文件集合
-func (s *Service) DeleteCollectionWithEmbedding(embeddingType llm.EmbeddingType) error {
+// DeleteCollectionWithEmbedding 使用指定嵌入提供者刪除整個文件集合，同時清除其關鍵字索引
+func (s *Service) DeleteCollectionWithEmbedding(ctx context.Context, embeddingType llm.EmbeddingType) error {
 	collectionName := getCollectionName(embeddingType)
-	err := s.milvusClient.DeleteCollection(collectionName)
+	err := s.milvusClient.DeleteCollection(ctx, collectionName)
 	if err != nil {
 		return fmt.Errorf("刪除集合失敗: %v", err)
 	}
+	s.checkedCollections.Delete(collectionName)
+	if s.keywords != nil {
+		if err := s.keywords.DeleteCollection(ctx, collectionName); err != nil {
+			log.Printf("警告: 清除集合 %s 的關鍵字索引失敗: %v", collectionName, err)
+		}
+	}
 	return nil
 }
 
 // SearchSimilarDocuments 搜尋相似文檔（使用默認嵌入提供者）
-func (s *Service) SearchSimilarDocuments(query string, topK int) ([]Document, error) {
+func (s *Service) SearchSimilarDocuments(ctx context.Context, query string, topK int) ([]Document, error) {
 	// 使用默認嵌入提供者
-	return s.SearchSimilarDocumentsWithEmbedding(query, topK, llm.EmbeddingTypeOpenAI)
+	return s.SearchSimilarDocumentsWithEmbedding(ctx, query, topK, s.DefaultEmbeddingType())
 }
 
 // SearchSimilarDocumentsWithEmbedding 使用指定嵌入提供者搜尋相似文檔
-func (s *Service) SearchSimilarDocumentsWithEmbedding(query string, topK int, embeddingType llm.EmbeddingType) ([]Document, error) {
+func (s *Service) SearchSimilarDocumentsWithEmbedding(ctx context.Context, query string, topK int, embeddingType llm.EmbeddingType) ([]Document, error) {
+	return s.SearchSimilarDocumentsWithFilter(ctx, query, topK, embeddingType, "")
+}
+
+// SearchSimilarDocumentsWithFilter 使用指定嵌入提供者搜尋相似文檔，並以純量過濾表達式限定範圍
+// 例如 owner_id == "..." 只搜尋某位使用者的文件，json_contains(metadata["tags"], "energy") 只搜尋帶有標籤的檔案
+func (s *Service) SearchSimilarDocumentsWithFilter(ctx context.Context, query string, topK int, embeddingType llm.EmbeddingType, filter string) ([]Document, error) {
+	embedder, err := s.embedder(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
 	// 1. 生成查詢文本的嵌入向量
-	queryVector, err := s.embeddingClient.CreateEmbeddingWith(embeddingType, query)
+	queryVector, err := embedder.CreateEmbeddingWith(ctx, embeddingType, query)
 	if err != nil {
-		return nil, fmt.Errorf("生成查詢嵌入向量失敗: %v", err)
+		return nil, fmt.Errorf("生成查詢嵌入向量失敗: %w", err)
 	}
 
 	// 獲取嵌入維度
-	dimension, err := s.embeddingClient.GetDimensionFor(embeddingType)
+	dimension, err := embedder.GetDimensionFor(embeddingType)
 	if err != nil {
 		return nil, fmt.Errorf("獲取嵌入維度失敗: %v", err)
 	}
 
 	// 確保集合存在並具有正確的維度
-	err = s.ensureCollectionWithDimension(dimension, embeddingType)
+	err = s.ensureCollectionWithDimension(ctx, dimension, embeddingType)
 	if err != nil {
-		return nil, fmt.Errorf("確保集合存在失敗: %v", err)
+		return nil, fmt.Errorf("確保集合存在失敗: %w", err)
 	}
 
 	// 2. 使用向量在 Milvus 中搜尋相似文檔
 	collectionName := getCollectionName(embeddingType)
-	results, err := s.milvusClient.Search(collectionName, queryVector, topK)
+	results, err := s.milvusClient.Search(ctx, collectionName, queryVector, topK, filter)
 	if err != nil {
 		return nil, fmt.Errorf("搜尋相似文檔失敗: %v", err)
 	}
@@ -288,37 +386,11 @@ func (s *Service) SearchSimilarDocumentsWithEmbedding(query string, topK int, em
 	// 3. 將搜尋結果轉換為文檔對象
 	documents := make([]Document, 0, len(results))
 	for _, result := range results {
-		// 小心處理不同類型的強制轉換
-		var idStr string
-		switch id := result["id"].(type) {
-		case string:
-			idStr = id
-		case int64:
-			idStr = fmt.Sprintf("%d", id)
-		case float64:
-			idStr = fmt.Sprintf("%d", int64(id))
-		default:
-			idStr = fmt.Sprintf("%v", id)
-		}
-
-		var text string
-		if textValue, ok := result["text"].(string); ok {
-			text = textValue
-		} else {
+		doc, ok := documentFromRow(result)
+		if !ok {
 			log.Printf("警告: 無法解析 text 欄位: %v", result["text"])
 			continue
 		}
-
-		var score float64
-		if scoreValue, ok := result["score"].(float64); ok {
-			score = scoreValue
-		}
-
-		doc := Document{
-			ID:    idStr,
-			Text:  text,
-			Score: score,
-		}
 		documents = append(documents, doc)
 	}
 
@@ -326,39 +398,47 @@ func (s *Service) SearchSimilarDocumentsWithEmbedding(query string, topK int, em
 }
 
 // 確保集合存在並有正確的維度
-func (s *Service) ensureCollectionWithDimension(dimension int, embeddingType llm.EmbeddingType) error {
+func (s *Service) ensureCollectionWithDimension(ctx context.Context, dimension int, embeddingType llm.EmbeddingType) error {
 	collectionName := getCollectionName(embeddingType)
 
 	// 檢查集合是否存在
-	exists, err := s.milvusClient.CollectionExists(collectionName)
+	exists, err := s.milvusClient.CollectionExists(ctx, collectionName)
 	if err != nil {
 		return fmt.Errorf("檢查集合存在失敗: %v", err)
 	}
 
 	if !exists {
 		// 創建集合
-		err = s.milvusClient.CreateCollection(collectionName, dimension)
+		err = s.milvusClient.CreateCollection(ctx, collectionName, dimension)
 		if err != nil {
 			return fmt.Errorf("創建集合失敗: %v", err)
 		}
 		log.Printf("已創建集合 %s，維度: %d", collectionName, dimension)
+		s.checkedCollections.Store(collectionName, true)
+		return nil
 	}
 
+	// 舊版的集合缺少純量欄位且不是以 COSINE 計算相似度，直接返回錯誤而不是寫入或搜尋出錯誤的結果
+	if _, ok := s.checkedCollections.Load(collectionName); ok {
+		return nil
+	}
+	if err := s.milvusClient.CheckSchema(ctx, collectionName); err != nil {
+		return err
+	}
+	s.checkedCollections.Store(collectionName, true)
 	return nil
 }
 
-// 根據嵌入類型獲取集合名稱
+// CollectionNameFor 返回指定嵌入類型使用的集合名稱
+func CollectionNameFor(embeddingType llm.EmbeddingType) string {
+	return getCollectionName(embeddingType)
+}
+
+// 根據嵌入類型從模型註冊表獲取集合名稱，未知的類型使用默認集合
 func getCollectionName(embeddingType llm.EmbeddingType) string {
-	switch embeddingType {
-	case llm.EmbeddingTypeGemini:
-		return CollectionName + "_gemini"
-	case llm.EmbeddingTypeOpenAI:
-		return CollectionName
-	case llm.EmbeddingTypeOpenAI3Small:
-		return CollectionName + "_openai3small"
-	case llm.EmbeddingTypeOpenAI3Large:
-		return CollectionName + "_openai3large"
-	default:
+	model, err := llm.LookupEmbeddingModel(embeddingType)
+	if err != nil {
 		return CollectionName
 	}
+	return model.Collection
 }
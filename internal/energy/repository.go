@@ -35,7 +35,7 @@ func (r *PostgresRepository) CreateEnergyUsage(usage *models.EnergyUsage) error
 		RETURNING id
 	`
 
-	fmt.Printf("Storing energy usage with humidity % with %v", usage.HumidityPercent)
+	fmt.Printf("Storing energy usage with humidity %v", usage.HumidityPercent)
 
 	return r.db.QueryRow(
 		query,
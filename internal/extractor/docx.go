@@ -0,0 +1,139 @@
+package extractor
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// extractDOCX 抽取 DOCX 的段落文字，並依標題樣式將段落分組
+// 每個標題開啟一個新段落，其後的內文歸屬於該標題
+func extractDOCX(filePath string) ([]Section, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("開啟 DOCX 失敗: %v", err)
+	}
+	defer archive.Close()
+
+	var document *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return nil, fmt.Errorf("DOCX 缺少 word/document.xml")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return nil, fmt.Errorf("讀取 DOCX 內容失敗: %v", err)
+	}
+	defer rc.Close()
+
+	paragraphs, err := parseDOCXParagraphs(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []Section
+	current := Section{}
+	var body []string
+	flush := func() {
+		current.Text = strings.Join(body, "\n")
+		if current.Text != "" || current.Heading != "" {
+			sections = append(sections, current)
+		}
+		body = nil
+	}
+
+	for _, p := range paragraphs {
+		if p.heading {
+			flush()
+			current = Section{Heading: p.text}
+			continue
+		}
+		body = append(body, p.text)
+	}
+	flush()
+
+	return sections, nil
+}
+
+// docxParagraph 是 DOCX 中的一個段落
+type docxParagraph struct {
+	text    string
+	heading bool
+}
+
+// parseDOCXParagraphs 解析 document.xml 中的 w:p 段落，忽略空白段落
+func parseDOCXParagraphs(r io.Reader) ([]docxParagraph, error) {
+	decoder := xml.NewDecoder(r)
+
+	var paragraphs []docxParagraph
+	var text strings.Builder
+	var heading, inText bool
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 DOCX XML 失敗: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				text.Reset()
+				heading = false
+			case "pStyle":
+				heading = isHeadingStyle(xmlAttr(t, "val"))
+			case "outlineLvl":
+				heading = true
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if content := strings.TrimSpace(text.String()); content != "" {
+					paragraphs = append(paragraphs, docxParagraph{text: content, heading: heading})
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return paragraphs, nil
+}
+
+// isHeadingStyle 判斷段落樣式是否為標題（Heading1…Heading9、Title）
+func isHeadingStyle(style string) bool {
+	style = strings.ToLower(style)
+	return strings.HasPrefix(style, "heading") || style == "title"
+}
+
+// xmlAttr 取得元素的屬性值（忽略命名空間）
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
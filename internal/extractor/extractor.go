@@ -0,0 +1,150 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedType 表示沒有對應副檔名的抽取器
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+// Section 是從檔案抽取出的一段文字，以及它在原始檔案中的結構位置
+type Section struct {
+	Text    string `json:"text"`
+	Page    int    `json:"page,omitempty"`    // PDF 頁碼（從 1 開始）
+	Sheet   string `json:"sheet,omitempty"`   // 試算表工作表名稱
+	Heading string `json:"heading,omitempty"` // 所屬的標題（DOCX、HTML）
+}
+
+// Metadata 回傳段落的結構資訊，只包含有值的欄位，供寫入向量資料庫時一併保存
+func (s Section) Metadata() map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if s.Page > 0 {
+		metadata["page"] = s.Page
+	}
+	if s.Sheet != "" {
+		metadata["sheet"] = s.Sheet
+	}
+	if s.Heading != "" {
+		metadata["heading"] = s.Heading
+	}
+	return metadata
+}
+
+// Extractor 從檔案中抽取文字段落
+type Extractor interface {
+	Extract(filePath string) ([]Section, error)
+}
+
+// ExtractorFunc 讓一般函式可以作為 Extractor 使用
+type ExtractorFunc func(filePath string) ([]Section, error)
+
+// Extract 呼叫函式本身
+func (f ExtractorFunc) Extract(filePath string) ([]Section, error) {
+	return f(filePath)
+}
+
+// Registry 以副檔名（含 "."，不分大小寫）對應抽取器
+type Registry struct {
+	mu         sync.RWMutex
+	extractors map[string]Extractor
+}
+
+// NewRegistry 創建一個空的抽取器註冊表
+func NewRegistry() *Registry {
+	return &Registry{
+		extractors: make(map[string]Extractor),
+	}
+}
+
+// NewDefaultRegistry 創建已註冊內建抽取器的註冊表
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(ExtractorFunc(extractPlainText), ".txt", ".md", ".json", ".xml")
+	r.Register(ExtractorFunc(extractPDF), ".pdf")
+	r.Register(ExtractorFunc(extractDOCX), ".docx")
+	r.Register(ExtractorFunc(extractXLSX), ".xlsx")
+	r.Register(ExtractorFunc(extractCSV), ".csv")
+	r.Register(ExtractorFunc(extractHTML), ".html", ".htm")
+	return r
+}
+
+// Register 為一個或多個副檔名註冊抽取器，已存在的註冊會被覆蓋
+func (r *Registry) Register(extractor Extractor, exts ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ext := range exts {
+		r.extractors[strings.ToLower(ext)] = extractor
+	}
+}
+
+// Lookup 取得副檔名對應的抽取器
+func (r *Registry) Lookup(ext string) (Extractor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	extractor, ok := r.extractors[strings.ToLower(ext)]
+	return extractor, ok
+}
+
+// Supports 檢查副檔名是否有對應的抽取器
+func (r *Registry) Supports(ext string) bool {
+	_, ok := r.Lookup(ext)
+	return ok
+}
+
+// Extract 依檔案副檔名選擇抽取器並抽取文字，空白段落會被移除
+func (r *Registry) Extract(filePath string) ([]Section, error) {
+	ext := filepath.Ext(filePath)
+	extractor, ok := r.Lookup(ext)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, ext)
+	}
+
+	sections, err := extractor.Extract(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("抽取 %s 檔案內容失敗: %v", ext, err)
+	}
+
+	result := make([]Section, 0, len(sections))
+	for _, section := range sections {
+		section.Text = strings.TrimSpace(section.Text)
+		if section.Text == "" {
+			continue
+		}
+		result = append(result, section)
+	}
+
+	return result, nil
+}
+
+// defaultRegistry 是套件層級使用的註冊表
+var defaultRegistry = NewDefaultRegistry()
+
+// Register 在預設註冊表中為副檔名註冊抽取器
+func Register(extractor Extractor, exts ...string) {
+	defaultRegistry.Register(extractor, exts...)
+}
+
+// Supports 檢查預設註冊表是否支援該副檔名
+func Supports(ext string) bool {
+	return defaultRegistry.Supports(ext)
+}
+
+// Extract 使用預設註冊表抽取檔案文字
+func Extract(filePath string) ([]Section, error) {
+	return defaultRegistry.Extract(filePath)
+}
+
+// JoinText 將所有段落的文字以空行串接
+func JoinText(sections []Section) string {
+	texts := make([]string, len(sections))
+	for i, section := range sections {
+		texts[i] = section.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
@@ -0,0 +1,220 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeFixture 將測試內容寫入暫存目錄，返回檔案路徑
+func writeFixture(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// buildDOCX 以 document.xml 的 body 內容產生最小的 DOCX 檔
+func buildDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, body)
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildPDF 產生每頁一行文字的最小 PDF 檔，xref 依實際位置計算
+func buildPDF(pages ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // 頁面樹，頁面數量確定後填入
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var kids []string
+	for _, text := range pages {
+		content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// TestExtract 確認各種檔案類型抽取出的段落與結構資訊
+func TestExtract(t *testing.T) {
+	workbook := excelize.NewFile()
+	workbook.SetSheetRow("Sheet1", "A1", &[]interface{}{"月份", "用電量", ""})
+	workbook.SetSheetRow("Sheet1", "A2", &[]interface{}{"一月", 1200, " "})
+	workbook.SetSheetRow("Sheet1", "A4", &[]interface{}{"二月", 1100})
+	workbook.NewSheet("空白")
+	workbook.NewSheet("備註")
+	workbook.SetCellValue("備註", "B2", "資料來源：電表")
+	xlsx, err := workbook.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want []Section
+	}{
+		{
+			name: "純文字",
+			file: "notes.TXT",
+			data: []byte("  三月用電量\n較上月增加  \n"),
+			want: []Section{{Text: "三月用電量\n較上月增加"}},
+		},
+		{
+			name: "CSV 略過空白欄位與空白列",
+			file: "usage.csv",
+			data: []byte("月份,用電量,備註\n一月,1200,\n, ,\n二月,\"1,100\",\"含\"\"空調\"\"\"\n三月\n"),
+			want: []Section{{Text: "月份 | 用電量 | 備註\n一月 | 1200\n二月 | 1,100 | 含\"空調\"\n三月"}},
+		},
+		{
+			name: "XLSX 每個工作表一個段落，空白工作表被移除",
+			file: "usage.xlsx",
+			data: xlsx.Bytes(),
+			want: []Section{
+				{Text: "月份 | 用電量\n一月 | 1200\n二月 | 1100", Sheet: "Sheet1"},
+				{Text: "資料來源：電表", Sheet: "備註"},
+			},
+		},
+		{
+			name: "DOCX 依標題樣式分組",
+			file: "report.docx",
+			data: buildDOCX(t, `
+				<w:p><w:r><w:t>前言段落</w:t></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>用電</w:t></w:r><w:r><w:t>概況</w:t></w:r></w:p>
+				<w:p><w:r><w:t>一月</w:t></w:r><w:r><w:tab/><w:t>1200 度</w:t></w:r></w:p>
+				<w:p><w:r><w:t xml:space="preserve">   </w:t></w:r></w:p>
+				<w:p><w:r><w:t>二月</w:t><w:br/><w:t>1100 度</w:t></w:r></w:p>
+				<w:p><w:pPr><w:outlineLvl w:val="1"/></w:pPr><w:r><w:t>大綱層級標題</w:t></w:r></w:p>
+				<w:p><w:r><w:t>二月較低</w:t></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>附錄</w:t></w:r></w:p>
+				<w:p><w:r><w:t>電表資料</w:t></w:r></w:p>`),
+			want: []Section{
+				{Text: "前言段落"},
+				{Text: "一月\t1200 度\n二月\n1100 度", Heading: "用電概況"},
+				{Text: "二月較低", Heading: "大綱層級標題"},
+				{Text: "電表資料", Heading: "附錄"},
+			},
+		},
+		{
+			name: "HTML 略過不可見元素並依標題分段",
+			file: "page.html",
+			data: []byte(`<html><head><title>不應出現</title><style>p { color: red }</style></head>
+				<body>
+					<p>前言</p>
+					<h1>用電 <span>概況</span><script>hidden()</script></h1>
+					<div>一月   1200 度</div><div>二月</div>
+					<script>var secret = "不應出現";</script>
+					<noscript>請啟用 JavaScript</noscript>
+					<template><p>範本內容</p></template>
+					<h2>建議</h2>
+					<ul><li>調整溫度</li><li>關閉閒置設備</li></ul>
+				</body></html>`),
+			want: []Section{
+				{Text: "前言"},
+				{Text: "一月 1200 度\n二月", Heading: "用電 概況"},
+				{Text: "調整溫度\n關閉閒置設備", Heading: "建議"},
+			},
+		},
+		{
+			name: "PDF 每頁一個段落",
+			file: "report.pdf",
+			data: buildPDF("March usage 1200 kWh", "April usage 1100 kWh"),
+			want: []Section{
+				{Text: "March usage 1200 kWh", Page: 1},
+				{Text: "April usage 1100 kWh", Page: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, err := Extract(writeFixture(t, tt.file, tt.data))
+			if err != nil {
+				t.Fatalf("抽取失敗: %v", err)
+			}
+			if !reflect.DeepEqual(sections, tt.want) {
+				t.Errorf("段落為 %q，預期 %q", sections, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractErrors 確認不支援的副檔名與損壞的檔案返回錯誤
+func TestExtractErrors(t *testing.T) {
+	if _, err := Extract(writeFixture(t, "image.png", []byte("png"))); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("不支援的副檔名錯誤為 %v，預期 ErrUnsupportedType", err)
+	}
+
+	for _, name := range []string{"broken.docx", "broken.xlsx", "broken.pdf"} {
+		if _, err := Extract(writeFixture(t, name, []byte("not a real file"))); err == nil {
+			t.Errorf("%s: 預期抽取失敗", name)
+		}
+	}
+
+	var empty bytes.Buffer
+	if err := zip.NewWriter(&empty).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Extract(writeFixture(t, "missing.docx", empty.Bytes())); err == nil || !strings.Contains(err.Error(), "document.xml") {
+		t.Errorf("缺少 document.xml 的錯誤為 %v", err)
+	}
+}
+
+// TestSectionMetadata 確認只包含有值的結構欄位
+func TestSectionMetadata(t *testing.T) {
+	tests := []struct {
+		section Section
+		want    map[string]interface{}
+	}{
+		{Section{Text: "文字"}, map[string]interface{}{}},
+		{Section{Text: "文字", Page: 2}, map[string]interface{}{"page": 2}},
+		{Section{Text: "文字", Sheet: "Sheet1", Heading: "概況"}, map[string]interface{}{"sheet": "Sheet1", "heading": "概況"}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.section.Metadata(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v 的結構資訊為 %v，預期 %v", tt.section, got, tt.want)
+		}
+	}
+}
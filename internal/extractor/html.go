@@ -0,0 +1,126 @@
+package extractor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// extractHTML 抽取 HTML 中使用者可見的文字，並以 h1–h6 標題分段
+// script、style 等不可見元素的內容會被略過
+func extractHTML(filePath string) ([]Section, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("開啟檔案失敗: %v", err)
+	}
+	defer file.Close()
+
+	root, err := html.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("解析 HTML 失敗: %v", err)
+	}
+
+	w := &htmlWalker{}
+	w.walk(root)
+	w.flush()
+
+	return w.sections, nil
+}
+
+// htmlWalker 走訪 DOM 並累積目前標題下的文字
+type htmlWalker struct {
+	sections []Section
+	heading  string
+	body     strings.Builder
+}
+
+func (w *htmlWalker) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+			if w.body.Len() > 0 && !strings.HasSuffix(w.body.String(), "\n") {
+				w.body.WriteString(" ")
+			}
+			w.body.WriteString(text)
+		}
+		return
+	case html.ElementNode:
+		if isHiddenElement(n.DataAtom) {
+			return
+		}
+		if isHeadingElement(n.DataAtom) {
+			w.flush()
+			w.heading = strings.Join(strings.Fields(nodeText(n)), " ")
+			return
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+	}
+
+	if n.Type == html.ElementNode && isBlockElement(n.DataAtom) {
+		w.newline()
+	}
+}
+
+// newline 在區塊元素結束時換行，避免相鄰區塊的文字黏在一起
+func (w *htmlWalker) newline() {
+	if w.body.Len() > 0 && !strings.HasSuffix(w.body.String(), "\n") {
+		w.body.WriteString("\n")
+	}
+}
+
+// flush 將目前累積的文字收成一個段落
+func (w *htmlWalker) flush() {
+	text := strings.TrimSpace(w.body.String())
+	if text != "" || w.heading != "" {
+		w.sections = append(w.sections, Section{Text: text, Heading: w.heading})
+	}
+	w.body.Reset()
+}
+
+// nodeText 取得節點底下所有可見文字
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && isHiddenElement(n.DataAtom) {
+		return ""
+	}
+
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(nodeText(child))
+		sb.WriteString(" ")
+	}
+	return sb.String()
+}
+
+func isHiddenElement(a atom.Atom) bool {
+	switch a {
+	case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Iframe:
+		return true
+	}
+	return false
+}
+
+func isHeadingElement(a atom.Atom) bool {
+	switch a {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+func isBlockElement(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Br, atom.Li, atom.Tr, atom.Table, atom.Section, atom.Article,
+		atom.Header, atom.Footer, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol, atom.Dd, atom.Dt:
+		return true
+	}
+	return false
+}
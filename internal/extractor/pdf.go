@@ -0,0 +1,33 @@
+package extractor
+
+import (
+	"fmt"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF 逐頁抽取 PDF 文字，每頁為一個段落
+func extractPDF(filePath string) ([]Section, error) {
+	file, reader, err := pdf.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("開啟 PDF 失敗: %v", err)
+	}
+	defer file.Close()
+
+	sections := make([]Section, 0, reader.NumPage())
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("抽取第 %d 頁文字失敗: %v", i, err)
+		}
+
+		sections = append(sections, Section{Text: text, Page: i})
+	}
+
+	return sections, nil
+}
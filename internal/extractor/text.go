@@ -0,0 +1,59 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// extractPlainText 直接讀取純文字檔案
+func extractPlainText(filePath string) ([]Section, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("讀取檔案失敗: %v", err)
+	}
+
+	return []Section{{Text: string(content)}}, nil
+}
+
+// extractCSV 將每一列轉換為一行文字，欄位以 " | " 分隔
+func extractCSV(filePath string) ([]Section, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("開啟檔案失敗: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // 允許每列欄位數不同
+	reader.LazyQuotes = true
+
+	var rows []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 CSV 失敗: %v", err)
+		}
+		if row := joinCells(record); row != "" {
+			rows = append(rows, row)
+		}
+	}
+
+	return []Section{{Text: strings.Join(rows, "\n")}}, nil
+}
+
+// joinCells 將非空白的儲存格以 " | " 串接成一行
+func joinCells(cells []string) string {
+	values := make([]string, 0, len(cells))
+	for _, cell := range cells {
+		if cell = strings.TrimSpace(cell); cell != "" {
+			values = append(values, cell)
+		}
+	}
+	return strings.Join(values, " | ")
+}
@@ -0,0 +1,39 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// extractXLSX 將每個工作表轉換為一個段落，每列為一行文字
+func extractXLSX(filePath string) ([]Section, error) {
+	workbook, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("開啟試算表失敗: %v", err)
+	}
+	defer workbook.Close()
+
+	var sections []Section
+	for _, sheet := range workbook.GetSheetList() {
+		rows, err := workbook.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("讀取工作表 %s 失敗: %v", sheet, err)
+		}
+
+		lines := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if line := joinCells(row); line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		sections = append(sections, Section{
+			Text:  strings.Join(lines, "\n"),
+			Sheet: sheet,
+		})
+	}
+
+	return sections, nil
+}
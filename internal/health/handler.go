@@ -0,0 +1,51 @@
+package health
+
+import (
+	"ai-workshop/internal/config"
+	"ai-workshop/internal/llm"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	config     *config.Config
+	llmFactory *llm.Factory
+}
+
+func NewHandler(config *config.Config, llmFactory *llm.Factory) *Handler {
+	return &Handler{
+		config:     config,
+		llmFactory: llmFactory,
+	}
+}
+
+// Health reports milvus health, the circuit breaker state of every llm provider/model and
+// the embedding cache hit counters.
+// The status is "degraded" while milvus is down or any breaker is not closed; it always
+// answers 200 so the response itself can be inspected.
+func (h *Handler) Health(c *gin.Context) {
+	breakers := h.llmFactory.BreakerStates()
+
+	status := "ok"
+	if !h.config.MilvusServiceHealty {
+		status = "degraded"
+	}
+	for _, breaker := range breakers {
+		if breaker.State != llm.BreakerClosed {
+			status = "degraded"
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": status,
+		"milvus": gin.H{
+			"healthy": h.config.MilvusServiceHealty,
+		},
+		"llm": gin.H{
+			"providers":        h.llmFactory.Providers(),
+			"circuit_breakers": breakers,
+			"embedding_cache":  h.llmFactory.EmbeddingCacheStats(),
+		},
+	})
+}
@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+)
+
+// ProviderStatus 描述 LLM 提供者在啟動時依設定判定的可用狀態
+type ProviderStatus struct {
+	Type      LLMType `json:"type"`
+	Enabled   bool    `json:"enabled"`
+	ChatModel string  `json:"chat_model,omitempty"`
+	Reason    string  `json:"reason,omitempty"` // 停用原因，例如未設定 API Key
+}
+
+// EmbeddingCapability 是嵌入模型資訊加上其提供者是否可用
+type EmbeddingCapability struct {
+	EmbeddingModelInfo
+	Enabled bool `json:"enabled"`
+}
+
+// checkConfigured 檢查提供者所需的設定，缺少時回傳包裝 ErrProviderDisabled 的錯誤
+func (f *Factory) checkConfigured(llmType LLMType) error {
+	var reason error
+	switch llmType {
+	case LLMTypeOpenAI:
+		if f.config.OpenAiAPIKey == "" {
+			reason = ErrAPIKeyNotConfigured
+		}
+	case LLMTypeGemini:
+		if f.config.GeminiAPIKey == "" {
+			reason = ErrAPIKeyNotConfigured
+		}
+	case LLMTypeLocal:
+		if f.config.LocalLLMBaseURL == "" {
+			reason = ErrBaseURLNotConfigured
+		}
+	case LLMTypeFake:
+		if !f.config.FakeLLMEnabled {
+			reason = ErrFakeLLMDisabled
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownModel, llmType)
+	}
+
+	if reason != nil {
+		return fmt.Errorf("%w: %s: %w", ErrProviderDisabled, llmType, reason)
+	}
+	return nil
+}
+
+// computeStatuses 於啟動時判定每個提供者是否可用並記錄到日誌
+func (f *Factory) computeStatuses() map[LLMType]ProviderStatus {
+	statuses := make(map[LLMType]ProviderStatus, len(supportedLLMTypes))
+	for _, llmType := range supportedLLMTypes {
+		status := ProviderStatus{Type: llmType, Enabled: true, ChatModel: f.chatModelName(llmType)}
+		if err := f.checkConfigured(llmType); err != nil {
+			status.Enabled = false
+			status.Reason = err.Error()
+			log.Printf("LLM 提供者 %s 已停用: %v", llmType, err)
+		} else {
+			log.Printf("LLM 提供者 %s 已啟用 (%s)", llmType, status.ChatModel)
+		}
+		statuses[llmType] = status
+	}
+	return statuses
+}
+
+// Providers 依 /api/models 的順序列出所有提供者的可用狀態
+func (f *Factory) Providers() []ProviderStatus {
+	providers := make([]ProviderStatus, 0, len(supportedLLMTypes))
+	for _, llmType := range supportedLLMTypes {
+		providers = append(providers, f.statuses[llmType])
+	}
+	return providers
+}
+
+// Enabled 判斷提供者在啟動時是否已設定
+func (f *Factory) Enabled(llmType LLMType) bool {
+	return f.statuses[llmType].Enabled
+}
+
+// EmbeddingCapabilities 列出所有嵌入模型及其提供者是否可用
+func (f *Factory) EmbeddingCapabilities() []EmbeddingCapability {
+	models := EmbeddingModels()
+	capabilities := make([]EmbeddingCapability, len(models))
+	for i, model := range models {
+		capabilities[i] = EmbeddingCapability{
+			EmbeddingModelInfo: model,
+			Enabled:            f.Enabled(model.Provider),
+		}
+	}
+	return capabilities
+}
+
+// DefaultModel 回傳偏好的預設聊天模型，偏好的提供者停用時改用第一個可用的提供者
+func (f *Factory) DefaultModel(preferred LLMType) LLMType {
+	if f.Enabled(preferred) {
+		return preferred
+	}
+	for _, llmType := range supportedLLMTypes {
+		if f.Enabled(llmType) {
+			log.Printf("預設模型 %s 未啟用，改用 %s", preferred, llmType)
+			return llmType
+		}
+	}
+	log.Printf("沒有任何已設定的 LLM 提供者，聊天請求將回傳 503")
+	return preferred
+}
+
+// DefaultEmbedding 回傳未指定嵌入模型的請求（RAG、文件搜尋與上傳）使用的嵌入模型
+func (f *Factory) DefaultEmbedding() EmbeddingType {
+	return f.defaultEmbedding
+}
+
+// resolveDefaultEmbedding 與 DefaultModel 相同：偏好的嵌入模型未註冊或其提供者停用時，改用註冊表中第一個可用的嵌入模型
+func (f *Factory) resolveDefaultEmbedding(preferred EmbeddingType) EmbeddingType {
+	if model, err := LookupEmbeddingModel(preferred); err == nil && f.Enabled(model.Provider) {
+		return preferred
+	}
+	for _, model := range EmbeddingModels() {
+		if f.Enabled(model.Provider) {
+			log.Printf("預設嵌入模型 %s 無法使用，改用 %s", preferred, model.Type)
+			return model.Type
+		}
+	}
+	log.Printf("沒有任何可用的嵌入模型，未指定 embedding_model 的請求將回傳 503")
+	return preferred
+}
@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"ai-workshop/internal/config"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultBatchConcurrency 是未設定時同時送出的批次數
+const defaultBatchConcurrency = 4
+
+// BatchConfig 是批量嵌入的切分與並行設定，上限會再與嵌入模型本身的限制取較小值
+type BatchConfig struct {
+	MaxInputs   int // 每批最多幾筆，0 表示只受模型限制
+	MaxTokens   int // 每批合計最多幾個 token，0 表示只受模型限制
+	Concurrency int // 同時送出的批次數
+}
+
+// NewBatchConfig 從應用程式設定建立批量嵌入設定
+func NewBatchConfig(appConfig *config.Config) BatchConfig {
+	return BatchConfig{
+		MaxInputs:   appConfig.EmbeddingBatchMaxInputs,
+		MaxTokens:   appConfig.EmbeddingBatchMaxTokens,
+		Concurrency: appConfig.EmbeddingBatchConcurrency,
+	}
+}
+
+// EmbeddingItemError 是批量嵌入中單一輸入的錯誤，Index 為輸入的位置（從 0 開始）
+type EmbeddingItemError struct {
+	Index int
+	Err   error
+}
+
+// BatchEmbeddingError 列出批量嵌入中失敗的輸入，其餘輸入的向量仍會回傳
+type BatchEmbeddingError struct {
+	Total  int
+	Failed []EmbeddingItemError // 依 Index 排序
+}
+
+// maxReportedItemErrors 是錯誤訊息中列出的失敗項目數
+const maxReportedItemErrors = 3
+
+func (e *BatchEmbeddingError) Error() string {
+	details := make([]string, 0, maxReportedItemErrors)
+	for i, item := range e.Failed {
+		if i == maxReportedItemErrors {
+			details = append(details, "...")
+			break
+		}
+		details = append(details, fmt.Sprintf("第 %d 項: %v", item.Index+1, item.Err))
+	}
+	return fmt.Sprintf("批量嵌入有 %d/%d 項失敗: %s", len(e.Failed), e.Total, strings.Join(details, "; "))
+}
+
+// Unwrap 讓 errors.Is 能判斷各項目的錯誤，例如逾時或斷路器斷開
+func (e *BatchEmbeddingError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, item := range e.Failed {
+		errs[i] = item.Err
+	}
+	return errs
+}
+
+// FailedIndexes 回傳失敗輸入的位置
+func (e *BatchEmbeddingError) FailedIndexes() []int {
+	indexes := make([]int, len(e.Failed))
+	for i, item := range e.Failed {
+		indexes[i] = item.Index
+	}
+	return indexes
+}
+
+// embedBatchFunc 為一批文本產生嵌入向量，回傳的向量需與輸入一一對應
+type embedBatchFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// EmbeddingBatcher 依嵌入模型的限制把輸入切成合規的批次，以有限的並行數送出，再依輸入順序組回結果
+type EmbeddingBatcher struct {
+	config BatchConfig
+}
+
+// NewEmbeddingBatcher 建立批次處理器，未設定的並行數使用預設值
+func NewEmbeddingBatcher(cfg BatchConfig) *EmbeddingBatcher {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultBatchConcurrency
+	}
+	return &EmbeddingBatcher{config: cfg}
+}
+
+// embeddingBatch 是一批輸入在原始切片中的位置
+type embeddingBatch struct {
+	indexes []int
+	texts   []string
+}
+
+// Embed 為所有輸入產生嵌入向量，b 為 nil 時使用預設設定
+// 超過模型單次輸入上限的文字不會送出；失敗的輸入在結果中為 nil，並以 *BatchEmbeddingError 回報
+func (b *EmbeddingBatcher) Embed(ctx context.Context, model EmbeddingModelInfo, texts []string, embed embedBatchFunc) ([][]float32, error) {
+	if b == nil {
+		b = NewEmbeddingBatcher(BatchConfig{})
+	}
+
+	embeddings := make([][]float32, len(texts))
+	itemErrors := make([]error, len(texts))
+
+	batches := b.split(model, texts, itemErrors)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, b.config.Concurrency)
+	for _, batch := range batches {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			for _, index := range batch.indexes {
+				itemErrors[index] = ctx.Err()
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(batch embeddingBatch) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			vectors, err := embed(ctx, batch.texts)
+			if err == nil && len(vectors) != len(batch.texts) {
+				err = fmt.Errorf("嵌入向量數量不符: 輸入 %d 筆，回傳 %d 筆", len(batch.texts), len(vectors))
+			}
+			// 每個 goroutine 只寫入自己批次的位置，不需要加鎖
+			for i, index := range batch.indexes {
+				if err != nil {
+					itemErrors[index] = err
+					continue
+				}
+				embeddings[index] = vectors[i]
+			}
+		}(batch)
+	}
+	wg.Wait()
+
+	var failed []EmbeddingItemError
+	for index, err := range itemErrors {
+		if err != nil {
+			failed = append(failed, EmbeddingItemError{Index: index, Err: err})
+		}
+	}
+	if len(failed) > 0 {
+		return embeddings, &BatchEmbeddingError{Total: len(texts), Failed: failed}
+	}
+	return embeddings, nil
+}
+
+// split 依輸入順序貪婪地切出批次，每批不超過筆數與 token 上限
+// 單筆就超過模型輸入上限的文字記錄在 itemErrors，不放進任何批次
+func (b *EmbeddingBatcher) split(model EmbeddingModelInfo, texts []string, itemErrors []error) []embeddingBatch {
+	maxInputs := minLimit(model.MaxBatchInputs, b.config.MaxInputs)
+	maxTokens := minLimit(model.MaxBatchTokens, b.config.MaxTokens)
+
+	var batches []embeddingBatch
+	var current embeddingBatch
+	currentTokens := 0
+
+	for index, text := range texts {
+		tokens := CountTokens(model, text)
+		if model.MaxInputTokens > 0 && tokens > model.MaxInputTokens {
+			itemErrors[index] = fmt.Errorf("%w: %d tokens，上限 %d", ErrInputTooLong, tokens, model.MaxInputTokens)
+			continue
+		}
+
+		full := maxInputs > 0 && len(current.texts) >= maxInputs
+		overBudget := maxTokens > 0 && currentTokens+tokens > maxTokens
+		if len(current.texts) > 0 && (full || overBudget) {
+			batches = append(batches, current)
+			current = embeddingBatch{}
+			currentTokens = 0
+		}
+
+		current.indexes = append(current.indexes, index)
+		current.texts = append(current.texts, text)
+		currentTokens += tokens
+	}
+	if len(current.texts) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// minLimit 取兩個上限中較小的值，0 表示不限制
+func minLimit(a, b int) int {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
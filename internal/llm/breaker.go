@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 是斷路器的狀態
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常放行
+	BreakerOpen     BreakerState = "open"      // 連續失敗過多，暫停呼叫
+	BreakerHalfOpen BreakerState = "half-open" // 冷卻結束，放行一個試探請求
+)
+
+// BreakerStatus 是斷路器的狀態快照，供健康檢查端點使用
+type BreakerStatus struct {
+	Key                 string       `json:"key"` // provider/model
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenUntil           *time.Time   `json:"open_until,omitempty"`
+}
+
+// circuitBreaker 在連續 threshold 次可重試的失敗後斷開，cooldown 後放行一個試探請求
+// 試探成功即恢復，失敗則再次斷開
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     clock
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, clock clock) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     clock,
+		state:     BreakerClosed,
+	}
+}
+
+// allow 判斷是否可以送出請求，斷開時回傳 ErrCircuitOpen
+func (b *circuitBreaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Before(b.openUntil) {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// success 記錄成功（或與服務狀態無關的失敗），關閉斷路器
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// failure 記錄一次可重試的失敗，達到門檻或試探失敗時斷開
+func (b *circuitBreaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openUntil = b.clock.Now().Add(b.cooldown)
+	}
+}
+
+// release 請求被取消時釋放試探名額，不改變狀態
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// currentState 回傳斷路器目前的狀態，冷卻已結束但尚未有請求試探時視為 half-open
+func (b *circuitBreaker) currentState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && !b.clock.Now().Before(b.openUntil) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// status 回傳斷路器的狀態快照
+func (b *circuitBreaker) status(key string) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Key:                 key,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state == BreakerOpen {
+		openUntil := b.openUntil
+		status.OpenUntil = &openUntil
+	}
+	return status
+}
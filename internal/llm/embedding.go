@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// EmbeddingProvider 是嵌入向量提供者，每個提供者只支援屬於自己的嵌入類型
+type EmbeddingProvider interface {
+	CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error)
+	CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error)
+	GetDimensionFor(embeddingType EmbeddingType) (int, error)
+}
+
+// EmbeddingProviderFor 取得產生指定嵌入類型的提供者，與 Get 共用同一份快取，呼叫端不應自行 Close
+// 啟用嵌入快取時，回傳的提供者會先查快取，沒有命中的文字才呼叫 API
+func (f *Factory) EmbeddingProviderFor(embeddingType EmbeddingType) (EmbeddingProvider, error) {
+	llmType, err := embeddingLLMType(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := f.Get(llmType)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder, ok := provider.(EmbeddingProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s 不支援嵌入向量", llmType)
+	}
+	if f.embeddingCache.Enabled() {
+		return f.embeddingCache.Wrap(embedder), nil
+	}
+	return embedder, nil
+}
+
+// SetEmbeddingCacheStore 設定嵌入快取的持久層，需在開始處理請求前呼叫
+func (f *Factory) SetEmbeddingCacheStore(store EmbeddingCacheStore) {
+	f.embeddingCache.SetStore(store)
+}
+
+// EmbeddingCacheStats 回傳嵌入快取的命中統計
+func (f *Factory) EmbeddingCacheStats() EmbeddingCacheStats {
+	return f.embeddingCache.Stats()
+}
+
+// embeddingLLMType 返回提供指定嵌入類型的 LLM 類型
+func embeddingLLMType(embeddingType EmbeddingType) (LLMType, error) {
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return "", err
+	}
+	return model.Provider, nil
+}
+
+var (
+	_ EmbeddingProvider = (*OpenAIProvider)(nil)
+	_ EmbeddingProvider = (*GeminiClient)(nil)
+	_ EmbeddingProvider = (*FakeProvider)(nil)
+	_ EmbeddingProvider = (*meteredProvider)(nil)
+)
@@ -0,0 +1,323 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmbeddingCacheStore 是嵌入快取的持久層，鍵為模型名稱加文字雜湊
+type EmbeddingCacheStore interface {
+	// GetEmbeddings 取得已存在的向量，沒有的雜湊不會出現在結果中
+	GetEmbeddings(ctx context.Context, model string, hashes []string) (map[string][]float32, error)
+	// PutEmbeddings 寫入向量，已存在的項目保留原值
+	PutEmbeddings(ctx context.Context, model string, embeddings map[string][]float32) error
+}
+
+// EmbeddingCacheStats 是嵌入快取的命中統計，供健康檢查端點使用
+type EmbeddingCacheStats struct {
+	Entries        int    `json:"entries"`
+	Capacity       int    `json:"capacity"`
+	Persistent     bool   `json:"persistent"`
+	MemoryHits     uint64 `json:"memory_hits"`
+	PersistentHits uint64 `json:"persistent_hits"`
+	Misses         uint64 `json:"misses"`
+}
+
+// EmbeddingCache 是放在所有嵌入提供者前面的內容定址快取，鍵為 provider/model 加正規化文字的 SHA-256
+// 先查記憶體中的 LRU，再查選用的持久層，都沒有才呼叫提供者，相同文字重新處理或重建索引時不會再計費
+type EmbeddingCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 最近使用的在前
+	store   EmbeddingCacheStore
+
+	memoryHits     atomic.Uint64
+	persistentHits atomic.Uint64
+	misses         atomic.Uint64
+}
+
+// lruEntry 是 LRU 中的一筆向量
+type lruEntry struct {
+	key       string
+	embedding []float32
+}
+
+// NewEmbeddingCache 建立嵌入快取，capacity 為記憶體中最多保留的向量數，0 表示只使用持久層
+func NewEmbeddingCache(capacity int) *EmbeddingCache {
+	return &EmbeddingCache{
+		capacity: max(capacity, 0),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// SetStore 設定持久層，nil 表示只使用記憶體
+func (c *EmbeddingCache) SetStore(store EmbeddingCacheStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store = store
+}
+
+// Enabled 回傳快取是否有任何一層可用
+func (c *EmbeddingCache) Enabled() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.capacity > 0 || c.store != nil
+}
+
+// Stats 回傳目前的命中統計
+func (c *EmbeddingCache) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	persistent := c.store != nil
+	c.mu.Unlock()
+
+	return EmbeddingCacheStats{
+		Entries:        entries,
+		Capacity:       c.capacity,
+		Persistent:     persistent,
+		MemoryHits:     c.memoryHits.Load(),
+		PersistentHits: c.persistentHits.Load(),
+		Misses:         c.misses.Load(),
+	}
+}
+
+// Wrap 讓提供者的嵌入呼叫先經過快取
+func (c *EmbeddingCache) Wrap(provider EmbeddingProvider) EmbeddingProvider {
+	return &cachedEmbeddingProvider{cache: c, provider: provider}
+}
+
+// HashEmbeddingText 回傳正規化文字的 SHA-256（十六進位）
+// 正規化只做 Unicode NFC、統一換行與去除頭尾空白，不會改變文字的意思
+func HashEmbeddingText(text string) string {
+	normalized := strings.ReplaceAll(text, "\r\n", "\n")
+	normalized = strings.TrimSpace(norm.NFC.String(normalized))
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheModelName 是快取鍵中的模型名稱，加上提供者避免不同本地伺服器的同名模型混用
+// 再加上維度，更改 LOCAL_LLM_EMBEDDING_DIMENSION 等設定後不會取回維度不同的舊向量
+func cacheModelName(model EmbeddingModelInfo) string {
+	return fmt.Sprintf("%s/%s@%d", model.Provider, model.APIModel, model.Dimension)
+}
+
+// lookup 依序查詢記憶體與持久層，回傳找到的向量，鍵為雜湊
+func (c *EmbeddingCache) lookup(ctx context.Context, model string, hashes []string) map[string][]float32 {
+	found := make(map[string][]float32, len(hashes))
+	var missing []string
+
+	c.mu.Lock()
+	for _, hash := range hashes {
+		if _, ok := found[hash]; ok {
+			continue
+		}
+		if element, ok := c.entries[model+"|"+hash]; ok {
+			c.order.MoveToFront(element)
+			found[hash] = element.Value.(*lruEntry).embedding
+			c.memoryHits.Add(1)
+			continue
+		}
+		missing = append(missing, hash)
+	}
+	store := c.store
+	c.mu.Unlock()
+
+	if store != nil && len(missing) > 0 {
+		stored, err := store.GetEmbeddings(ctx, model, missing)
+		if err != nil {
+			// 持久層只是加速用，查詢失敗時當作沒有命中
+			log.Printf("讀取嵌入快取失敗: %v", err)
+		}
+		for hash, embedding := range stored {
+			found[hash] = embedding
+			c.persistentHits.Add(1)
+			c.remember(model, hash, embedding)
+		}
+	}
+
+	return found
+}
+
+// save 將新產生的向量寫入記憶體與持久層
+func (c *EmbeddingCache) save(ctx context.Context, model string, embeddings map[string][]float32) {
+	if len(embeddings) == 0 {
+		return
+	}
+
+	for hash, embedding := range embeddings {
+		c.remember(model, hash, embedding)
+	}
+
+	c.mu.Lock()
+	store := c.store
+	c.mu.Unlock()
+
+	if store != nil {
+		if err := store.PutEmbeddings(ctx, model, embeddings); err != nil {
+			log.Printf("寫入嵌入快取失敗: %v", err)
+		}
+	}
+}
+
+// remember 將向量放進 LRU，超過容量時淘汰最久未使用的項目
+func (c *EmbeddingCache) remember(model, hash string, embedding []float32) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := model + "|" + hash
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).embedding = embedding
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, embedding: embedding})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// cachedEmbeddingProvider 是經過快取的嵌入提供者
+type cachedEmbeddingProvider struct {
+	cache    *EmbeddingCache
+	provider EmbeddingProvider
+}
+
+// CreateEmbeddingWith 命中快取時直接回傳，否則呼叫提供者並寫入快取
+func (p *cachedEmbeddingProvider) CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error) {
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+	name := cacheModelName(model)
+	hash := HashEmbeddingText(text)
+
+	if embedding, ok := p.cache.lookup(ctx, name, []string{hash})[hash]; ok {
+		return embedding, nil
+	}
+
+	p.cache.misses.Add(1)
+	embedding, err := p.provider.CreateEmbeddingWith(ctx, embeddingType, text)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache.save(ctx, name, map[string][]float32{hash: embedding})
+	return embedding, nil
+}
+
+// CreateBatchEmbeddingsWith 只把沒有命中的文字（相同文字只送一次）交給提供者，結果維持輸入順序
+// 提供者部分失敗時，*BatchEmbeddingError 中的位置會換算回原始輸入的位置
+func (p *cachedEmbeddingProvider) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error) {
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+	name := cacheModelName(model)
+
+	hashes := make([]string, len(texts))
+	for i, text := range texts {
+		hashes[i] = HashEmbeddingText(text)
+	}
+	found := p.cache.lookup(ctx, name, hashes)
+
+	// 沒有命中的文字依第一次出現的順序送出，positions 記錄每筆對應的所有原始位置
+	var missTexts, missHashes []string
+	var positions [][]int
+	missIndex := make(map[string]int)
+	for i, hash := range hashes {
+		if _, ok := found[hash]; ok {
+			continue
+		}
+		if j, ok := missIndex[hash]; ok {
+			positions[j] = append(positions[j], i)
+			continue
+		}
+		missIndex[hash] = len(missTexts)
+		missTexts = append(missTexts, texts[i])
+		missHashes = append(missHashes, hash)
+		positions = append(positions, []int{i})
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, hash := range hashes {
+		embeddings[i] = found[hash]
+	}
+	if len(missTexts) == 0 {
+		return embeddings, nil
+	}
+
+	p.cache.misses.Add(uint64(len(missTexts)))
+	generated, err := p.provider.CreateBatchEmbeddingsWith(ctx, embeddingType, missTexts)
+
+	var batchErr *BatchEmbeddingError
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, err
+	}
+
+	fresh := make(map[string][]float32, len(generated))
+	for j, embedding := range generated {
+		if embedding == nil {
+			continue
+		}
+		fresh[missHashes[j]] = embedding
+		for _, i := range positions[j] {
+			embeddings[i] = embedding
+		}
+	}
+	p.cache.save(ctx, name, fresh)
+
+	if batchErr != nil {
+		return embeddings, remapBatchError(batchErr, positions, len(texts))
+	}
+	return embeddings, nil
+}
+
+// GetDimensionFor 直接交給提供者
+func (p *cachedEmbeddingProvider) GetDimensionFor(embeddingType EmbeddingType) (int, error) {
+	return p.provider.GetDimensionFor(embeddingType)
+}
+
+// remapBatchError 將只含未命中文字的錯誤位置換算回原始輸入的位置
+func remapBatchError(err *BatchEmbeddingError, positions [][]int, total int) *BatchEmbeddingError {
+	itemErrors := make([]error, total)
+	for _, item := range err.Failed {
+		for _, i := range positions[item.Index] {
+			itemErrors[i] = item.Err
+		}
+	}
+
+	remapped := &BatchEmbeddingError{Total: total}
+	for i, itemErr := range itemErrors {
+		if itemErr != nil {
+			remapped.Failed = append(remapped.Failed, EmbeddingItemError{Index: i, Err: itemErr})
+		}
+	}
+	return remapped
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresEmbeddingCacheStore 將嵌入快取保存在 embedding_cache 資料表，重新啟動後仍可命中
+type PostgresEmbeddingCacheStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresEmbeddingCacheStore(db *sqlx.DB) EmbeddingCacheStore {
+	return &PostgresEmbeddingCacheStore{
+		db: db,
+	}
+}
+
+// cachedEmbeddingRow 是 embedding_cache 的一列
+type cachedEmbeddingRow struct {
+	ContentHash string          `db:"content_hash"`
+	Embedding   pq.Float32Array `db:"embedding"`
+}
+
+func (s *PostgresEmbeddingCacheStore) GetEmbeddings(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	query := `
+		SELECT content_hash, embedding
+		FROM embedding_cache
+		WHERE model = $1 AND content_hash = ANY($2)
+	`
+
+	rows := []cachedEmbeddingRow{}
+	if err := s.db.SelectContext(ctx, &rows, query, model, pq.Array(hashes)); err != nil {
+		return nil, err
+	}
+
+	embeddings := make(map[string][]float32, len(rows))
+	for _, row := range rows {
+		embeddings[row.ContentHash] = row.Embedding
+	}
+	return embeddings, nil
+}
+
+// PutEmbeddings 在同一個交易中寫入所有向量，已存在的雜湊不會覆寫
+func (s *PostgresEmbeddingCacheStore) PutEmbeddings(ctx context.Context, model string, embeddings map[string][]float32) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for hash, embedding := range embeddings {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO embedding_cache (model, content_hash, dimension, embedding)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (model, content_hash) DO NOTHING
+		`, model, hash, len(embedding), pq.Float32Array(embedding))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+// TestEmbeddingCacheKeyedByDimension 確認模型維度改變後不會從快取取回舊維度的向量
+func TestEmbeddingCacheKeyedByDimension(t *testing.T) {
+	defer RegisterEmbeddingModel(FakeEmbeddingModel(DefaultFakeEmbeddingDimension))
+
+	cache := NewEmbeddingCache(10)
+	provider := cache.Wrap(NewFakeProvider(nil))
+	ctx := context.Background()
+
+	for _, dimension := range []int{8, 16, 8} {
+		RegisterEmbeddingModel(FakeEmbeddingModel(dimension))
+
+		embedding, err := provider.CreateEmbeddingWith(ctx, EmbeddingTypeFake, "三月用電量")
+		if err != nil {
+			t.Fatalf("創建嵌入向量失敗: %v", err)
+		}
+		if len(embedding) != dimension {
+			t.Errorf("向量維度為 %d，預期 %d", len(embedding), dimension)
+		}
+	}
+
+	if stats := cache.Stats(); stats.MemoryHits != 1 {
+		t.Errorf("快取命中 %d 次，預期只有回到 8 維時命中 1 次", stats.MemoryHits)
+	}
+}
@@ -0,0 +1,221 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EmbeddingModelInfo 描述一個嵌入模型，是各套件取得模型名稱、維度與集合名稱的唯一來源
+type EmbeddingModelInfo struct {
+	Type              EmbeddingType `json:"type"`                         // 系統內使用的嵌入類型，即請求中的 embedding_model
+	Provider          LLMType       `json:"provider"`                     // 提供嵌入向量的 LLM
+	APIModel          string        `json:"api_model"`                    // 呼叫 API 時使用的模型名稱
+	Dimension         int           `json:"dimension"`                    // 向量維度，以 EMBEDDING_DIMENSIONS 縮減時為縮減後的維度
+	ReducedDimensions []int         `json:"reduced_dimensions,omitempty"` // 可透過 dimensions 參數縮減的維度（僅 3 系列模型）
+	RequestDimensions int           `json:"request_dimensions,omitempty"` // 呼叫 API 時帶入的 dimensions 參數，0 表示使用原生維度
+	MaxInputTokens    int           `json:"max_input_tokens"`             // 單次輸入的最大 token 數
+	MaxBatchInputs    int           `json:"max_batch_inputs"`             // 單次請求最多幾筆輸入
+	MaxBatchTokens    int           `json:"max_batch_tokens,omitempty"`   // 單次請求所有輸入合計的最大 token 數，0 表示不限制
+	Tokenizer         string        `json:"tokenizer,omitempty"`          // 計算 token 數的編碼，空值時以估算值計算
+	Collection        string        `json:"collection"`                   // 向量寫入的 Milvus 集合
+	Description       string        `json:"description"`
+}
+
+// OpenAI 嵌入 API 單次請求的限制
+const (
+	openAIMaxBatchInputs = 2048
+	openAIMaxBatchTokens = 300000
+)
+
+// geminiMaxBatchInputs 是 Gemini BatchEmbedContents 單次請求的筆數上限
+const geminiMaxBatchInputs = 100
+
+// embeddingModelsMu 保護 embeddingModels，本地模型會在啟動時依設定註冊
+var embeddingModelsMu sync.RWMutex
+
+// builtinEmbeddingModels 是內建的嵌入模型，維度皆為原生維度，順序即 /api/embedding-models 的列出順序
+var builtinEmbeddingModels = []EmbeddingModelInfo{
+	{
+		Type:              EmbeddingTypeOpenAI3Small,
+		Provider:          LLMTypeOpenAI,
+		APIModel:          "text-embedding-3-small",
+		Dimension:         1536,
+		ReducedDimensions: []int{512, 1024},
+		MaxInputTokens:    8191,
+		MaxBatchInputs:    openAIMaxBatchInputs,
+		MaxBatchTokens:    openAIMaxBatchTokens,
+		Tokenizer:         TokenizerCL100K,
+		Collection:        "documents_openai3small",
+		Description:       "OpenAI 第三代小型嵌入模型，成本低，適用於大多數文字檔案",
+	},
+	{
+		Type:              EmbeddingTypeOpenAI3Large,
+		Provider:          LLMTypeOpenAI,
+		APIModel:          "text-embedding-3-large",
+		Dimension:         3072,
+		ReducedDimensions: []int{256, 1024, 1536},
+		MaxInputTokens:    8191,
+		MaxBatchInputs:    openAIMaxBatchInputs,
+		MaxBatchTokens:    openAIMaxBatchTokens,
+		Tokenizer:         TokenizerCL100K,
+		Collection:        "documents_openai3large",
+		Description:       "OpenAI 第三代大型嵌入模型，檢索品質最好",
+	},
+	{
+		Type:           EmbeddingTypeOpenAI,
+		Provider:       LLMTypeOpenAI,
+		APIModel:       "text-embedding-ada-002",
+		Dimension:      1536,
+		MaxInputTokens: 8191,
+		MaxBatchInputs: openAIMaxBatchInputs,
+		MaxBatchTokens: openAIMaxBatchTokens,
+		Tokenizer:      TokenizerCL100K,
+		Collection:     "documents",
+		Description:    "OpenAI 第二代嵌入模型，RAG 與文件 API 的預設值",
+	},
+	{
+		Type:           EmbeddingTypeGemini,
+		Provider:       LLMTypeGemini,
+		APIModel:       "embedding-001",
+		Dimension:      768,
+		MaxInputTokens: 2048,
+		MaxBatchInputs: geminiMaxBatchInputs,
+		Collection:     "documents_gemini",
+		Description:    "Google Gemini 嵌入模型",
+	},
+}
+
+// embeddingModels 是目前註冊的嵌入模型，啟動時依設定縮減維度或加入本地、假嵌入模型
+var embeddingModels = append([]EmbeddingModelInfo(nil), builtinEmbeddingModels...)
+
+// RegisterEmbeddingModel 註冊嵌入模型，已存在相同類型時取代原本的資訊
+func RegisterEmbeddingModel(model EmbeddingModelInfo) {
+	embeddingModelsMu.Lock()
+	defer embeddingModelsMu.Unlock()
+
+	for i, existing := range embeddingModels {
+		if existing.Type == model.Type {
+			embeddingModels[i] = model
+			return
+		}
+	}
+	embeddingModels = append(embeddingModels, model)
+}
+
+// EmbeddingModels 列出所有支援的嵌入模型
+func EmbeddingModels() []EmbeddingModelInfo {
+	embeddingModelsMu.RLock()
+	defer embeddingModelsMu.RUnlock()
+
+	models := make([]EmbeddingModelInfo, len(embeddingModels))
+	copy(models, embeddingModels)
+	return models
+}
+
+// LookupEmbeddingModel 取得嵌入類型的模型資訊
+func LookupEmbeddingModel(embeddingType EmbeddingType) (EmbeddingModelInfo, error) {
+	embeddingModelsMu.RLock()
+	defer embeddingModelsMu.RUnlock()
+
+	for _, model := range embeddingModels {
+		if model.Type == embeddingType {
+			return model, nil
+		}
+	}
+	return EmbeddingModelInfo{}, fmt.Errorf("%w: %q", ErrUnsupportedEmbedding, embeddingType)
+}
+
+// EmbeddingModelByName 以嵌入類型或 API 模型名稱（例如 text-embedding-3-small）查詢模型資訊
+func EmbeddingModelByName(name string) (EmbeddingModelInfo, error) {
+	embeddingModelsMu.RLock()
+	defer embeddingModelsMu.RUnlock()
+
+	for _, model := range embeddingModels {
+		if string(model.Type) == name || model.APIModel == name {
+			return model, nil
+		}
+	}
+	return EmbeddingModelInfo{}, fmt.Errorf("%w: %q", ErrUnsupportedEmbedding, name)
+}
+
+// EmbeddingModelByCollection 以 Milvus 集合名稱查詢寫入該集合的嵌入模型
+func EmbeddingModelByCollection(collection string) (EmbeddingModelInfo, error) {
+	embeddingModelsMu.RLock()
+	defer embeddingModelsMu.RUnlock()
+
+	for _, model := range embeddingModels {
+		if model.Collection == collection {
+			return model, nil
+		}
+	}
+	return EmbeddingModelInfo{}, fmt.Errorf("%w: 沒有嵌入模型使用集合 %q", ErrUnsupportedEmbedding, collection)
+}
+
+// SupportsDimension 判斷模型是否能輸出指定維度
+func (m EmbeddingModelInfo) SupportsDimension(dimension int) bool {
+	if dimension == m.Dimension {
+		return true
+	}
+	for _, d := range m.ReducedDimensions {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+// WithDimension 回傳輸出指定維度的模型資訊，縮減後的向量寫入另一個集合（例如 documents_openai3large_1024），
+// 不會與原生維度的集合混用；模型不支援該維度時返回錯誤
+func (m EmbeddingModelInfo) WithDimension(dimension int) (EmbeddingModelInfo, error) {
+	if dimension == m.Dimension {
+		return m, nil
+	}
+	if !m.SupportsDimension(dimension) {
+		return EmbeddingModelInfo{}, fmt.Errorf("%w: %s 不支援 %d 維，可用的維度為 %d 與 %v", ErrUnsupportedEmbedding, m.Type, dimension, m.Dimension, m.ReducedDimensions)
+	}
+
+	m.Dimension = dimension
+	m.RequestDimensions = dimension
+	m.Collection = fmt.Sprintf("%s_%d", m.Collection, dimension)
+	return m, nil
+}
+
+// configureEmbeddingDimensions 依設定重新註冊支援縮減維度的內建模型，未設定的模型恢復原生維度
+func configureEmbeddingDimensions(dimensions map[EmbeddingType]int) {
+	for _, model := range builtinEmbeddingModels {
+		if len(model.ReducedDimensions) == 0 {
+			continue
+		}
+
+		if dimension, ok := dimensions[model.Type]; ok {
+			reduced, err := model.WithDimension(dimension)
+			if err != nil {
+				log.Printf("忽略嵌入維度設定: %v", err)
+			} else {
+				model = reduced
+			}
+		}
+		RegisterEmbeddingModel(model)
+	}
+}
+
+// parseEmbeddingDimensions 解析 "openai-3-large=1024,openai-3-small=512" 格式的嵌入維度設定
+func parseEmbeddingDimensions(raw string) map[EmbeddingType]int {
+	dimensions := make(map[EmbeddingType]int)
+	for _, entry := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		dimension, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || dimension <= 0 {
+			log.Printf("忽略無效的嵌入維度設定 %q", entry)
+			continue
+		}
+		dimensions[EmbeddingType(strings.TrimSpace(key))] = dimension
+	}
+	return dimensions
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestEmbeddingModelWithDimension 確認縮減維度會改變向量維度、API 參數與集合名稱，不支援的維度返回錯誤
+func TestEmbeddingModelWithDimension(t *testing.T) {
+	model, err := LookupEmbeddingModel(EmbeddingTypeOpenAI3Large)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reduced, err := model.WithDimension(1024)
+	if err != nil {
+		t.Fatalf("縮減維度失敗: %v", err)
+	}
+	if reduced.Dimension != 1024 || reduced.RequestDimensions != 1024 || reduced.Collection != "documents_openai3large_1024" {
+		t.Errorf("縮減後的模型為 %+v", reduced)
+	}
+
+	native, err := model.WithDimension(model.Dimension)
+	if err != nil || !reflect.DeepEqual(native, model) {
+		t.Errorf("原生維度應原樣返回，得到 %+v, %v", native, err)
+	}
+
+	if _, err := model.WithDimension(999); !errors.Is(err, ErrUnsupportedEmbedding) {
+		t.Errorf("不支援的維度錯誤為 %v，預期 ErrUnsupportedEmbedding", err)
+	}
+}
+
+// TestConfigureEmbeddingDimensions 確認設定可重複套用，移除設定後恢復原生維度，無效的設定被忽略
+func TestConfigureEmbeddingDimensions(t *testing.T) {
+	defer configureEmbeddingDimensions(nil)
+
+	dimensions := parseEmbeddingDimensions("openai-3-large=1024, openai-3-small=999, openai-ada-002=x")
+	if !reflect.DeepEqual(dimensions, map[EmbeddingType]int{EmbeddingTypeOpenAI3Large: 1024, EmbeddingTypeOpenAI3Small: 999}) {
+		t.Fatalf("解析結果為 %v", dimensions)
+	}
+
+	tests := []struct {
+		name           string
+		dimensions     map[EmbeddingType]int
+		wantLarge      int
+		wantCollection string
+		wantSmall      int
+	}{
+		{"縮減 3-large，3-small 的維度無效", dimensions, 1024, "documents_openai3large_1024", 1536},
+		{"重複套用不會再加後綴", dimensions, 1024, "documents_openai3large_1024", 1536},
+		{"移除設定後恢復原生維度", nil, 3072, "documents_openai3large", 1536},
+	}
+	for _, tt := range tests {
+		configureEmbeddingDimensions(tt.dimensions)
+
+		large, _ := LookupEmbeddingModel(EmbeddingTypeOpenAI3Large)
+		small, _ := LookupEmbeddingModel(EmbeddingTypeOpenAI3Small)
+		if large.Dimension != tt.wantLarge || large.Collection != tt.wantCollection {
+			t.Errorf("%s: 3-large 為 %d 維、集合 %s", tt.name, large.Dimension, large.Collection)
+		}
+		if small.Dimension != tt.wantSmall {
+			t.Errorf("%s: 3-small 為 %d 維，預期 %d", tt.name, small.Dimension, tt.wantSmall)
+		}
+	}
+}
+
+// TestEmbeddingRequestDimensions 確認縮減維度的模型在嵌入請求中帶入 dimensions 參數
+func TestEmbeddingRequestDimensions(t *testing.T) {
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input      []string `json:"input"`
+			Dimensions int      `json:"dimensions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("解析嵌入請求失敗: %v", err)
+		}
+		requested = append(requested, req.Dimensions)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [{"object": "embedding", "index": 0, "embedding": [0.6, 0.8]}]}`))
+	}))
+	defer server.Close()
+
+	defer RegisterEmbeddingModel(LocalEmbeddingModel("nomic-embed-text", 3, 0))
+	provider := NewLocalProvider(server.URL+"/v1", "", "llama3.1", nil, nil)
+
+	for _, requestDimensions := range []int{0, 2} {
+		RegisterEmbeddingModel(EmbeddingModelInfo{
+			Type:              EmbeddingTypeLocal,
+			Provider:          LLMTypeLocal,
+			APIModel:          "reducible-embed",
+			Dimension:         2,
+			RequestDimensions: requestDimensions,
+			MaxBatchInputs:    localMaxBatchInputs,
+			Collection:        "documents_local_reducible_embed",
+		})
+		if _, err := provider.CreateEmbedding(context.Background(), "三月用電量"); err != nil {
+			t.Fatalf("創建嵌入向量失敗: %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(requested, []int{0, 2}) {
+		t.Errorf("請求的 dimensions 為 %v，預期 [0 2]（0 表示未帶入）", requested)
+	}
+}
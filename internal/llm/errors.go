@@ -1,10 +1,44 @@
 package llm
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"net/http"
+)
 
 var (
 	// ErrAPIKeyNotConfigured 表示 API Key 未配置
 	ErrAPIKeyNotConfigured = errors.New("API key not configured")
+	// ErrProviderDisabled 表示提供者因缺少設定而停用，對應 HTTP 503
+	ErrProviderDisabled = errors.New("provider disabled")
+	// ErrCircuitOpen 表示提供者連續失敗，斷路器暫停呼叫，對應 HTTP 503
+	ErrCircuitOpen = errors.New("circuit breaker open")
+	// ErrBaseURLNotConfigured 表示本地伺服器的位址未配置
+	ErrBaseURLNotConfigured = errors.New("base URL not configured")
+	// ErrFakeLLMDisabled 表示假提供者未啟用
+	ErrFakeLLMDisabled = errors.New("fake LLM not enabled")
 	// ErrNoValidResponse 表示沒有有效的回應
 	ErrNoValidResponse = errors.New("no valid response generated")
+	// ErrUnknownModel 表示請求的模型不存在
+	ErrUnknownModel = errors.New("unknown model")
+	// ErrUnsupportedEmbedding 表示提供者不支援請求的嵌入類型
+	ErrUnsupportedEmbedding = errors.New("unsupported embedding type")
+	// ErrInputTooLong 表示單筆輸入超過嵌入模型的 token 上限
+	ErrInputTooLong = errors.New("input exceeds embedding model token limit")
 )
+
+// HTTPStatus 將提供者相關的錯誤對應到 HTTP 狀態碼：停用或斷路中的提供者回傳 503，逾時回傳 504，
+// 未知的模型或過長的輸入回傳 400，其餘為 500
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrProviderDisabled), errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrUnknownModel), errors.Is(err, ErrUnsupportedEmbedding),
+		errors.Is(err, ErrInputTooLong):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"ai-workshop/internal/config"
 	"context"
 	"fmt"
+	"sync"
 )
 
 // LLMType 表示支援的 LLM 類型
@@ -12,44 +13,231 @@ type LLMType string
 const (
 	LLMTypeGemini LLMType = "gemini"
 	LLMTypeOpenAI LLMType = "openai"
+	LLMTypeLocal  LLMType = "local" // 相容 OpenAI API 的本地伺服器
+	LLMTypeFake   LLMType = "fake"  // 不需要網路的假提供者，供測試使用
 )
 
+// supportedLLMTypes 列出所有可用於聊天的 LLM 類型，順序即 /api/models 的列出順序
+var supportedLLMTypes = []LLMType{LLMTypeOpenAI, LLMTypeGemini, LLMTypeLocal, LLMTypeFake}
+
 type LLMProvider interface {
 	GenerateContent(ctx context.Context, prompt string) (string, error)
-	CreateEmbedding(text string) ([]float32, error)
-	CreateBatchEmbeddings(texts []string) ([][]float32, error)
+	GenerateContentStream(ctx context.Context, prompt string) (<-chan StreamChunk, error)
+	GenerateChatContent(ctx context.Context, messages []Message) (string, error)
+	GenerateChatContentStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error)
+	CreateEmbedding(ctx context.Context, text string) ([]float32, error)
+	CreateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
 	Close()
 }
 
+// ModelInfo 描述一個可用的聊天模型
+type ModelInfo struct {
+	Type          LLMType `json:"type"`
+	ChatModel     string  `json:"chat_model"`
+	ContextWindow int     `json:"context_window"` // 提示詞與回答合計的 token 上限
+
+	BreakerState BreakerState `json:"breaker_state"` // 聊天模型斷路器的狀態，half-open 時只放行一個試探請求
+}
+
+// 各聊天模型的上下文長度（tokens），本地模型由 LOCAL_LLM_CONTEXT_WINDOW 設定
+const (
+	openAIContextWindow = 128000  // gpt-4o
+	geminiContextWindow = 1048576 // gemini-2.0-flash
+	fakeContextWindow   = 32768
+)
+
 // factory that generates more llm constructors, e.g. openAI llm constructor
+// it also acts as a registry that caches one provider per LLMType
 type Factory struct {
 	config *config.Config
+
+	mu        sync.Mutex
+	providers map[LLMType]LLMProvider
+
+	// provider availability computed once from config at startup
+	statuses map[LLMType]ProviderStatus
+
+	// embedding model used when a request does not specify one, resolved against the enabled providers
+	defaultEmbedding EmbeddingType
+
+	// retries, rate limits and circuit breakers shared by every provider
+	resilience *Resilience
+
+	// splits batch embedding requests to fit each embedding model's limits
+	batcher *EmbeddingBatcher
+
+	// content-addressed cache in front of every embedding provider
+	embeddingCache *EmbeddingCache
+
+	// receives the token usage of every provider call, nil disables usage accounting
+	usageRecorder UsageRecorder
 }
 
-// NewFactory 創建一個新的 LLM 工廠
+// NewFactory 創建一個新的 LLM 工廠，設定了本地伺服器或啟用假提供者時一併註冊對應的嵌入模型，並依 EMBEDDING_DIMENSIONS 縮減 3 系列模型的維度
 func NewFactory(config *config.Config) *Factory {
-	return &Factory{
-		config: config,
+	if config.LocalLLMBaseURL != "" && config.LocalLLMEmbeddingModel != "" && config.LocalLLMEmbeddingDimension > 0 {
+		RegisterEmbeddingModel(LocalEmbeddingModel(config.LocalLLMEmbeddingModel, config.LocalLLMEmbeddingDimension, config.LocalLLMEmbeddingMaxTokens))
+	}
+	if config.FakeLLMEnabled {
+		RegisterEmbeddingModel(FakeEmbeddingModel(config.FakeLLMEmbeddingDimension))
+	}
+	configureEmbeddingDimensions(parseEmbeddingDimensions(config.EmbeddingDimensions))
+
+	f := &Factory{
+		config:     config,
+		providers:  make(map[LLMType]LLMProvider),
+		resilience: NewResilience(NewResilienceConfig(config)),
+		batcher:    NewEmbeddingBatcher(NewBatchConfig(config)),
+
+		embeddingCache: NewEmbeddingCache(config.EmbeddingCacheSize),
+	}
+	f.statuses = f.computeStatuses()
+	f.defaultEmbedding = f.resolveDefaultEmbedding(EmbeddingType(config.DefaultEmbeddingModel))
+
+	// OpenAI 嵌入模型以 BPE 編碼精確計算 token 數，提早在背景解析編碼檔
+	if f.Enabled(LLMTypeOpenAI) {
+		WarmTokenizer(TokenizerCL100K)
 	}
+	return f
 }
 
 // a factory that generates LLM creators
+// 未設定的提供者回傳包裝 ErrProviderDisabled 的錯誤
 func (f *Factory) Create(llmType LLMType) (LLMProvider, error) {
+	if err := f.checkConfigured(llmType); err != nil {
+		return nil, err
+	}
+
 	switch llmType {
 	case LLMTypeOpenAI:
-		provider := NewOpenAiProvider(f.config.OpenAiAPIKey)
+		provider := NewOpenAiProvider(f.config.OpenAiAPIKey, f.resilience, f.batcher)
 		return provider, nil
 
 	case LLMTypeGemini:
-		provider, err := NewGeminiProvider(f.config.GeminiAPIKey)
+		provider, err := NewGeminiProvider(f.config.GeminiAPIKey, f.resilience, f.batcher)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Gemini provider: %v", err)
 		}
 		return provider, nil
 
+	case LLMTypeLocal:
+		return NewLocalProvider(f.config.LocalLLMBaseURL, f.config.LocalLLMAPIKey, f.config.LocalLLMChatModel, f.resilience, f.batcher), nil
+
+	case LLMTypeFake:
+		var responses []FakeResponse
+		if f.config.FakeLLMScript != "" {
+			loaded, err := LoadFakeResponses(f.config.FakeLLMScript)
+			if err != nil {
+				return nil, err
+			}
+			responses = loaded
+		}
+		return NewFakeProvider(responses), nil
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownModel, llmType)
+	}
+}
+
+// Get 取得指定類型的 LLM 提供者，每種類型只建立一次並快取重複使用
+// 取得的提供者由工廠管理，呼叫端不應自行 Close
+func (f *Factory) Get(llmType LLMType) (LLMProvider, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if provider, ok := f.providers[llmType]; ok {
+		return provider, nil
+	}
+
+	provider, err := f.Create(llmType)
+	if err != nil {
+		return nil, err
+	}
+	provider = newMeteredProvider(provider, llmType, f.chatModelName(llmType), f.usageRecorder)
+
+	f.providers[llmType] = provider
+	return provider, nil
+}
+
+// SetUsageRecorder 設定用量紀錄，需在取得任何提供者之前呼叫，之後建立的提供者才會記錄用量
+func (f *Factory) SetUsageRecorder(recorder UsageRecorder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.usageRecorder = recorder
+}
+
+// AvailableModels 列出已設定且能成功建立提供者的聊天模型
+// 斷路器斷開中的模型請求會直接失敗，因此不列出，冷卻結束後（half-open）再次列出
+func (f *Factory) AvailableModels() []ModelInfo {
+	models := make([]ModelInfo, 0, len(supportedLLMTypes))
+	for _, llmType := range supportedLLMTypes {
+		if !f.Enabled(llmType) {
+			continue
+		}
+		if _, err := f.Get(llmType); err != nil {
+			continue
+		}
+
+		chatModel := f.chatModelName(llmType)
+		state := f.resilience.BreakerState(llmType, chatModel)
+		if state == BreakerOpen {
+			continue
+		}
+		models = append(models, ModelInfo{
+			Type:          llmType,
+			ChatModel:     chatModel,
+			ContextWindow: f.ContextWindow(llmType),
+			BreakerState:  state,
+		})
+	}
+	return models
+}
+
+// BreakerStates 列出各 provider/model 斷路器的狀態，供健康檢查端點使用
+func (f *Factory) BreakerStates() []BreakerStatus {
+	return f.resilience.BreakerStates()
+}
+
+// Close 關閉所有快取的提供者
+func (f *Factory) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for llmType, provider := range f.providers {
+		provider.Close()
+		delete(f.providers, llmType)
+	}
+}
+
+// ContextWindow 回傳 LLM 類型的聊天模型可接受的 token 數，未知的類型回傳 0
+func (f *Factory) ContextWindow(llmType LLMType) int {
+	switch llmType {
+	case LLMTypeOpenAI:
+		return openAIContextWindow
+	case LLMTypeGemini:
+		return geminiContextWindow
+	case LLMTypeLocal:
+		return f.config.LocalLLMContextWindow
+	case LLMTypeFake:
+		return fakeContextWindow
+	default:
+		return 0
+	}
+}
+
+// chatModelName 回傳各 LLM 類型實際使用的聊天模型名稱
+func (f *Factory) chatModelName(llmType LLMType) string {
+	switch llmType {
+	case LLMTypeOpenAI:
+		return OpenAIChatModel
+	case LLMTypeGemini:
+		return GeminiChatModel
+	case LLMTypeLocal:
+		return f.config.LocalLLMChatModel
+	case LLMTypeFake:
+		return FakeChatModel
 	default:
-		msg := "No llm constructor match llmtype provided."
-		fmt.Println(msg)
-		return nil, fmt.Errorf(msg)
+		return ""
 	}
 }
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"ai-workshop/internal/config"
+)
+
+// TestAvailableModelsSkipsOpenBreaker 確認斷路器斷開中的聊天模型不會列出，冷卻結束後以 half-open 再次列出
+func TestAvailableModelsSkipsOpenBreaker(t *testing.T) {
+	f := NewFactory(&config.Config{OpenAiAPIKey: "test", FakeLLMEnabled: true})
+	f.resilience = NewResilience(ResilienceConfig{BreakerThreshold: 1, BreakerCooldown: 50 * time.Millisecond})
+
+	states := func() map[LLMType]BreakerState {
+		states := make(map[LLMType]BreakerState)
+		for _, model := range f.AvailableModels() {
+			states[model.Type] = model.BreakerState
+		}
+		return states
+	}
+
+	if got := states(); got[LLMTypeOpenAI] != BreakerClosed || got[LLMTypeFake] != BreakerClosed {
+		t.Fatalf("斷路前的模型狀態為 %v", got)
+	}
+
+	f.resilience.breaker(resilienceKey(LLMTypeOpenAI, OpenAIChatModel)).failure()
+	got := states()
+	if _, ok := got[LLMTypeOpenAI]; ok {
+		t.Errorf("斷路器斷開時仍列出 %s", LLMTypeOpenAI)
+	}
+	if got[LLMTypeFake] != BreakerClosed {
+		t.Errorf("%s 應不受影響，狀態為 %q", LLMTypeFake, got[LLMTypeFake])
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := states(); got[LLMTypeOpenAI] != BreakerHalfOpen {
+		t.Errorf("冷卻結束後 %s 的狀態為 %q，預期 %s", LLMTypeOpenAI, got[LLMTypeOpenAI], BreakerHalfOpen)
+	}
+}
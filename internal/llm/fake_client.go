@@ -0,0 +1,263 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// FakeChatModel 是假提供者回報的聊天模型名稱
+const FakeChatModel = "fake-echo"
+
+// fakeEmbeddingAPIModel 是假嵌入模型回報的模型名稱
+const fakeEmbeddingAPIModel = "fake-hash-embedding"
+
+// DefaultFakeEmbeddingDimension 是未設定維度時假嵌入向量的維度
+const DefaultFakeEmbeddingDimension = 256
+
+// FakeResponse 是一條腳本回應，最後一則使用者訊息包含 Contains 時回傳 Response
+type FakeResponse struct {
+	Contains string `json:"contains"`
+	Response string `json:"response"`
+}
+
+// FakeProvider 是不需要網路的假提供者，供 CI 與離線開發使用
+// 聊天依腳本回應，沒有符合的腳本時回傳使用者訊息；嵌入向量由文字雜湊產生，相同文字永遠得到相同向量
+type FakeProvider struct {
+	responses []FakeResponse
+}
+
+// NewFakeProvider 創建假提供者，responses 依序比對，第一條符合的腳本生效
+func NewFakeProvider(responses []FakeResponse) *FakeProvider {
+	return &FakeProvider{responses: responses}
+}
+
+// LoadFakeResponses 讀取 JSON 格式的腳本檔，內容為 FakeResponse 陣列
+func LoadFakeResponses(path string) ([]FakeResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("讀取假回應腳本失敗: %v", err)
+	}
+
+	var responses []FakeResponse
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("解析假回應腳本失敗: %v", err)
+	}
+	return responses, nil
+}
+
+// FakeEmbeddingModel 依設定產生假嵌入模型的註冊資訊
+func FakeEmbeddingModel(dimension int) EmbeddingModelInfo {
+	if dimension <= 0 {
+		dimension = DefaultFakeEmbeddingDimension
+	}
+	return EmbeddingModelInfo{
+		Type:           EmbeddingTypeFake,
+		Provider:       LLMTypeFake,
+		APIModel:       fakeEmbeddingAPIModel,
+		Dimension:      dimension,
+		MaxInputTokens: 8191,
+		Collection:     "documents_fake",
+		Description:    "以文字雜湊產生的假嵌入向量，不需要網路，供測試使用",
+	}
+}
+
+func (p *FakeProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return p.GenerateChatContent(ctx, userMessages(prompt))
+}
+
+// GenerateChatContent 依腳本回應最後一則使用者訊息
+func (p *FakeProvider) GenerateChatContent(ctx context.Context, messages []Message) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	response := p.respond(messages)
+	reportFakeUsage(ctx, messages, response)
+	return response, nil
+}
+
+func (p *FakeProvider) GenerateContentStream(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+	return p.GenerateChatContentStream(ctx, userMessages(prompt))
+}
+
+// GenerateChatContentStream 將回應以空白切段後逐段送出
+func (p *FakeProvider) GenerateChatContentStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	response := p.respond(messages)
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer reportFakeUsage(ctx, messages, response)
+
+		for _, piece := range strings.SplitAfter(response, " ") {
+			if piece == "" {
+				continue
+			}
+			if !sendChunk(ctx, chunks, StreamChunk{Content: piece}) {
+				return
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+// reportFakeUsage 以估算值回報用量，讓用量統計也能在離線環境中驗證
+func reportFakeUsage(ctx context.Context, messages []Message, response string) {
+	reportUsage(ctx, FakeChatModel, TokenUsage{
+		PromptTokens:     estimateMessageTokens(messages),
+		CompletionTokens: estimateTokens(response),
+	}, true)
+}
+
+// respond 找出第一條符合的腳本回應，沒有符合時回傳使用者訊息本身
+func (p *FakeProvider) respond(messages []Message) string {
+	var last string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			last = messages[i].Content
+			break
+		}
+	}
+
+	for _, response := range p.responses {
+		if strings.Contains(last, response.Contains) {
+			return response.Response
+		}
+	}
+	return "echo: " + last
+}
+
+// Close 假提供者不需要關閉操作
+func (p *FakeProvider) Close() {}
+
+// CreateEmbedding 創建單個文本的假嵌入向量
+func (p *FakeProvider) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return p.CreateEmbeddingWith(ctx, EmbeddingTypeFake, text)
+}
+
+// CreateBatchEmbeddings 批量創建文本的假嵌入向量
+func (p *FakeProvider) CreateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.CreateBatchEmbeddingsWith(ctx, EmbeddingTypeFake, texts)
+}
+
+// CreateEmbeddingWith 以註冊表中假嵌入模型的維度產生向量
+func (p *FakeProvider) CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dimension, err := p.GetDimensionFor(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+	reportUsage(ctx, fakeEmbeddingAPIModel, TokenUsage{EmbeddingTokens: estimateTokens(text)}, true)
+	return HashEmbedding(text, dimension), nil
+}
+
+// CreateBatchEmbeddingsWith 批量產生假嵌入向量
+func (p *FakeProvider) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dimension, err := p.GetDimensionFor(embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(texts))
+	tokens := 0
+	for i, text := range texts {
+		embeddings[i] = HashEmbedding(text, dimension)
+		tokens += estimateTokens(text)
+	}
+	reportUsage(ctx, fakeEmbeddingAPIModel, TokenUsage{EmbeddingTokens: tokens}, true)
+	return embeddings, nil
+}
+
+// GetDimensionFor 獲取假嵌入模型的維度
+func (p *FakeProvider) GetDimensionFor(embeddingType EmbeddingType) (int, error) {
+	if embeddingType != EmbeddingTypeFake {
+		return 0, fmt.Errorf("%s %w: %s", LLMTypeFake, ErrUnsupportedEmbedding, embeddingType)
+	}
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return 0, err
+	}
+	return model.Dimension, nil
+}
+
+// HashEmbedding 將文字轉成指定維度的確定性向量（已正規化為單位長度）
+// 每個詞雜湊到一個維度，共用詞越多的文字餘弦相似度越高，足以讓 RAG 在測試中檢索到相關片段
+func HashEmbedding(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+	if dimension <= 0 {
+		return vector
+	}
+
+	tokens := hashTokens(text)
+	if len(tokens) == 0 {
+		// 沒有可用的詞（例如空字串）時仍回傳非零向量，避免餘弦距離無法計算
+		tokens = []string{text}
+	}
+
+	for _, token := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(token))
+		sum := h.Sum64()
+
+		index := int(sum % uint64(dimension))
+		if sum&(1<<63) != 0 {
+			vector[index]--
+		} else {
+			vector[index]++
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
+
+// hashTokens 將文字切成小寫的英數詞，中日韓文字每個字各自成詞
+func hashTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
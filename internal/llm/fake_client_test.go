@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestFakeProviderReplies 確認沒有符合的腳本時回傳 echo，符合時回傳第一條腳本回應
+func TestFakeProviderReplies(t *testing.T) {
+	provider := NewFakeProvider([]FakeResponse{
+		{Contains: "天氣", Response: "晴天"},
+		{Contains: "天", Response: "不會用到"},
+	})
+
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{
+			name:     "echo",
+			messages: []Message{{Role: RoleUser, Content: "你好"}},
+			want:     "echo: 你好",
+		},
+		{
+			name:     "腳本",
+			messages: []Message{{Role: RoleUser, Content: "今天天氣如何"}},
+			want:     "晴天",
+		},
+		{
+			name: "只看最後一則使用者訊息",
+			messages: []Message{
+				{Role: RoleUser, Content: "今天天氣如何"},
+				{Role: RoleAssistant, Content: "晴天"},
+				{Role: RoleUser, Content: "謝謝"},
+			},
+			want: "echo: 謝謝",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := provider.GenerateChatContent(context.Background(), tt.messages)
+			if err != nil {
+				t.Fatalf("生成回應失敗: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("回應為 %q，預期 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFakeProviderEmbeddings 確認相同文字的嵌入向量每次都相同，且維度與註冊的設定一致
+func TestFakeProviderEmbeddings(t *testing.T) {
+	const dimension = 32
+	RegisterEmbeddingModel(FakeEmbeddingModel(dimension))
+
+	provider := NewFakeProvider(nil)
+	ctx := context.Background()
+
+	first, err := provider.CreateEmbedding(ctx, "三月用電量")
+	if err != nil {
+		t.Fatalf("創建嵌入向量失敗: %v", err)
+	}
+	second, err := provider.CreateEmbedding(ctx, "三月用電量")
+	if err != nil {
+		t.Fatalf("創建嵌入向量失敗: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("相同文字的嵌入向量不一致")
+	}
+	if len(first) != dimension {
+		t.Errorf("向量維度為 %d，預期 %d", len(first), dimension)
+	}
+
+	var norm float64
+	for _, v := range first {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Errorf("向量長度平方為 %f，預期為單位向量", norm)
+	}
+
+	batch, err := provider.CreateBatchEmbeddings(ctx, []string{"三月用電量", "四月用電量"})
+	if err != nil {
+		t.Fatalf("批量創建嵌入向量失敗: %v", err)
+	}
+	if len(batch) != 2 {
+		t.Fatalf("預期 2 個向量，實際 %d 個", len(batch))
+	}
+	if !reflect.DeepEqual(batch[0], first) {
+		t.Error("批量與單個創建的嵌入向量不一致")
+	}
+	for i, embedding := range batch {
+		if len(embedding) != dimension {
+			t.Errorf("第 %d 個向量維度為 %d，預期 %d", i, len(embedding), dimension)
+		}
+	}
+
+	if got := HashEmbedding("三月用電量", 7); len(got) != 7 {
+		t.Errorf("HashEmbedding 維度為 %d，預期 7", len(got))
+	}
+}
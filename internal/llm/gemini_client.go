@@ -3,20 +3,28 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
+// GeminiChatModel is the generative model used by the Gemini provider
+const GeminiChatModel = "gemini-2.0-flash"
+
 // GeminiClient represents a Gemini API client
 type GeminiClient struct {
 	client         *genai.Client
 	model          *genai.GenerativeModel
 	embeddingModel *genai.EmbeddingModel
+	embeddingName  string
+	resilience     *Resilience // retries, rate limits and circuit breaking, nil calls the API directly
+	batcher        *EmbeddingBatcher
 }
 
 // NewGeminiClient creates a new Gemini API client
-func NewGeminiProvider(apiKey string) (*GeminiClient, error) {
+func NewGeminiProvider(apiKey string, resilience *Resilience, batcher *EmbeddingBatcher) (*GeminiClient, error) {
 	// 使用配置中的 API Key
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
@@ -25,43 +33,264 @@ func NewGeminiProvider(apiKey string) (*GeminiClient, error) {
 	}
 
 	// 創建生成模型
-	model := client.GenerativeModel("gemini-2.0-flash")
+	model := client.GenerativeModel(GeminiChatModel)
 
-	// 創建嵌入模型
-	embeddingModel := client.EmbeddingModel("embedding-001")
+	// 創建嵌入模型，模型名稱取自嵌入模型註冊表
+	embeddingInfo, err := LookupEmbeddingModel(EmbeddingTypeGemini)
+	if err != nil {
+		return nil, err
+	}
+	embeddingModel := client.EmbeddingModel(embeddingInfo.APIModel)
 
 	return &GeminiClient{
 		client:         client,
 		model:          model,
 		embeddingModel: embeddingModel,
+		embeddingName:  embeddingInfo.APIModel,
+		resilience:     resilience,
+		batcher:        batcher,
 	}, nil
 }
 
 // GenerateContent generates content using the Gemini model
 func (c *GeminiClient) GenerateContent(ctx context.Context, prompt string) (string, error) {
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	return c.GenerateChatContent(ctx, userMessages(prompt))
+}
+
+// GenerateChatContent generates content from a role-tagged conversation history
+// each attempt starts a fresh session because SendMessage records the message in the history
+func (c *GeminiClient) GenerateChatContent(ctx context.Context, messages []Message) (string, error) {
+	ctx, cancel := c.resilience.WithTimeout(ctx, OpChat)
+	defer cancel()
+
+	var resp *genai.GenerateContentResponse
+	err := c.resilience.Do(ctx, LLMTypeGemini, GeminiChatModel, func(ctx context.Context) error {
+		session, last, err := c.startChat(messages)
+		if err != nil {
+			return err
+		}
+		resp, err = session.SendMessage(ctx, genai.Text(last))
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("生成內容失敗: %v", err)
+		return "", fmt.Errorf("生成內容失敗: %w", err)
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
 		return "", ErrNoValidResponse
 	}
 
-	return fmt.Sprintf("%s", resp.Candidates[0].Content.Parts[0]), nil
+	content := fmt.Sprintf("%s", resp.Candidates[0].Content.Parts[0])
+	reportGeminiUsage(ctx, resp.UsageMetadata, messages, content)
+	return content, nil
+}
+
+// GenerateContentStream streams generated content from the Gemini model
+func (c *GeminiClient) GenerateContentStream(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+	return c.GenerateChatContentStream(ctx, userMessages(prompt))
+}
+
+// GenerateChatContentStream streams generated content from a role-tagged conversation history.
+// The request is retried until the first response arrives; errors after that end the stream.
+func (c *GeminiClient) GenerateChatContentStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	// the stream timeout covers the whole stream and is released when it ends
+	ctx, cancel := c.resilience.WithTimeout(ctx, OpStream)
+
+	var iter *genai.GenerateContentResponseIterator
+	var first *genai.GenerateContentResponse
+	err := c.resilience.Do(ctx, LLMTypeGemini, GeminiChatModel, func(ctx context.Context) error {
+		session, last, err := c.startChat(messages)
+		if err != nil {
+			return err
+		}
+		iter = session.SendMessageStream(ctx, genai.Text(last))
+		first, err = iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("生成內容失敗: %w", err)
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer cancel()
+
+		// usage metadata is cumulative, the last response carries the totals
+		var content strings.Builder
+		var usage *genai.UsageMetadata
+		defer func() {
+			reportGeminiUsage(ctx, usage, messages, content.String())
+		}()
+
+		resp := first
+		for resp != nil {
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata
+			}
+			for _, cand := range resp.Candidates {
+				if cand.Content == nil {
+					continue
+				}
+				for _, part := range cand.Content.Parts {
+					text, ok := part.(genai.Text)
+					if !ok || text == "" {
+						continue
+					}
+					content.WriteString(string(text))
+					if !sendChunk(ctx, chunks, StreamChunk{Content: string(text)}) {
+						return
+					}
+				}
+			}
+
+			next, err := iter.Next()
+			if err == iterator.Done {
+				return
+			}
+			if err != nil {
+				sendChunk(ctx, chunks, StreamChunk{Err: fmt.Errorf("生成內容失敗: %w", err)})
+				return
+			}
+			resp = next
+		}
+	}()
+
+	return chunks, nil
+}
+
+// reportGeminiUsage reports the token usage of a chat call, estimating it when the
+// response carries no usage metadata
+func reportGeminiUsage(ctx context.Context, usage *genai.UsageMetadata, messages []Message, completion string) {
+	if usage != nil && usage.TotalTokenCount > 0 {
+		reportUsage(ctx, GeminiChatModel, TokenUsage{
+			PromptTokens:     int(usage.PromptTokenCount),
+			CompletionTokens: int(usage.CandidatesTokenCount),
+		}, false)
+		return
+	}
+	reportUsage(ctx, GeminiChatModel, TokenUsage{
+		PromptTokens:     estimateMessageTokens(messages),
+		CompletionTokens: estimateTokens(completion),
+	}, true)
+}
+
+// startChat builds a chat session from all but the last message and returns the
+// last message's content, which is the one to send. System messages become the
+// system instruction of a per-call copy of the model.
+func (c *GeminiClient) startChat(messages []Message) (*genai.ChatSession, string, error) {
+	if len(messages) == 0 {
+		return nil, "", fmt.Errorf("對話訊息不能為空")
+	}
+
+	model := *c.model
+	var systemParts []genai.Part
+	history := make([]*genai.Content, 0, len(messages)-1)
+	for _, msg := range messages[:len(messages)-1] {
+		switch msg.Role {
+		case RoleSystem:
+			systemParts = append(systemParts, genai.Text(msg.Content))
+		case RoleAssistant:
+			history = append(history, &genai.Content{Role: "model", Parts: []genai.Part{genai.Text(msg.Content)}})
+		default:
+			history = append(history, &genai.Content{Role: "user", Parts: []genai.Part{genai.Text(msg.Content)}})
+		}
+	}
+	if len(systemParts) > 0 {
+		model.SystemInstruction = &genai.Content{Parts: systemParts}
+	}
+
+	session := model.StartChat()
+	session.History = history
+
+	return session, messages[len(messages)-1].Content, nil
 }
 
 // CreateEmbedding creates an embedding for the given text
-func (c *GeminiClient) CreateEmbedding(text string) ([]float32, error) {
-	ctx := context.Background()
+func (c *GeminiClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	ctx, cancel := c.resilience.WithTimeout(ctx, OpEmbedding)
+	defer cancel()
+
+	return c.embed(ctx, text)
+}
+
+// CreateBatchEmbeddings creates batch embeddings for the given texts
+// 以 BatchEmbedContents 每批最多 100 筆並行送出，結果維持輸入順序，部分失敗時回傳 *BatchEmbeddingError
+func (c *GeminiClient) CreateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	model, err := LookupEmbeddingModel(EmbeddingTypeGemini)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.resilience.WithTimeout(ctx, OpBatchEmbedding)
+	defer cancel()
+
+	embeddings, err := c.batcher.Embed(ctx, model, texts, c.embedBatch)
+	if err != nil {
+		return embeddings, fmt.Errorf("批量創建嵌入向量失敗: %w", err)
+	}
+
+	return embeddings, nil
+}
+
+// embedBatch creates the embeddings of one batch in a single request
+func (c *GeminiClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if c.embeddingModel == nil {
+		return nil, fmt.Errorf("嵌入模型未初始化")
+	}
+
+	var res *genai.BatchEmbedContentsResponse
+	err := c.resilience.Do(ctx, LLMTypeGemini, c.embeddingName, func(ctx context.Context) error {
+		batch := c.embeddingModel.NewBatch()
+		for _, text := range texts {
+			batch.AddContent(genai.Text(text))
+		}
+
+		var err error
+		res, err = c.embeddingModel.BatchEmbedContents(ctx, batch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(res.Embeddings))
+	for i, embedding := range res.Embeddings {
+		if embedding == nil || len(embedding.Values) == 0 {
+			return nil, fmt.Errorf("未獲得第 %d 項的嵌入向量", i+1)
+		}
+		embeddings[i] = embedding.Values
+	}
+
+	// 嵌入 API 不回報用量，以估算值記錄
+	tokens := 0
+	for _, text := range texts {
+		tokens += estimateTokens(text)
+	}
+	reportUsage(ctx, c.embeddingName, TokenUsage{EmbeddingTokens: tokens}, true)
+
+	return embeddings, nil
+}
+
+// embed creates a single embedding
+func (c *GeminiClient) embed(ctx context.Context, text string) ([]float32, error) {
 	if c.embeddingModel == nil {
 		return nil, fmt.Errorf("嵌入模型未初始化")
 	}
 
 	// 使用Gemini的EmbedContent方法生成嵌入
-	res, err := c.embeddingModel.EmbedContent(ctx, genai.Text(text))
+	var res *genai.EmbedContentResponse
+	err := c.resilience.Do(ctx, LLMTypeGemini, c.embeddingName, func(ctx context.Context) error {
+		var err error
+		res, err = c.embeddingModel.EmbedContent(ctx, genai.Text(text))
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("生成嵌入向量失敗: %v", err)
+		return nil, fmt.Errorf("生成嵌入向量失敗: %w", err)
 	}
 
 	// 檢查嵌入是否成功生成
@@ -69,26 +298,38 @@ func (c *GeminiClient) CreateEmbedding(text string) ([]float32, error) {
 		return nil, fmt.Errorf("未獲得嵌入向量")
 	}
 
+	// 嵌入 API 不回報用量，以估算值記錄
+	reportUsage(ctx, c.embeddingName, TokenUsage{EmbeddingTokens: estimateTokens(text)}, true)
+
 	return res.Embedding.Values, nil
 }
 
-// CreateBatchEmbeddings creates batch embeddings for the given texts
-func (c *GeminiClient) CreateBatchEmbeddings(texts []string) ([][]float32, error) {
-	if c.embeddingModel == nil {
-		return nil, fmt.Errorf("嵌入模型未初始化")
+// CreateEmbeddingWith 使用指定的嵌入模型創建嵌入向量，Gemini 只支援 EmbeddingTypeGemini
+func (c *GeminiClient) CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error) {
+	if embeddingType != EmbeddingTypeGemini {
+		return nil, fmt.Errorf("Gemini %w: %s", ErrUnsupportedEmbedding, embeddingType)
 	}
+	return c.CreateEmbedding(ctx, text)
+}
 
-	// 由於Gemini API目前不支持批量嵌入，我們需要逐個處理
-	embeddings := make([][]float32, len(texts))
-	for i, text := range texts {
-		embedding, err := c.CreateEmbedding(text)
-		if err != nil {
-			return nil, fmt.Errorf("批量創建嵌入向量失敗 (第 %d 項): %v", i+1, err)
-		}
-		embeddings[i] = embedding
+// CreateBatchEmbeddingsWith 使用指定的嵌入模型批量創建嵌入向量
+func (c *GeminiClient) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error) {
+	if embeddingType != EmbeddingTypeGemini {
+		return nil, fmt.Errorf("Gemini %w: %s", ErrUnsupportedEmbedding, embeddingType)
 	}
+	return c.CreateBatchEmbeddings(ctx, texts)
+}
 
-	return embeddings, nil
+// GetDimensionFor 獲取指定嵌入模型的維度
+func (c *GeminiClient) GetDimensionFor(embeddingType EmbeddingType) (int, error) {
+	if embeddingType != EmbeddingTypeGemini {
+		return 0, fmt.Errorf("Gemini %w: %s", ErrUnsupportedEmbedding, embeddingType)
+	}
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return 0, err
+	}
+	return model.Dimension, nil
 }
 
 // Close closes the Gemini client
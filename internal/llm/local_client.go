@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// localCollectionPrefix 是本地嵌入模型的集合名稱前綴，後接模型名稱，換模型時不會寫進維度不同的集合
+const localCollectionPrefix = "documents_local_"
+
+// defaultLocalMaxInputTokens 是未設定時本地嵌入模型每筆輸入的 token 上限
+const defaultLocalMaxInputTokens = 2048
+
+// localMaxBatchInputs 是送往本地伺服器的每批筆數，本地模型通常沒有公開的上限，取較小的值避免單次請求過久
+const localMaxBatchInputs = 256
+
+// invalidCollectionChars 是 Milvus 集合名稱不允許的字元
+var invalidCollectionChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// NewLocalProvider 創建連到相容 OpenAI API 的本地伺服器（Ollama、vLLM、llama.cpp server）的提供者
+// baseURL 需包含 /v1，例如 http://localhost:11434/v1；apiKey 可為空
+func NewLocalProvider(baseURL, apiKey, chatModel string, resilience *Resilience, batcher *EmbeddingBatcher) *OpenAIProvider {
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.BaseURL = strings.TrimRight(baseURL, "/")
+	if resilience != nil {
+		clientConfig.HTTPClient = resilience.HTTPClient(LLMTypeLocal)
+	}
+
+	client := &OpenAIClient{
+		Client: openai.NewClientWithConfig(clientConfig),
+	}
+
+	return &OpenAIProvider{
+		client:           client,
+		llmType:          LLMTypeLocal,
+		chatModel:        chatModel,
+		defaultEmbedding: EmbeddingTypeLocal,
+		resilience:       resilience,
+		batcher:          batcher,
+	}
+}
+
+// LocalEmbeddingModel 依設定產生本地嵌入模型的註冊資訊，maxInputTokens 為 0 時使用 2048
+func LocalEmbeddingModel(apiModel string, dimension, maxInputTokens int) EmbeddingModelInfo {
+	if maxInputTokens <= 0 {
+		maxInputTokens = defaultLocalMaxInputTokens
+	}
+	return EmbeddingModelInfo{
+		Type:           EmbeddingTypeLocal,
+		Provider:       LLMTypeLocal,
+		APIModel:       apiModel,
+		Dimension:      dimension,
+		MaxInputTokens: maxInputTokens,
+		MaxBatchInputs: localMaxBatchInputs,
+		Collection:     localCollectionName(apiModel),
+		Description:    "本地 OpenAI 相容伺服器提供的嵌入模型",
+	}
+}
+
+// localCollectionName 將模型名稱（例如 nomic-embed-text:latest）轉成合法的集合名稱
+func localCollectionName(apiModel string) string {
+	name := invalidCollectionChars.ReplaceAllString(strings.ToLower(apiModel), "_")
+	return localCollectionPrefix + strings.Trim(name, "_")
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newLocalServer 模擬相容 OpenAI API 的本地伺服器，回傳固定的聊天回應與依輸入順序編號的嵌入向量
+func newLocalServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			var req struct {
+				Model string `json:"model"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("解析聊天請求失敗: %v", err)
+			}
+			if req.Model != "llama3.1" {
+				t.Errorf("聊天模型為 %s，預期 llama3.1", req.Model)
+			}
+			w.Write([]byte(`{
+				"id": "chatcmpl-1",
+				"object": "chat.completion",
+				"model": "llama3.1",
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "本地回應"}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7}
+			}`))
+		case "/v1/embeddings":
+			var req struct {
+				Model string   `json:"model"`
+				Input []string `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("解析嵌入請求失敗: %v", err)
+			}
+			if req.Model != "nomic-embed-text" {
+				t.Errorf("嵌入模型為 %s，預期 nomic-embed-text", req.Model)
+			}
+
+			// 以相反順序回傳，確認結果依 index 對回輸入位置
+			data := make([]map[string]interface{}, len(req.Input))
+			for i := range req.Input {
+				index := len(req.Input) - 1 - i
+				data[i] = map[string]interface{}{
+					"object":    "embedding",
+					"index":     index,
+					"embedding": []float32{float32(index), 1, 2},
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"object": "list",
+				"model":  req.Model,
+				"data":   data,
+				"usage":  map[string]int{"prompt_tokens": 3, "total_tokens": 3},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// TestLocalProvider 確認本地提供者透過 OpenAI 相容 API 完成聊天與嵌入
+func TestLocalProvider(t *testing.T) {
+	server := newLocalServer(t)
+	defer server.Close()
+
+	RegisterEmbeddingModel(LocalEmbeddingModel("nomic-embed-text", 3, 0))
+	provider := NewLocalProvider(server.URL+"/v1/", "", "llama3.1", NewResilience(ResilienceConfig{}), nil)
+	ctx := context.Background()
+
+	reply, err := provider.GenerateChatContent(ctx, []Message{{Role: RoleUser, Content: "你好"}})
+	if err != nil {
+		t.Fatalf("生成回應失敗: %v", err)
+	}
+	if reply != "本地回應" {
+		t.Errorf("回應為 %q，預期 %q", reply, "本地回應")
+	}
+
+	embedding, err := provider.CreateEmbedding(ctx, "三月用電量")
+	if err != nil {
+		t.Fatalf("創建嵌入向量失敗: %v", err)
+	}
+	if !reflect.DeepEqual(embedding, []float32{0, 1, 2}) {
+		t.Errorf("嵌入向量為 %v", embedding)
+	}
+
+	embeddings, err := provider.CreateBatchEmbeddingsWith(ctx, EmbeddingTypeLocal, []string{"一月", "二月", "三月"})
+	if err != nil {
+		t.Fatalf("批量創建嵌入向量失敗: %v", err)
+	}
+	for i, embedding := range embeddings {
+		if len(embedding) != 3 || embedding[0] != float32(i) {
+			t.Errorf("第 %d 個嵌入向量為 %v，未對回輸入位置", i, embedding)
+		}
+	}
+
+	dimension, err := provider.GetDimensionFor(EmbeddingTypeLocal)
+	if err != nil {
+		t.Fatalf("獲取維度失敗: %v", err)
+	}
+	if dimension != 3 {
+		t.Errorf("維度為 %d，預期 3", dimension)
+	}
+}
+
+// TestLocalEmbeddingMaxInputTokens 確認本地嵌入模型的 token 上限可設定，超過上限的輸入不會送出
+func TestLocalEmbeddingMaxInputTokens(t *testing.T) {
+	if got := LocalEmbeddingModel("nomic-embed-text", 3, 0).MaxInputTokens; got != defaultLocalMaxInputTokens {
+		t.Errorf("未設定時上限為 %d，預期 %d", got, defaultLocalMaxInputTokens)
+	}
+
+	server := newLocalServer(t)
+	defer server.Close()
+
+	RegisterEmbeddingModel(LocalEmbeddingModel("nomic-embed-text", 3, 8))
+	defer RegisterEmbeddingModel(LocalEmbeddingModel("nomic-embed-text", 3, 0))
+	provider := NewLocalProvider(server.URL+"/v1", "", "llama3.1", NewResilience(ResilienceConfig{}), nil)
+
+	_, err := provider.CreateBatchEmbeddingsWith(context.Background(), EmbeddingTypeLocal, []string{
+		"短文字",
+		strings.Repeat("electricity usage report ", 20),
+	})
+	if !errors.Is(err, ErrInputTooLong) {
+		t.Fatalf("預期 ErrInputTooLong，實際 %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package llm
+
+// MessageRole 表示對話訊息的角色
+type MessageRole string
+
+const (
+	RoleSystem    MessageRole = "system"
+	RoleUser      MessageRole = "user"
+	RoleAssistant MessageRole = "assistant"
+)
+
+// Message 是帶有角色的單則對話訊息，多則訊息依序組成完整的對話歷史
+type Message struct {
+	Role    MessageRole `json:"role"`
+	Content string      `json:"content"`
+}
+
+// userMessages 將單一提示詞包裝成只有一則使用者訊息的對話
+func userMessages(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
+}
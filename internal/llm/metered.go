@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// meteredProvider 在每次呼叫結束後把提供者回報的用量、模型與延遲交給 UsageRecorder
+// 嵌入快取包在它外面，因此命中快取的文字不會被記錄
+type meteredProvider struct {
+	provider  LLMProvider
+	llmType   LLMType
+	chatModel string
+	recorder  UsageRecorder
+}
+
+// newMeteredProvider 包裝提供者，recorder 為 nil 時原樣返回
+func newMeteredProvider(provider LLMProvider, llmType LLMType, chatModel string, recorder UsageRecorder) LLMProvider {
+	if recorder == nil {
+		return provider
+	}
+	return &meteredProvider{
+		provider:  provider,
+		llmType:   llmType,
+		chatModel: chatModel,
+		recorder:  recorder,
+	}
+}
+
+// record 執行一次呼叫並記錄用量，提供者沒有回報模型時使用 model
+func (p *meteredProvider) record(ctx context.Context, op Operation, model string, call func(ctx context.Context) error) error {
+	started := time.Now()
+	meteredCtx, collector := withUsageCollector(ctx)
+
+	err := call(meteredCtx)
+
+	event := collector.event(p.llmType, op, started, err)
+	if event.Model == "" {
+		event.Model = model
+	}
+	p.recorder.RecordUsage(ctx, event)
+	return err
+}
+
+func (p *meteredProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return p.GenerateChatContent(ctx, userMessages(prompt))
+}
+
+func (p *meteredProvider) GenerateChatContent(ctx context.Context, messages []Message) (string, error) {
+	var content string
+	err := p.record(ctx, OpChat, p.chatModel, func(ctx context.Context) error {
+		var err error
+		content, err = p.provider.GenerateChatContent(ctx, messages)
+		return err
+	})
+	return content, err
+}
+
+func (p *meteredProvider) GenerateContentStream(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+	return p.GenerateChatContentStream(ctx, userMessages(prompt))
+}
+
+// GenerateChatContentStream 轉送串流片段，串流結束（含中斷）時才記錄用量與整個串流的延遲
+func (p *meteredProvider) GenerateChatContentStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	started := time.Now()
+	meteredCtx, collector := withUsageCollector(ctx)
+
+	source, err := p.provider.GenerateChatContentStream(meteredCtx, messages)
+	if err != nil {
+		event := collector.event(p.llmType, OpStream, started, err)
+		event.Model = p.chatModel
+		p.recorder.RecordUsage(ctx, event)
+		return nil, err
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+
+		var streamErr error
+		for chunk := range source {
+			if chunk.Err != nil {
+				streamErr = chunk.Err
+			}
+			if !sendChunk(ctx, chunks, chunk) {
+				// 呼叫端已離開，提供者會因 ctx 取消而結束，繼續讀完以取得最後回報的用量
+				streamErr = ctx.Err()
+				for range source {
+				}
+				break
+			}
+		}
+
+		event := collector.event(p.llmType, OpStream, started, streamErr)
+		if event.Model == "" {
+			event.Model = p.chatModel
+		}
+		p.recorder.RecordUsage(ctx, event)
+	}()
+
+	return chunks, nil
+}
+
+func (p *meteredProvider) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	var embedding []float32
+	err := p.record(ctx, OpEmbedding, "", func(ctx context.Context) error {
+		var err error
+		embedding, err = p.provider.CreateEmbedding(ctx, text)
+		return err
+	})
+	return embedding, err
+}
+
+func (p *meteredProvider) CreateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	var embeddings [][]float32
+	err := p.record(ctx, OpBatchEmbedding, "", func(ctx context.Context) error {
+		var err error
+		embeddings, err = p.provider.CreateBatchEmbeddings(ctx, texts)
+		return err
+	})
+	return embeddings, err
+}
+
+func (p *meteredProvider) CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error) {
+	embedder, err := p.embedder()
+	if err != nil {
+		return nil, err
+	}
+
+	var embedding []float32
+	err = p.record(ctx, OpEmbedding, embeddingAPIModel(embeddingType), func(ctx context.Context) error {
+		var err error
+		embedding, err = embedder.CreateEmbeddingWith(ctx, embeddingType, text)
+		return err
+	})
+	return embedding, err
+}
+
+func (p *meteredProvider) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error) {
+	embedder, err := p.embedder()
+	if err != nil {
+		return nil, err
+	}
+
+	var embeddings [][]float32
+	err = p.record(ctx, OpBatchEmbedding, embeddingAPIModel(embeddingType), func(ctx context.Context) error {
+		var err error
+		embeddings, err = embedder.CreateBatchEmbeddingsWith(ctx, embeddingType, texts)
+		return err
+	})
+	return embeddings, err
+}
+
+func (p *meteredProvider) GetDimensionFor(embeddingType EmbeddingType) (int, error) {
+	embedder, err := p.embedder()
+	if err != nil {
+		return 0, err
+	}
+	return embedder.GetDimensionFor(embeddingType)
+}
+
+func (p *meteredProvider) Close() {
+	p.provider.Close()
+}
+
+// embedder 取得被包裝提供者的嵌入介面
+func (p *meteredProvider) embedder() (EmbeddingProvider, error) {
+	embedder, ok := p.provider.(EmbeddingProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s 不支援嵌入向量", p.llmType)
+	}
+	return embedder, nil
+}
+
+// embeddingAPIModel 回傳嵌入類型在 API 中的模型名稱，找不到時回傳類型本身
+func embeddingAPIModel(embeddingType EmbeddingType) string {
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return string(embeddingType)
+	}
+	return model.APIModel
+}
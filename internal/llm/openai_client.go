@@ -2,32 +2,23 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-type EmbeddingModelType string
-
-const (
-	EmbeddingModelTypeAda002 EmbeddingModelType = "ada-002"
-	EmbeddingModelType3Small EmbeddingModelType = "3-small"
-	EmbeddingModelType3Large EmbeddingModelType = "3-large"
-	EmbeddingModelTypeGemini EmbeddingModelType = "gemini"
-)
-
 // OpenAIClient represents an OpenAI API client
 type OpenAIClient struct {
-	Client    *openai.Client
-	ModelType EmbeddingModelType // 添加modelType欄位
+	Client *openai.Client
 }
 
-const (
-	OpenAIModelDimension = 1536 // OpenAI text-embedding-ada-002 的維度
-	GeminiModelDimension = 768  // Google Gemini Embedding 的維度
-)
+// OpenAIChatModel 是 OpenAI 提供者使用的聊天模型
+const OpenAIChatModel = openai.GPT4o
 
-// EmbeddingType 表示支援的嵌入模型類型
+// EmbeddingType 表示支援的嵌入模型類型，各類型的模型資訊見 embedding_models.go
 type EmbeddingType string
 
 const (
@@ -35,38 +26,63 @@ const (
 	EmbeddingTypeGemini       EmbeddingType = "gemini-embedding"
 	EmbeddingTypeOpenAI3Small EmbeddingType = "openai-3-small"
 	EmbeddingTypeOpenAI3Large EmbeddingType = "openai-3-large"
+	EmbeddingTypeLocal        EmbeddingType = "local-embedding"
+	EmbeddingTypeFake         EmbeddingType = "fake-embedding"
 )
 
-// OpenAIProvider 是 OpenAI 客戶端適配器
+// OpenAIProvider 是 OpenAI 客戶端適配器，也用於相容 OpenAI API 的本地伺服器
 type OpenAIProvider struct {
 	client *OpenAIClient
+
+	llmType          LLMType       // 註冊表中屬於此提供者的嵌入模型
+	chatModel        string        // 聊天使用的模型
+	defaultEmbedding EmbeddingType // CreateEmbedding 使用的嵌入類型
+	resilience       *Resilience   // 重試、限流與斷路，nil 時直接呼叫 API
+	batcher          *EmbeddingBatcher
 }
 
-func NewOpenAiProvider(apiKey string) *OpenAIProvider {
-	openAIClient := openai.NewClient(apiKey)
+func NewOpenAiProvider(apiKey string, resilience *Resilience, batcher *EmbeddingBatcher) *OpenAIProvider {
+	clientConfig := openai.DefaultConfig(apiKey)
+	if resilience != nil {
+		clientConfig.HTTPClient = resilience.HTTPClient(LLMTypeOpenAI)
+	}
+	openAIClient := openai.NewClientWithConfig(clientConfig)
 
 	client := &OpenAIClient{
 		Client: openAIClient,
 	}
 
 	return &OpenAIProvider{
-		client: client,
+		client:           client,
+		llmType:          LLMTypeOpenAI,
+		chatModel:        OpenAIChatModel,
+		defaultEmbedding: EmbeddingTypeOpenAI,
+		resilience:       resilience,
+		batcher:          batcher,
 	}
 }
 
 func (p *OpenAIProvider) GenerateContent(ctx context.Context, prompt string) (string, error) {
+	return p.GenerateChatContent(ctx, userMessages(prompt))
+}
+
+// GenerateChatContent 以完整的對話歷史生成內容
+func (p *OpenAIProvider) GenerateChatContent(ctx context.Context, messages []Message) (string, error) {
 	req := openai.ChatCompletionRequest{
-		Model: openai.GPT4o,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-	}
-	resp, err := p.client.Client.CreateChatCompletion(ctx, req)
+		Model:    p.chatModel,
+		Messages: toOpenAIMessages(messages),
+	}
+	ctx, cancel := p.resilience.WithTimeout(ctx, OpChat)
+	defer cancel()
+
+	var resp openai.ChatCompletionResponse
+	err := p.resilience.Do(ctx, p.llmType, p.chatModel, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.Client.CreateChatCompletion(ctx, req)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("生成內容失敗: %v", err)
+		return "", fmt.Errorf("生成內容失敗: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -74,7 +90,111 @@ func (p *OpenAIProvider) GenerateContent(ctx context.Context, prompt string) (st
 		return "", fmt.Errorf("No valid responses")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	content := resp.Choices[0].Message.Content
+	p.reportChatUsage(ctx, resp.Usage, messages, content)
+	return content, nil
+}
+
+// GenerateContentStream 以串流方式生成內容，逐段回傳模型輸出
+func (p *OpenAIProvider) GenerateContentStream(ctx context.Context, prompt string) (<-chan StreamChunk, error) {
+	return p.GenerateChatContentStream(ctx, userMessages(prompt))
+}
+
+// GenerateChatContentStream 以完整的對話歷史串流生成內容
+func (p *OpenAIProvider) GenerateChatContentStream(ctx context.Context, messages []Message) (<-chan StreamChunk, error) {
+	req := openai.ChatCompletionRequest{
+		Model:    p.chatModel,
+		Messages: toOpenAIMessages(messages),
+	}
+	// 要求 OpenAI 在最後一個片段回報用量；本地伺服器不一定支援此參數，改用估算值
+	if p.llmType == LLMTypeOpenAI {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	// 串流逾時涵蓋整個串流，串流結束時才取消
+	ctx, cancel := p.resilience.WithTimeout(ctx, OpStream)
+
+	// 只重試建立串流，開始接收後的錯誤直接結束串流
+	var stream *openai.ChatCompletionStream
+	err := p.resilience.Do(ctx, p.llmType, p.chatModel, func(ctx context.Context) error {
+		var err error
+		stream, err = p.client.Client.CreateChatCompletionStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("建立串流失敗: %w", err)
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer cancel()
+		defer stream.Close()
+
+		// 用量在關閉通道前回報，串流中斷時以已收到的內容估算
+		var content strings.Builder
+		var usage openai.Usage
+		defer func() {
+			p.reportChatUsage(ctx, usage, messages, content.String())
+		}()
+
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				sendChunk(ctx, chunks, StreamChunk{Err: fmt.Errorf("接收串流失敗: %w", err)})
+				return
+			}
+			if resp.Usage != nil {
+				usage = *resp.Usage
+			}
+			if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+				continue
+			}
+			content.WriteString(resp.Choices[0].Delta.Content)
+			if !sendChunk(ctx, chunks, StreamChunk{Content: resp.Choices[0].Delta.Content}) {
+				return
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+// reportChatUsage 回報聊天用量，伺服器沒有回傳用量時以本地估算值代替
+func (p *OpenAIProvider) reportChatUsage(ctx context.Context, usage openai.Usage, messages []Message, completion string) {
+	if usage.TotalTokens > 0 {
+		reportUsage(ctx, p.chatModel, TokenUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+		}, false)
+		return
+	}
+	reportUsage(ctx, p.chatModel, TokenUsage{
+		PromptTokens:     estimateMessageTokens(messages),
+		CompletionTokens: estimateTokens(completion),
+	}, true)
+}
+
+// toOpenAIMessages 將對話訊息轉換為 OpenAI 的訊息格式
+func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessage {
+	result := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		role := openai.ChatMessageRoleUser
+		switch msg.Role {
+		case RoleSystem:
+			role = openai.ChatMessageRoleSystem
+		case RoleAssistant:
+			role = openai.ChatMessageRoleAssistant
+		}
+		result[i] = openai.ChatCompletionMessage{
+			Role:    role,
+			Content: msg.Content,
+		}
+	}
+	return result
 }
 
 // Close 關閉客戶端
@@ -83,54 +203,87 @@ func (p *OpenAIProvider) Close() {
 }
 
 // CreateEmbedding 創建單個文本的嵌入向量
-func (s *OpenAIProvider) CreateEmbedding(text string) ([]float32, error) {
-	return s.CreateEmbeddingWith(EmbeddingTypeOpenAI, text)
+func (s *OpenAIProvider) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return s.CreateEmbeddingWith(ctx, s.defaultEmbedding, text)
 }
 
 // CreateEmbeddingWith 使用指定的嵌入模型創建嵌入向量
-func (s *OpenAIProvider) CreateEmbeddingWith(embeddingType EmbeddingType, text string) ([]float32, error) {
-	model := s.getModelForType(embeddingType)
-
-	resp, err := s.client.Client.CreateEmbeddings(
-		context.Background(),
-		openai.EmbeddingRequest{
-			Input: []string{text},
-			Model: model,
-		},
-	)
+func (s *OpenAIProvider) CreateEmbeddingWith(ctx context.Context, embeddingType EmbeddingType, text string) ([]float32, error) {
+	model, err := s.embeddingModel(embeddingType)
 	if err != nil {
-		return nil, fmt.Errorf("創建嵌入向量失敗: %v", err)
+		return nil, err
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("未獲得嵌入向量")
+	ctx, cancel := s.resilience.WithTimeout(ctx, OpEmbedding)
+	defer cancel()
+
+	embeddings, err := s.embedBatch(ctx, model, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("創建嵌入向量失敗: %w", err)
 	}
 
-	return resp.Data[0].Embedding, nil
+	return embeddings[0], nil
 }
 
 // CreateBatchEmbeddings 批量創建文本的嵌入向量
-func (s *OpenAIProvider) CreateBatchEmbeddings(texts []string) ([][]float32, error) {
-	return s.CreateBatchEmbeddingsWith(EmbeddingTypeOpenAI, texts)
+func (s *OpenAIProvider) CreateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return s.CreateBatchEmbeddingsWith(ctx, s.defaultEmbedding, texts)
 }
 
 // CreateBatchEmbeddingsWith 使用指定的嵌入模型批量創建嵌入向量
-func (s *OpenAIProvider) CreateBatchEmbeddingsWith(embeddingType EmbeddingType, texts []string) ([][]float32, error) {
-	model := s.getModelForType(embeddingType)
-
-	resp, err := s.client.Client.CreateEmbeddings(
-		context.Background(),
-		openai.EmbeddingRequest{
-			Input: texts,
-			Model: model,
-		},
-	)
+// 輸入依模型的筆數與 token 上限切成多個請求並行送出，結果維持輸入順序，部分失敗時回傳 *BatchEmbeddingError
+func (s *OpenAIProvider) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType EmbeddingType, texts []string) ([][]float32, error) {
+	model, err := s.embeddingModel(embeddingType)
 	if err != nil {
-		return nil, fmt.Errorf("批量創建嵌入向量失敗: %v", err)
+		return nil, err
 	}
-	embeddings := make([][]float32, len(resp.Data))
-	for i, data := range resp.Data {
-		embeddings[i] = data.Embedding
+
+	ctx, cancel := s.resilience.WithTimeout(ctx, OpBatchEmbedding)
+	defer cancel()
+
+	embeddings, err := s.batcher.Embed(ctx, model, texts, func(ctx context.Context, batch []string) ([][]float32, error) {
+		return s.embedBatch(ctx, model, batch)
+	})
+	if err != nil {
+		return embeddings, fmt.Errorf("批量創建嵌入向量失敗: %w", err)
+	}
+
+	return embeddings, nil
+}
+
+// embedBatch 以單一請求創建一批嵌入向量，依回應中的 index 對回輸入位置
+func (s *OpenAIProvider) embedBatch(ctx context.Context, model EmbeddingModelInfo, texts []string) ([][]float32, error) {
+	var resp openai.EmbeddingResponse
+	err := s.resilience.Do(ctx, s.llmType, model.APIModel, func(ctx context.Context) error {
+		var err error
+		resp, err = s.client.Client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input:      texts,
+			Model:      openai.EmbeddingModel(model.APIModel),
+			Dimensions: model.RequestDimensions,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Usage.PromptTokens > 0 {
+		reportUsage(ctx, model.APIModel, TokenUsage{EmbeddingTokens: resp.Usage.PromptTokens}, false)
+	} else {
+		reportUsage(ctx, model.APIModel, TokenUsage{EmbeddingTokens: estimateTextsTokens(model, texts)}, true)
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("嵌入向量的 index 超出範圍: %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("未獲得第 %d 項的嵌入向量", i+1)
+		}
 	}
 
 	return embeddings, nil
@@ -138,29 +291,21 @@ func (s *OpenAIProvider) CreateBatchEmbeddingsWith(embeddingType EmbeddingType,
 
 // GetDimensionFor 獲取指定嵌入模型的維度
 func (s *OpenAIProvider) GetDimensionFor(embeddingType EmbeddingType) (int, error) {
-	switch embeddingType {
-	case EmbeddingTypeOpenAI, EmbeddingTypeOpenAI3Large:
-		return OpenAIModelDimension, nil
-	case EmbeddingTypeOpenAI3Small:
-		return 1536, nil // OpenAI-3-Small 維度
-	case EmbeddingTypeGemini:
-		return GeminiModelDimension, nil
-	default:
-		return 0, fmt.Errorf("不支援的嵌入模型類型: %s", embeddingType)
-	}
-}
-
-// getModelForType 根據嵌入類型獲取實際的模型名稱
-func (s *OpenAIProvider) getModelForType(embeddingType EmbeddingType) openai.EmbeddingModel {
-	switch embeddingType {
-	case EmbeddingTypeOpenAI:
-		return openai.AdaEmbeddingV2
-	case EmbeddingTypeOpenAI3Small:
-		return openai.EmbeddingModel("text-embedding-3-small")
-	case EmbeddingTypeOpenAI3Large:
-		return openai.EmbeddingModel("text-embedding-3-large")
-	default:
-		// 默認使用OpenAI的Ada-002
-		return openai.AdaEmbeddingV2
+	model, err := s.embeddingModel(embeddingType)
+	if err != nil {
+		return 0, err
+	}
+	return model.Dimension, nil
+}
+
+// embeddingModel 從模型註冊表取得屬於此提供者的嵌入模型
+func (s *OpenAIProvider) embeddingModel(embeddingType EmbeddingType) (EmbeddingModelInfo, error) {
+	model, err := LookupEmbeddingModel(embeddingType)
+	if err != nil {
+		return EmbeddingModelInfo{}, err
+	}
+	if model.Provider != s.llmType {
+		return EmbeddingModelInfo{}, fmt.Errorf("%s %w: %s", s.llmType, ErrUnsupportedEmbedding, embeddingType)
 	}
+	return model, nil
 }
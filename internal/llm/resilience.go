@@ -0,0 +1,457 @@
+package llm
+
+import (
+	"ai-workshop/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+)
+
+// maxRetryAfter 是 Retry-After 的上限，避免伺服器回傳過長的等待時間卡住請求
+const maxRetryAfter = 2 * time.Minute
+
+// Operation 是提供者呼叫的種類，各自有獨立的逾時設定
+type Operation string
+
+const (
+	OpChat           Operation = "chat"            // 一次完整的聊天回應
+	OpStream         Operation = "stream"          // 整個串流回應
+	OpEmbedding      Operation = "embedding"       // 單一文本的嵌入向量
+	OpBatchEmbedding Operation = "batch_embedding" // 一批文本的嵌入向量
+)
+
+// ResilienceConfig 是所有提供者共用的重試、限流、斷路與逾時設定
+type ResilienceConfig struct {
+	MaxAttempts int           // 每次呼叫最多嘗試的次數（含第一次）
+	BaseDelay   time.Duration // 第一次重試前的基本等待時間，之後每次加倍
+	MaxDelay    time.Duration // 單次退避等待的上限
+
+	RateLimit  float64            // 每個 provider/model 每秒可送出的請求數，0 表示不限制
+	RateBurst  int                // 令牌桶容量
+	RateLimits map[string]float64 // 個別覆寫，鍵為 provider/model 或 provider
+
+	BreakerThreshold int           // 連續失敗幾次後斷開，0 表示停用斷路器
+	BreakerCooldown  time.Duration // 斷開後多久放行試探請求
+
+	Timeouts map[Operation]time.Duration // 各種呼叫的逾時（含重試），0 表示不限制
+}
+
+// NewResilienceConfig 從應用程式設定建立韌性設定
+func NewResilienceConfig(appConfig *config.Config) ResilienceConfig {
+	return ResilienceConfig{
+		MaxAttempts:      appConfig.LLMMaxAttempts,
+		BaseDelay:        appConfig.LLMRetryBaseDelay,
+		MaxDelay:         appConfig.LLMRetryMaxDelay,
+		RateLimit:        appConfig.LLMRateLimit,
+		RateBurst:        appConfig.LLMRateBurst,
+		RateLimits:       parseRateLimits(appConfig.LLMRateLimits),
+		BreakerThreshold: appConfig.LLMBreakerThreshold,
+		BreakerCooldown:  appConfig.LLMBreakerCooldown,
+		Timeouts: map[Operation]time.Duration{
+			OpChat:           appConfig.LLMChatTimeout,
+			OpStream:         appConfig.LLMStreamTimeout,
+			OpEmbedding:      appConfig.LLMEmbeddingTimeout,
+			OpBatchEmbedding: appConfig.LLMBatchEmbeddingTimeout,
+		},
+	}
+}
+
+// parseRateLimits 解析 "openai/text-embedding-3-small=50,gemini=5" 格式的個別限流設定
+func parseRateLimits(raw string) map[string]float64 {
+	limits := make(map[string]float64)
+	for _, entry := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		limit, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			log.Printf("忽略無效的限流設定 %q: %v", entry, err)
+			continue
+		}
+		limits[strings.TrimSpace(key)] = limit
+	}
+	return limits
+}
+
+// Resilience 為所有提供者的 API 呼叫加上重試（指數退避加抖動，遵守 Retry-After）、
+// 以 provider/model 為單位的令牌桶限流，以及連續失敗後斷開的斷路器
+type Resilience struct {
+	config ResilienceConfig
+	clock  clock
+
+	mu        sync.Mutex
+	limiters  map[string]*rate.Limiter
+	breakers  map[string]*circuitBreaker
+	cooldowns map[LLMType]time.Time // 伺服器以 Retry-After 要求暫停到的時間
+}
+
+// NewResilience 建立韌性層，未設定的欄位使用預設值
+func NewResilience(cfg ResilienceConfig) *Resilience {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = 500 * time.Millisecond
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		cfg.MaxDelay = cfg.BaseDelay
+	}
+	if cfg.RateBurst <= 0 {
+		cfg.RateBurst = 1
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+
+	return &Resilience{
+		config:    cfg,
+		clock:     realClock{},
+		limiters:  make(map[string]*rate.Limiter),
+		breakers:  make(map[string]*circuitBreaker),
+		cooldowns: make(map[LLMType]time.Time),
+	}
+}
+
+// Do 以限流、斷路器與重試執行一次提供者呼叫，r 為 nil 時直接呼叫
+// 只有 429、5xx 與網路錯誤會重試並計入斷路器，其餘錯誤直接回傳
+func (r *Resilience) Do(ctx context.Context, llmType LLMType, model string, call func(ctx context.Context) error) error {
+	if r == nil {
+		return call(ctx)
+	}
+
+	key := resilienceKey(llmType, model)
+	breaker := r.breaker(key)
+	limiter := r.limiter(llmType, model)
+
+	for attempt := 1; ; attempt++ {
+		if err := r.waitCooldown(ctx, llmType); err != nil {
+			return err
+		}
+		if err := r.waitToken(ctx, limiter); err != nil {
+			return err
+		}
+		if err := breaker.allow(); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		err := call(ctx)
+		if err == nil {
+			breaker.success()
+			return nil
+		}
+		if ctx.Err() != nil {
+			breaker.release()
+			return err
+		}
+
+		retryable, retryAfter := classifyError(err)
+		if !retryable {
+			breaker.success()
+			return err
+		}
+		breaker.failure()
+		if attempt >= r.config.MaxAttempts {
+			return err
+		}
+
+		delay := r.backoff(attempt)
+		if retryAfter > delay {
+			delay = min(retryAfter, maxRetryAfter)
+		}
+		if remaining := r.cooldownRemaining(llmType); remaining > delay {
+			delay = remaining
+		}
+		log.Printf("%s 呼叫失敗（第 %d 次），%s 後重試: %v", key, attempt, delay, err)
+		if err := r.clock.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// WithTimeout 依呼叫種類為 ctx 加上逾時，逾時涵蓋所有重試；r 為 nil 或未設定逾時時原樣返回
+func (r *Resilience) WithTimeout(ctx context.Context, op Operation) (context.Context, context.CancelFunc) {
+	if r == nil || r.config.Timeouts[op] <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.config.Timeouts[op])
+}
+
+// HTTPClient 回傳會記錄 Retry-After 的 HTTP 客戶端，供以 HTTP 呼叫的提供者使用
+func (r *Resilience) HTTPClient(llmType LLMType) *http.Client {
+	return &http.Client{
+		Transport: &retryAfterTransport{
+			base:       http.DefaultTransport,
+			resilience: r,
+			llmType:    llmType,
+		},
+	}
+}
+
+// BreakerStates 列出所有已建立的斷路器狀態，依鍵排序
+func (r *Resilience) BreakerStates() []BreakerStatus {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.breakers))
+	breakers := make(map[string]*circuitBreaker, len(r.breakers))
+	for key, breaker := range r.breakers {
+		keys = append(keys, key)
+		breakers[key] = breaker
+	}
+	r.mu.Unlock()
+
+	sort.Strings(keys)
+	states := make([]BreakerStatus, len(keys))
+	for i, key := range keys {
+		states[i] = breakers[key].status(key)
+	}
+	return states
+}
+
+// BreakerState 回傳 provider/model 斷路器目前的狀態，尚未呼叫過的模型為 closed
+func (r *Resilience) BreakerState(llmType LLMType, model string) BreakerState {
+	if r == nil {
+		return BreakerClosed
+	}
+
+	r.mu.Lock()
+	breaker, ok := r.breakers[resilienceKey(llmType, model)]
+	r.mu.Unlock()
+	if !ok {
+		return BreakerClosed
+	}
+	return breaker.currentState()
+}
+
+// breaker 取得 provider/model 的斷路器，不存在時建立
+func (r *Resilience) breaker(key string) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breaker, ok := r.breakers[key]
+	if !ok {
+		breaker = newCircuitBreaker(r.config.BreakerThreshold, r.config.BreakerCooldown, r.clock)
+		r.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// limiter 取得 provider/model 的令牌桶，速率依序取 provider/model、provider 的個別設定與預設值
+func (r *Resilience) limiter(llmType LLMType, model string) *rate.Limiter {
+	key := resilienceKey(llmType, model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiter, ok := r.limiters[key]
+	if ok {
+		return limiter
+	}
+
+	limit, ok := r.config.RateLimits[key]
+	if !ok {
+		limit, ok = r.config.RateLimits[string(llmType)]
+	}
+	if !ok {
+		limit = r.config.RateLimit
+	}
+
+	every := rate.Inf
+	if limit > 0 {
+		every = rate.Limit(limit)
+	}
+	limiter = rate.NewLimiter(every, r.config.RateBurst)
+	r.limiters[key] = limiter
+	return limiter
+}
+
+// waitToken 從令牌桶取得一個令牌，需要等待時以 clock 等待，ctx 取消時歸還令牌
+func (r *Resilience) waitToken(ctx context.Context, limiter *rate.Limiter) error {
+	now := r.clock.Now()
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return fmt.Errorf("限流設定不允許送出請求")
+	}
+
+	if err := r.clock.Sleep(ctx, reservation.DelayFrom(now)); err != nil {
+		reservation.CancelAt(r.clock.Now())
+		return err
+	}
+	return nil
+}
+
+// deferProvider 依 Retry-After 暫停提供者的所有請求
+func (r *Resilience) deferProvider(llmType LLMType, delay time.Duration) {
+	until := r.clock.Now().Add(min(delay, maxRetryAfter))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if until.After(r.cooldowns[llmType]) {
+		r.cooldowns[llmType] = until
+	}
+}
+
+// cooldownRemaining 回傳距離 Retry-After 要求的時間還有多久
+func (r *Resilience) cooldownRemaining(llmType LLMType) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cooldowns[llmType].Sub(r.clock.Now())
+}
+
+// waitCooldown 等待到 Retry-After 要求的時間
+func (r *Resilience) waitCooldown(ctx context.Context, llmType LLMType) error {
+	return r.clock.Sleep(ctx, r.cooldownRemaining(llmType))
+}
+
+// backoff 回傳第 attempt 次失敗後的等待時間：指數成長並取上限後，在後半段隨機抖動
+func (r *Resilience) backoff(attempt int) time.Duration {
+	delay := r.config.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > r.config.MaxDelay {
+		delay = r.config.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// resilienceKey 是限流與斷路器的鍵
+func resilienceKey(llmType LLMType, model string) string {
+	return string(llmType) + "/" + model
+}
+
+// clock 提供目前時間與等待，測試中以假時鐘取代，不必真的等待退避與冷卻時間
+type clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// realClock 使用系統時間
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleepContext(ctx, d)
+}
+
+// sleepContext 等待 d，ctx 取消時提前返回錯誤
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// classifyError 判斷錯誤是否可重試，並取出伺服器建議的等待時間
+func classifyError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode), 0
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return retryableStatus(requestErr.HTTPStatusCode), 0
+	}
+
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return retryableStatus(googleErr.Code), parseRetryAfter(googleErr.Header.Get("Retry-After"))
+	}
+	var gaxErr *apierror.APIError
+	if errors.As(err, &gaxErr) {
+		var delay time.Duration
+		if info := gaxErr.Details().RetryInfo; info != nil {
+			delay = info.GetRetryDelay().AsDuration()
+		}
+		if code := gaxErr.HTTPCode(); code > 0 {
+			return retryableStatus(code), delay
+		}
+		switch gaxErr.GRPCStatus().Code() {
+		case codes.ResourceExhausted, codes.Unavailable, codes.Internal:
+			return true, delay
+		}
+		return false, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// retryableStatus 判斷 HTTP 狀態碼是否值得重試
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// parseRetryAfter 解析 Retry-After 標頭，支援秒數與 HTTP 日期
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// retryAfterTransport 在收到 429 或 503 時記錄 Retry-After，讓同一提供者的後續請求一併等待
+type retryAfterTransport struct {
+	base       http.RoundTripper
+	resilience *Resilience
+	llmType    LLMType
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay := parseRetryAfter(resp.Header.Get("Retry-After")); delay > 0 {
+			t.resilience.deferProvider(t.llmType, delay)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,325 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeClock 是測試用的時鐘，Sleep 立即推進時間並記錄等待的長度
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// newTestResilience 建立使用假時鐘的韌性層
+func newTestResilience(cfg ResilienceConfig) (*Resilience, *fakeClock) {
+	r := NewResilience(cfg)
+	clock := newFakeClock()
+	r.clock = clock
+	return r, clock
+}
+
+// timeoutError 是會被視為網路錯誤的逾時
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func apiError(status int) error {
+	return &openai.APIError{HTTPStatusCode: status, Message: http.StatusText(status)}
+}
+
+// TestResilienceDoRetries 確認只有 429、5xx 與網路錯誤會以指數退避重試，並遵守 Retry-After
+func TestResilienceDoRetries(t *testing.T) {
+	const base = 100 * time.Millisecond
+
+	retryAfter := &googleapi.Error{Code: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{"10"}}}
+
+	tests := []struct {
+		name      string
+		errs      []error // 依序回傳的錯誤，用完後回傳 nil
+		wantCalls int
+		wantErr   bool
+		// 每次等待的範圍（抖動在後半段），Retry-After 時上下限相同
+		wantSleeps [][2]time.Duration
+	}{
+		{
+			name:      "第一次就成功",
+			wantCalls: 1,
+		},
+		{
+			name:       "429 後成功",
+			errs:       []error{apiError(http.StatusTooManyRequests)},
+			wantCalls:  2,
+			wantSleeps: [][2]time.Duration{{base / 2, base}},
+		},
+		{
+			name:       "網路錯誤後成功",
+			errs:       []error{timeoutError{}},
+			wantCalls:  2,
+			wantSleeps: [][2]time.Duration{{base / 2, base}},
+		},
+		{
+			name:      "5xx 直到用完次數，退避加倍並受上限限制",
+			errs:      []error{apiError(500), apiError(502), apiError(503), apiError(504)},
+			wantCalls: 4,
+			wantErr:   true,
+			wantSleeps: [][2]time.Duration{
+				{base / 2, base},
+				{base, 2 * base},
+				{3 * base / 2, 3 * base}, // 4*base 超過 MaxDelay，取 MaxDelay
+			},
+		},
+		{
+			name:      "400 不重試",
+			errs:      []error{apiError(http.StatusBadRequest)},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "context 錯誤不重試",
+			errs:      []error{context.DeadlineExceeded},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:       "Retry-After 比退避長時以其為準",
+			errs:       []error{retryAfter},
+			wantCalls:  2,
+			wantSleeps: [][2]time.Duration{{10 * time.Second, 10 * time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, clock := newTestResilience(ResilienceConfig{
+				MaxAttempts: 4,
+				BaseDelay:   base,
+				MaxDelay:    3 * base,
+			})
+
+			calls := 0
+			err := r.Do(context.Background(), LLMTypeOpenAI, "gpt-4o", func(ctx context.Context) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("錯誤為 %v，預期有錯誤: %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("呼叫 %d 次，預期 %d 次", calls, tt.wantCalls)
+			}
+
+			sleeps := clock.Sleeps()
+			if len(sleeps) != len(tt.wantSleeps) {
+				t.Fatalf("等待了 %v，預期 %d 次", sleeps, len(tt.wantSleeps))
+			}
+			for i, want := range tt.wantSleeps {
+				if sleeps[i] < want[0] || sleeps[i] > want[1] {
+					t.Errorf("第 %d 次等待 %v，預期介於 %v 與 %v", i+1, sleeps[i], want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+// TestResilienceCanceledContext 確認 ctx 已取消時不會送出請求
+func TestResilienceCanceledContext(t *testing.T) {
+	r, _ := newTestResilience(ResilienceConfig{MaxAttempts: 3, RateLimit: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := r.Do(ctx, LLMTypeOpenAI, "gpt-4o", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("錯誤為 %v，預期 context.Canceled", err)
+	}
+	if called {
+		t.Error("ctx 取消後仍送出請求")
+	}
+}
+
+// TestResilienceRetryAfterTransport 確認 429 回應的 Retry-After 會讓同一提供者的下一個請求先等待
+func TestResilienceRetryAfterTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	r, clock := newTestResilience(ResilienceConfig{MaxAttempts: 1})
+
+	resp, err := r.HTTPClient(LLMTypeGemini).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if remaining := r.cooldownRemaining(LLMTypeGemini); remaining != 3*time.Second {
+		t.Fatalf("冷卻時間為 %v，預期 3s", remaining)
+	}
+	if remaining := r.cooldownRemaining(LLMTypeOpenAI); remaining > 0 {
+		t.Errorf("其他提供者不應等待，冷卻時間為 %v", remaining)
+	}
+
+	if err := r.Do(context.Background(), LLMTypeGemini, GeminiChatModel, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 1 || sleeps[0] != 3*time.Second {
+		t.Errorf("等待了 %v，預期先等待 3s", sleeps)
+	}
+}
+
+// TestResilienceRateLimit 確認令牌桶以 provider/model 為單位，個別設定優先於預設值
+func TestResilienceRateLimit(t *testing.T) {
+	r, clock := newTestResilience(ResilienceConfig{
+		MaxAttempts: 1,
+		RateLimit:   1,
+		RateBurst:   1,
+		RateLimits:  map[string]float64{"openai/text-embedding-3-small": 0.5},
+	})
+
+	ok := func(ctx context.Context) error { return nil }
+	run := func(model string) time.Duration {
+		t.Helper()
+		before := clock.Now()
+		if err := r.Do(context.Background(), LLMTypeOpenAI, model, ok); err != nil {
+			t.Fatal(err)
+		}
+		return clock.Now().Sub(before)
+	}
+
+	tests := []struct {
+		model string
+		want  time.Duration
+	}{
+		{"gpt-4o", 0},                               // 桶內還有令牌
+		{"gpt-4o", time.Second},                     // 每秒 1 個
+		{"text-embedding-ada-002", 0},               // 其他模型有自己的桶
+		{"text-embedding-3-small", 0},               // 個別設定的桶
+		{"text-embedding-3-small", 2 * time.Second}, // 每秒 0.5 個
+	}
+	for i, tt := range tests {
+		if got := run(tt.model); got != tt.want {
+			t.Errorf("第 %d 個請求（%s）等待 %v，預期 %v", i+1, tt.model, got, tt.want)
+		}
+	}
+}
+
+// TestResilienceBreakerTransitions 確認斷路器 closed → open → half-open → closed，試探失敗時再次斷開
+func TestResilienceBreakerTransitions(t *testing.T) {
+	const cooldown = 30 * time.Second
+	r, clock := newTestResilience(ResilienceConfig{
+		MaxAttempts:      1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  cooldown,
+	})
+
+	calls := 0
+	do := func(err error) error {
+		return r.Do(context.Background(), LLMTypeOpenAI, "gpt-4o", func(ctx context.Context) error {
+			calls++
+			return err
+		})
+	}
+	state := func() BreakerState {
+		return r.BreakerState(LLMTypeOpenAI, "gpt-4o")
+	}
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		skipDo    bool // 只檢查狀態，不呼叫 Do
+		callErr   error
+		wantCall  bool
+		wantOpen  bool // Do 回傳 ErrCircuitOpen
+		wantState BreakerState
+	}{
+		{"第一次失敗", 0, false, apiError(500), true, false, BreakerClosed},
+		{"不可重試的錯誤重設失敗次數", 0, false, apiError(400), true, false, BreakerClosed},
+		{"再失敗一次仍未達門檻", 0, false, apiError(500), true, false, BreakerClosed},
+		{"連續失敗達到門檻後斷開", 0, false, apiError(500), true, false, BreakerOpen},
+		{"斷開期間不送出請求", cooldown / 2, false, nil, false, true, BreakerOpen},
+		{"冷卻結束後為 half-open", cooldown / 2, true, nil, false, false, BreakerHalfOpen},
+		{"試探失敗再次斷開", 0, false, apiError(503), true, false, BreakerOpen},
+		{"再次冷卻後試探成功即關閉", cooldown, false, nil, true, false, BreakerClosed},
+	}
+
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		before := calls
+
+		if step.skipDo {
+			if got := state(); got != step.wantState {
+				t.Errorf("%s: 狀態為 %s，預期 %s", step.name, got, step.wantState)
+			}
+			continue
+		}
+
+		err := do(step.callErr)
+		if got := calls > before; got != step.wantCall {
+			t.Errorf("%s: 送出請求為 %v，預期 %v", step.name, got, step.wantCall)
+		}
+		if got := errors.Is(err, ErrCircuitOpen); got != step.wantOpen {
+			t.Errorf("%s: 錯誤為 %v", step.name, err)
+		}
+		if got := state(); got != step.wantState {
+			t.Errorf("%s: 狀態為 %s，預期 %s", step.name, got, step.wantState)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package llm
+
+import "context"
+
+// StreamChunk 表示串流回應中的一個片段，Err 不為 nil 時串流即中止
+type StreamChunk struct {
+	Content string
+	Err     error
+}
+
+// sendChunk 將片段送入串流通道，若 ctx 已取消（例如客戶端中斷連線）則回傳 false
+func sendChunk(ctx context.Context, chunks chan<- StreamChunk, chunk StreamChunk) bool {
+	select {
+	case chunks <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
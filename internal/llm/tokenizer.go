@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"log"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// TokenizerCL100K 是 OpenAI 嵌入模型使用的 BPE 編碼
+const TokenizerCL100K = "cl100k_base"
+
+func init() {
+	// BPE 檔已嵌入執行檔，載入時不需要網路，token 數不會因為下載未完成或離線而改用估算值
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// tokenizerEntry 是一個編碼器的載入狀態，載入失敗時 encoder 為 nil
+type tokenizerEntry struct {
+	once    sync.Once
+	encoder *tiktoken.Tiktoken
+}
+
+// encoders 是依編碼名稱載入的 BPE 編碼器，每個編碼只載入一次
+var (
+	encodersMu sync.Mutex
+	encoders   = make(map[string]*tokenizerEntry)
+)
+
+// WarmTokenizer 在背景預先載入編碼器，避免第一個請求等待解析 BPE 檔
+func WarmTokenizer(name string) {
+	if name == "" {
+		return
+	}
+	go loadEncoder(name)
+}
+
+// CountTokens 計算文字在指定嵌入模型下的 token 數
+// 模型有 BPE 編碼時精確計算，否則以 estimateTokens 估算
+func CountTokens(model EmbeddingModelInfo, text string) int {
+	if encoder := loadEncoder(model.Tokenizer); encoder != nil {
+		return len(encoder.EncodeOrdinary(text))
+	}
+	return estimateTokens(text)
+}
+
+// loadEncoder 取得編碼器，第一次呼叫時載入，並行的呼叫會等待同一次載入完成
+func loadEncoder(name string) *tiktoken.Tiktoken {
+	if name == "" {
+		return nil
+	}
+
+	encodersMu.Lock()
+	entry, ok := encoders[name]
+	if !ok {
+		entry = &tokenizerEntry{}
+		encoders[name] = entry
+	}
+	encodersMu.Unlock()
+
+	entry.once.Do(func() {
+		encoder, err := tiktoken.GetEncoding(name)
+		if err != nil {
+			log.Printf("載入 %s 編碼器失敗，token 數改用估算值: %v", name, err)
+			return
+		}
+		entry.encoder = encoder
+	})
+	return entry.encoder
+}
+
+// EstimateTokens 保守估算聊天內容的 token 數，用於判斷提示詞是否超出聊天模型的上下文長度
+func EstimateTokens(text string) int {
+	return estimateTokens(text)
+}
+
+// estimateTokens 保守估算 token 數：ASCII 約三個字元一個 token，其他字元（中日韓文字等）每字算兩個
+// 寧可高估，切出的批次才不會超過 API 的限制
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+		i += size
+	}
+	return (ascii+2)/3 + other*2
+}
@@ -0,0 +1,23 @@
+package llm
+
+import "testing"
+
+// TestCountTokensOffline 確認 OpenAI 嵌入模型不需要預先載入或下載編碼檔就能精確計算 token 數
+func TestCountTokensOffline(t *testing.T) {
+	model, err := LookupEmbeddingModel(EmbeddingTypeOpenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Tokenizer != TokenizerCL100K {
+		t.Fatalf("%s 的編碼為 %q，預期 %s", model.Type, model.Tokenizer, TokenizerCL100K)
+	}
+
+	// cl100k_base 將 "hello world" 編為 ["hello", " world"]，估算值則為 4
+	if got := CountTokens(model, "hello world"); got != 2 {
+		t.Errorf("token 數為 %d，預期 2", got)
+	}
+
+	if got := CountTokens(EmbeddingModelInfo{}, "hello world"); got != estimateTokens("hello world") {
+		t.Errorf("沒有編碼的模型 token 數為 %d，預期估算值 %d", got, estimateTokens("hello world"))
+	}
+}
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenUsage 是一次呼叫消耗的 token 數
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	EmbeddingTokens  int
+}
+
+// UsageEvent 是一次提供者呼叫的用量紀錄，批量嵌入切成多個請求時合併為一筆
+type UsageEvent struct {
+	Provider  LLMType
+	Model     string
+	Operation Operation
+	TokenUsage
+	Estimated bool // 提供者沒有回報用量，token 數為本地估算值
+	Latency   time.Duration
+	Err       error
+}
+
+// UsageRecorder 接收每次提供者呼叫的用量，ctx 為發起呼叫的請求 context（可取得使用者）
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, event UsageEvent)
+}
+
+type usageCollectorKey struct{}
+
+// usageCollector 在一次呼叫中累計提供者回報的用量
+type usageCollector struct {
+	mu        sync.Mutex
+	model     string
+	usage     TokenUsage
+	estimated bool
+}
+
+// withUsageCollector 在 ctx 中放入新的用量收集器
+func withUsageCollector(ctx context.Context) (context.Context, *usageCollector) {
+	collector := &usageCollector{}
+	return context.WithValue(ctx, usageCollectorKey{}, collector), collector
+}
+
+// reportUsage 由提供者在收到回應後呼叫，ctx 中沒有收集器時（未啟用用量紀錄）不做任何事
+func reportUsage(ctx context.Context, model string, usage TokenUsage, estimated bool) {
+	collector, ok := ctx.Value(usageCollectorKey{}).(*usageCollector)
+	if !ok {
+		return
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.model = model
+	collector.usage.PromptTokens += usage.PromptTokens
+	collector.usage.CompletionTokens += usage.CompletionTokens
+	collector.usage.EmbeddingTokens += usage.EmbeddingTokens
+	collector.estimated = collector.estimated || estimated
+}
+
+// event 將收集到的用量轉成紀錄
+func (c *usageCollector) event(llmType LLMType, op Operation, started time.Time, err error) UsageEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return UsageEvent{
+		Provider:   llmType,
+		Model:      c.model,
+		Operation:  op,
+		TokenUsage: c.usage,
+		Estimated:  c.estimated,
+		Latency:    time.Since(started),
+		Err:        err,
+	}
+}
+
+// estimateMessageTokens 估算對話訊息的 token 數，供沒有回報用量的提供者使用
+func estimateMessageTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content)
+	}
+	return total
+}
+
+// estimateTextsTokens 以嵌入模型的編碼計算多段文字的 token 數
+func estimateTextsTokens(model EmbeddingModelInfo, texts []string) int {
+	total := 0
+	for _, text := range texts {
+		total += CountTokens(model, text)
+	}
+	return total
+}
@@ -1,100 +1,189 @@
 package milvus
 
 import (
+	"ai-workshop/internal/config"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"time"
 )
 
 type Client struct {
 	baseURL string
+	dbName  string
+	token   string
 	client  *http.Client
 }
 
+// ClientConfig 是連線到 Milvus REST API 的設定
 type ClientConfig struct {
-	BaseURL string
+	Host     string
+	Port     string
+	Username string // 未啟用驗證時可留空
+	Password string
+	DBName   string // 空字串表示 default 資料庫
+
+	TLS                   bool // 使用 https 連線
+	TLSInsecureSkipVerify bool // 不驗證伺服器憑證，僅供自簽憑證的測試環境使用
+
 	Timeout time.Duration
 }
 
+// NewClientConfig 從應用程式設定建立 Milvus 連線設定
+func NewClientConfig(appConfig *config.Config) *ClientConfig {
+	return &ClientConfig{
+		Host:                  appConfig.MilvusHost,
+		Port:                  appConfig.MilvusPort,
+		Username:              appConfig.MilvusUsername,
+		Password:              appConfig.MilvusPassword,
+		DBName:                appConfig.MilvusDBName,
+		TLS:                   appConfig.MilvusTLS,
+		TLSInsecureSkipVerify: appConfig.MilvusTLSInsecureSkipVerify,
+		Timeout:               appConfig.MilvusTimeout,
+	}
+}
+
+// NewClient 創建 Milvus 客戶端，整個應用程式共用同一個實例
 func NewClient(config *ClientConfig) *Client {
 	if config == nil {
-		config = &ClientConfig{
-			BaseURL: "http://localhost:19530",
-			Timeout: 10 * time.Second,
+		config = &ClientConfig{}
+	}
+	if config.Host == "" {
+		config.Host = "localhost"
+	}
+	if config.Port == "" {
+		config.Port = "19530"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	scheme := "http"
+	transport := http.DefaultTransport
+	if config.TLS {
+		scheme = "https"
+		if config.TLSInsecureSkipVerify {
+			tlsTransport := http.DefaultTransport.(*http.Transport).Clone()
+			tlsTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			transport = tlsTransport
 		}
 	}
 
+	// REST API 以 Bearer username:password 驗證
+	var token string
+	if config.Username != "" {
+		token = config.Username + ":" + config.Password
+	}
+
 	return &Client{
-		baseURL: config.BaseURL,
+		baseURL: fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(config.Host, config.Port)),
+		dbName:  config.DBName,
+		token:   token,
 		client: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: transport,
 		},
 	}
 }
 
+// newRequest 建立帶有驗證標頭的請求，payload 會自動帶入設定的資料庫名稱
+func (c *Client) newRequest(ctx context.Context, method, url string, payload map[string]interface{}) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		if c.dbName != "" {
+			payload["dbName"] = c.dbName
+		}
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("序列化請求失敗: %v", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("創建請求失敗: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
 func (c *Client) Close() error {
 	return nil
 }
 
-// CreateCollection 創建集合
-func (c *Client) CreateCollection(name string, dimension int) error {
-	url := fmt.Sprintf("%s/v1/vector/collections/create", c.baseURL)
+// CreateCollection 創建集合，除了向量與文本外還包含來源、擁有者、建立時間與 JSON metadata 等純量欄位
+// v1 的快速建立無法自訂欄位，因此改用 v2 的建立集合 API（Milvus 2.4 以上）
+func (c *Client) CreateCollection(ctx context.Context, name string, dimension int) error {
+	url := fmt.Sprintf("%s/v2/vectordb/collections/create", c.baseURL)
 
 	payload := map[string]interface{}{
 		"collectionName": name,
-		"dimension":      dimension,
-		"fields": []map[string]interface{}{
-			{
-				"name":       "id",
-				"data_type":  "INT64",
-				"is_primary": true,
-				"autoID":     true,
-			},
-			{
-				"name":      "vector",
-				"data_type": "FLOAT_VECTOR",
-				"dim":       dimension,
-			},
+		"schema": map[string]interface{}{
+			"autoId":             true,
+			"enableDynamicField": true,
+			"fields":             collectionFields(dimension),
+		},
+		"indexParams": []map[string]interface{}{
 			{
-				"name":       "text",
-				"data_type":  "VARCHAR",
-				"max_length": 65535,
+				"fieldName":  FieldVector,
+				"indexName":  FieldVector,
+				"metricType": "COSINE",
 			},
 		},
 	}
 
-	jsonData, err := json.Marshal(payload)
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return fmt.Errorf("序列化請求失敗: %v", err)
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("創建請求失敗: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("發送請求失敗: %v", err)
 	}
 	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("讀取回應失敗: %v", err)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("創建集合失敗: HTTP %d, 回應: %s", resp.StatusCode, string(body))
 	}
 
+	// v2 API 成功時回應碼為 0
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("解析回應失敗: %v", err)
+	}
+
+	if result.Code != 0 {
+		return fmt.Errorf("創建集合失敗: 回應碼 %d, 訊息: %s", result.Code, result.Message)
+	}
+
 	return nil
 }
 
-// InsertVectors 插入向量數據
-func (c *Client) InsertVectors(collectionName string, vectors []map[string]interface{}) error {
+// InsertVectors 插入向量數據，返回 Milvus 自動生成的主鍵 ID（依插入順序）
+func (c *Client) InsertVectors(ctx context.Context, collectionName string, vectors []map[string]interface{}) ([]string, error) {
 	url := fmt.Sprintf("%s/v1/vector/insert", c.baseURL)
 
 	// 準備數據
@@ -103,60 +192,126 @@ func (c *Client) InsertVectors(collectionName string, vectors []map[string]inter
 		"data":           vectors,
 	}
 
-	jsonData, err := json.Marshal(payload)
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return fmt.Errorf("序列化請求失敗: %v", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("創建請求失敗: %v", err)
+		return nil, fmt.Errorf("發送請求失敗: %v", err)
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
-	resp, err := c.client.Do(req)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("發送請求失敗: %v", err)
+		return nil, fmt.Errorf("讀取回應失敗: %v", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("插入向量失敗: HTTP %d, 回應: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("插入向量失敗: HTTP %d, 回應: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	// 自動生成的 INT64 主鍵可能超過 float64 的精度，以 json.Number 保留原始數字
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			InsertCount int           `json:"insertCount"`
+			InsertIDs   []json.Number `json:"insertIds"`
+		} `json:"data"`
+	}
+
+	if err := decodeNumbers(body, &result); err != nil {
+		return nil, fmt.Errorf("解析回應失敗: %v", err)
+	}
+
+	if result.Code != 200 {
+		return nil, fmt.Errorf("插入向量失敗: 回應碼 %d, 訊息: %s", result.Code, result.Message)
+	}
+
+	ids := make([]string, len(result.Data.InsertIDs))
+	for i, id := range result.Data.InsertIDs {
+		ids[i] = id.String()
+	}
+	return ids, nil
+}
+
+// MaxQueryWindow 是 Milvus 查詢 offset + limit 的上限，超過時需改用 cursor 分頁
+const MaxQueryWindow = 16384
+
+// QueryOptions 是列出向量數據的分頁與過濾設定
+type QueryOptions struct {
+	Filter      string // 純量過濾表達式，空字串表示全部
+	Limit       int    // 每頁筆數
+	Offset      int    // 略過的筆數
+	WithVectors bool   // 是否返回向量，預設不返回以避免過大的回應
 }
 
-// ListVectors 列出向量數據
-func (c *Client) ListVectors(collectionName string) ([]map[string]interface{}, error) {
-	// 使用 query 方式查詢所有數據
-	queryURL := fmt.Sprintf("%s/v1/vector/query", c.baseURL)
+// ListVectors 依過濾條件分頁列出向量數據
+// Milvus 合併各 segment 的查詢結果時每次取最小的主鍵（typeutil.SelectMinPK），因此帶 limit 的查詢返回符合條件中
+// 主鍵最小的 limit 筆，並依主鍵遞增排序；以 id > 上一頁最後一筆 ID 作為過濾條件即可 cursor 分頁（官方 SDK 的 QueryIterator 同樣如此）
+func (c *Client) ListVectors(ctx context.Context, collectionName string, opts QueryOptions) ([]map[string]interface{}, error) {
+	if opts.Offset+opts.Limit > MaxQueryWindow {
+		return nil, fmt.Errorf("offset 與 limit 的總和不可超過 %d，請改用 cursor 分頁", MaxQueryWindow)
+	}
+
+	outputFields := OutputFields
+	if opts.WithVectors {
+		outputFields = append(append([]string{}, OutputFields...), FieldVector)
+	}
+
+	filter := opts.Filter
+	if filter == "" {
+		filter = "id > 0"
+	}
 
-	queryPayload := map[string]interface{}{
+	payload := map[string]interface{}{
 		"collectionName": collectionName,
-		"output_fields":  []string{"id", "vector", "text"},
-		"filter":         "id > 0",
-		"limit":          100,
+		"filter":         filter,
+		"outputFields":   outputFields,
+		"limit":          opts.Limit,
+		"offset":         opts.Offset,
 	}
 
-	queryJSON, err := json.Marshal(queryPayload)
-	if err != nil {
-		return nil, fmt.Errorf("序列化查詢請求失敗: %v", err)
+	return c.query(ctx, payload)
+}
+
+// CountVectors 計算符合過濾條件的向量數量
+func (c *Client) CountVectors(ctx context.Context, collectionName string, filter string) (int, error) {
+	payload := map[string]interface{}{
+		"collectionName": collectionName,
+		"filter":         filter,
+		"outputFields":   []string{"count(*)"},
 	}
 
-	fmt.Printf("查詢請求數據: %s\n", string(queryJSON))
+	rows, err := c.query(ctx, payload)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
 
-	queryReq, err := http.NewRequest("POST", queryURL, bytes.NewBuffer(queryJSON))
+	count, ok := rows[0]["count(*)"].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("無法解析數量: %v", rows[0]["count(*)"])
+	}
+	total, err := count.Int64()
 	if err != nil {
-		return nil, fmt.Errorf("創建查詢請求失敗: %v", err)
+		return 0, fmt.Errorf("無法解析數量: %v", err)
 	}
+	return int(total), nil
+}
+
+// query 呼叫 v2 的查詢 API，數字以 json.Number 返回以保留 INT64 主鍵的精度
+func (c *Client) query(ctx context.Context, payload map[string]interface{}) ([]map[string]interface{}, error) {
+	queryURL := fmt.Sprintf("%s/v2/vectordb/entities/query", c.baseURL)
 
-	queryReq.Header.Set("Content-Type", "application/json")
-	queryReq.Header.Set("Accept", "application/json")
-	queryReq.Header.Set("Authorization", "Bearer root:Milvus")
+	queryReq, err := c.newRequest(ctx, "POST", queryURL, payload)
+	if err != nil {
+		return nil, err
+	}
 
 	queryResp, err := c.client.Do(queryReq)
 	if err != nil {
@@ -169,49 +324,42 @@ func (c *Client) ListVectors(collectionName string) ([]map[string]interface{}, e
 		return nil, fmt.Errorf("讀取查詢回應失敗: %v", err)
 	}
 
-	fmt.Printf("查詢回應: %s\n", string(queryBody))
-
 	if queryResp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("查詢失敗: HTTP %d, 回應: %s", queryResp.StatusCode, string(queryBody))
 	}
 
 	var result struct {
-		Code int                      `json:"code"`
-		Data []map[string]interface{} `json:"data"`
+		Code    int                      `json:"code"`
+		Message string                   `json:"message"`
+		Data    []map[string]interface{} `json:"data"`
 	}
 
-	if err := json.Unmarshal(queryBody, &result); err != nil {
+	if err := decodeNumbers(queryBody, &result); err != nil {
 		return nil, fmt.Errorf("解析查詢回應失敗: %v", err)
 	}
 
+	if result.Code != 0 {
+		return nil, fmt.Errorf("查詢失敗: 回應碼 %d, 訊息: %s", result.Code, result.Message)
+	}
+
 	return result.Data, nil
 }
 
 // DeleteVectors 刪除向量
-func (c *Client) DeleteVectors(collectionName string, ids []string) error {
+func (c *Client) DeleteVectors(ctx context.Context, collectionName string, ids []string) error {
 	url := fmt.Sprintf("%s/v1/vector/delete", c.baseURL)
 
 	// 準備請求體
 	payload := map[string]interface{}{
-		"dbName":         "default",
 		"collectionName": collectionName,
-		"id":             ids,
+		"id":             primaryKeys(ids),
 	}
 
-	jsonData, err := json.Marshal(payload)
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return fmt.Errorf("序列化請求失敗: %v", err)
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("創建請求失敗: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("發送請求失敗: %v", err)
@@ -244,18 +392,31 @@ func (c *Client) DeleteVectors(collectionName string, ids []string) error {
 	return nil
 }
 
+// primaryKeys 將 ID 轉為請求使用的主鍵值：INT64 主鍵需以數字傳送，無法轉換時保留字串
+func primaryKeys(ids []string) interface{} {
+	keys := make([]int64, len(ids))
+	for i, id := range ids {
+		key, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return ids
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
 // ListCollections 列出所有集合
-func (c *Client) ListCollections() ([]string, error) {
+func (c *Client) ListCollections(ctx context.Context) ([]string, error) {
 	url := fmt.Sprintf("%s/v1/vector/collections", c.baseURL)
+	if c.dbName != "" {
+		url += "?dbName=" + neturl.QueryEscape(c.dbName)
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := c.newRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("創建請求失敗: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("發送請求失敗: %v", err)
@@ -288,26 +449,18 @@ func (c *Client) ListCollections() ([]string, error) {
 }
 
 // DeleteCollection 刪除集合
-func (c *Client) DeleteCollection(collectionName string) error {
+func (c *Client) DeleteCollection(ctx context.Context, collectionName string) error {
 	url := fmt.Sprintf("%s/v1/vector/collections/drop", c.baseURL)
 
 	payload := map[string]interface{}{
 		"collectionName": collectionName,
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("序列化請求失敗: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return fmt.Errorf("創建請求失敗: %v", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("發送請求失敗: %v", err)
@@ -322,8 +475,15 @@ func (c *Client) DeleteCollection(collectionName string) error {
 	return nil
 }
 
-// SearchVectors 向量搜尋
-func (c *Client) SearchVectors(collectionName string, vectorToSearch []float32, topK int) ([]map[string]interface{}, error) {
+// decodeNumbers 解析回應並以 json.Number 保留數字，INT64 主鍵超過 2^53 時轉為 float64 會失去精度
+func decodeNumbers(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// SearchVectors 向量搜尋，filter 為純量過濾表達式（例如 owner_id == "..."），空字串表示不過濾
+func (c *Client) SearchVectors(ctx context.Context, collectionName string, vectorToSearch []float32, topK int, filter string) ([]map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/v1/vector/search", c.baseURL)
 
 	// 準備請求體
@@ -333,21 +493,15 @@ func (c *Client) SearchVectors(collectionName string, vectorToSearch []float32,
 		"output_fields":  []string{"id", "text"},
 		"topk":           topK,
 	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("序列化請求失敗: %v", err)
+	if filter != "" {
+		payload["filter"] = filter
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return nil, fmt.Errorf("創建請求失敗: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("發送請求失敗: %v", err)
@@ -368,7 +522,7 @@ func (c *Client) SearchVectors(collectionName string, vectorToSearch []float32,
 		Data []map[string]interface{} `json:"data"`
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := decodeNumbers(body, &result); err != nil {
 		return nil, fmt.Errorf("解析回應失敗: %v", err)
 	}
 
@@ -379,29 +533,25 @@ func (c *Client) SearchVectors(collectionName string, vectorToSearch []float32,
 	return result.Data, nil
 }
 
-func (c *Client) Search(collectionName string, vector []float32, topK int) ([]map[string]interface{}, error) {
+// Search 向量搜尋並返回所有純量欄位，filter 為純量過濾表達式，空字串表示不過濾
+func (c *Client) Search(ctx context.Context, collectionName string, vector []float32, topK int, filter string) ([]map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/v1/vector/search", c.baseURL)
 
 	payload := map[string]interface{}{
 		"collectionName": collectionName,
 		"vector":         vector,
-		"outputFields":   []string{"id", "text"},
+		"outputFields":   OutputFields,
 		"limit":          topK,
 	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("序列化請求失敗: %v", err)
+	if filter != "" {
+		payload["filter"] = filter
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := c.newRequest(ctx, "POST", url, payload)
 	if err != nil {
-		return nil, fmt.Errorf("創建請求失敗: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer root:Milvus")
-
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("發送請求失敗: %v", err)
@@ -422,7 +572,7 @@ func (c *Client) Search(collectionName string, vector []float32, topK int) ([]ma
 		Data []map[string]interface{} `json:"data"`
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := decodeNumbers(body, &result); err != nil {
 		return nil, fmt.Errorf("解析回應失敗: %v", err)
 	}
 
@@ -433,9 +583,68 @@ func (c *Client) Search(collectionName string, vector []float32, topK int) ([]ma
 	return result.Data, nil
 }
 
+// CollectionDescription 是 v2 describe API 返回的集合結構
+type CollectionDescription struct {
+	CollectionName     string `json:"collectionName"`
+	EnableDynamicField bool   `json:"enableDynamicField"`
+	Fields             []struct {
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		PrimaryKey bool   `json:"primaryKey"`
+	} `json:"fields"`
+	Indexes []struct {
+		FieldName  string `json:"fieldName"`
+		IndexName  string `json:"indexName"`
+		MetricType string `json:"metricType"`
+	} `json:"indexes"`
+}
+
+// DescribeCollection 取得集合的欄位與索引定義
+func (c *Client) DescribeCollection(ctx context.Context, collectionName string) (*CollectionDescription, error) {
+	url := fmt.Sprintf("%s/v2/vectordb/collections/describe", c.baseURL)
+
+	req, err := c.newRequest(ctx, "POST", url, map[string]interface{}{
+		"collectionName": collectionName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("發送請求失敗: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("讀取回應失敗: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("取得集合結構失敗: HTTP %d, 回應: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Code    int                   `json:"code"`
+		Message string                `json:"message"`
+		Data    CollectionDescription `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析回應失敗: %v", err)
+	}
+
+	if result.Code != 0 {
+		return nil, fmt.Errorf("取得集合結構失敗: 回應碼 %d, 訊息: %s", result.Code, result.Message)
+	}
+
+	return &result.Data, nil
+}
+
 // CollectionExists 檢查指定的集合是否存在
-func (c *Client) CollectionExists(collectionName string) (bool, error) {
-	collections, err := c.ListCollections()
+func (c *Client) CollectionExists(ctx context.Context, collectionName string) (bool, error) {
+	collections, err := c.ListCollections(ctx)
 	if err != nil {
 		return false, fmt.Errorf("獲取集合列表失敗: %v", err)
 	}
@@ -0,0 +1,45 @@
+package milvus
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestClientHonorsContext 確認請求在 context 取消時立即結束，不會等到客戶端的逾時
+func TestClientHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(&ClientConfig{Host: host, Port: port, Timeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.ListCollections(ctx); err == nil {
+		t.Fatal("預期 context 逾時後返回錯誤")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("請求在 %v 後才結束，未依 context 取消", elapsed)
+	}
+}
@@ -0,0 +1,133 @@
+package milvus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 集合的欄位名稱
+const (
+	FieldID         = "id"
+	FieldVector     = "vector"
+	FieldText       = "text"
+	FieldSourceFile = "source_file" // 來源檔案名稱（或手動插入文件的 ID）
+	FieldChunkIndex = "chunk_index" // 片段在來源中的序號
+	FieldOffset     = "offset"      // 片段在來源文本中的起始字元位置
+	FieldOwnerID    = "owner_id"    // 上傳者的使用者 ID，匿名上傳時為空字串
+	FieldCreatedAt  = "created_at"  // 寫入時間（Unix 秒）
+	FieldMetadata   = "metadata"    // 頁碼、標題、標籤等其他結構資訊
+)
+
+// OutputFields 是搜尋與查詢時返回的欄位（不含向量）
+// 舊版以 v1 快速建立的集合只有 id、vector、text 且以 L2 計算距離，CheckSchema 會拒絕這類集合，需刪除後重新處理檔案
+var OutputFields = []string{
+	FieldID,
+	FieldText,
+	FieldSourceFile,
+	FieldChunkIndex,
+	FieldOffset,
+	FieldOwnerID,
+	FieldCreatedAt,
+	FieldMetadata,
+}
+
+// collectionFields 返回建立集合時使用的欄位定義
+func collectionFields(dimension int) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"fieldName": FieldID, "dataType": "Int64", "isPrimary": true},
+		{"fieldName": FieldVector, "dataType": "FloatVector", "elementTypeParams": map[string]interface{}{"dim": dimension}},
+		{"fieldName": FieldText, "dataType": "VarChar", "elementTypeParams": map[string]interface{}{"max_length": 65535}},
+		{"fieldName": FieldSourceFile, "dataType": "VarChar", "elementTypeParams": map[string]interface{}{"max_length": 1024}},
+		{"fieldName": FieldChunkIndex, "dataType": "Int64"},
+		{"fieldName": FieldOffset, "dataType": "Int64"},
+		{"fieldName": FieldOwnerID, "dataType": "VarChar", "elementTypeParams": map[string]interface{}{"max_length": 64}},
+		{"fieldName": FieldCreatedAt, "dataType": "Int64"},
+		{"fieldName": FieldMetadata, "dataType": "JSON"},
+	}
+}
+
+// ErrOutdatedSchema 表示集合是舊版的結構，缺少純量欄位或不是以 COSINE 建立向量索引
+var ErrOutdatedSchema = errors.New("集合結構已過時")
+
+// CheckSchema 確認集合包含 collectionFields 的所有欄位，且向量索引使用 COSINE
+// 舊集合無法就地遷移（缺少的欄位無法補上，相似度的計算方式也不同），錯誤訊息會說明重建的步驟
+func (c *Client) CheckSchema(ctx context.Context, collectionName string) error {
+	description, err := c.DescribeCollection(ctx, collectionName)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(description.Fields))
+	for _, field := range description.Fields {
+		existing[field.Name] = true
+	}
+	// 維度不影響欄位名稱，這裡只取名稱比對
+	var problems, missing []string
+	for _, field := range collectionFields(0) {
+		if name := field["fieldName"].(string); !existing[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("缺少欄位 %s", strings.Join(missing, "、")))
+	}
+	for _, index := range description.Indexes {
+		if index.FieldName == FieldVector && index.MetricType != "" && !strings.EqualFold(index.MetricType, "COSINE") {
+			problems = append(problems, fmt.Sprintf("向量索引使用 %s 而不是 COSINE", index.MetricType))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: 集合 %s %s；請以 DELETE /api/collections?embedding_model=<模型> 刪除集合後，以 POST /api/process/:fileName 重新處理檔案",
+			ErrOutdatedSchema, collectionName, strings.Join(problems, "，"))
+	}
+	return nil
+}
+
+// QuoteString 將字串轉為過濾表達式中的字串常值，跳脫反斜線與雙引號
+func QuoteString(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return `"` + escaped + `"`
+}
+
+// EqualsFilter 返回 field == value 的過濾表達式
+func EqualsFilter(field, value string) string {
+	return fmt.Sprintf("%s == %s", field, QuoteString(value))
+}
+
+// TagFilter 返回 metadata 的 tags 陣列包含指定標籤的過濾表達式
+func TagFilter(tag string) string {
+	return fmt.Sprintf(`json_contains(%s["tags"], %s)`, FieldMetadata, QuoteString(tag))
+}
+
+// ContainsFilter 返回 field 包含指定子字串的過濾表達式，value 中的 % 與 _ 會視為萬用字元
+func ContainsFilter(field, value string) string {
+	return fmt.Sprintf("%s like %s", field, QuoteString("%"+value+"%"))
+}
+
+// AndFilters 以 and 串接多個過濾表達式，忽略空字串
+func AndFilters(filters ...string) string {
+	parts := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		if filter = strings.TrimSpace(filter); filter != "" {
+			parts = append(parts, "("+filter+")")
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// IDsFilter 返回主鍵在指定 ID 之中的過濾表達式，無法轉為數字的 ID 以字串常值表示
+func IDsFilter(ids []string) string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+			values[i] = id
+		} else {
+			values[i] = QuoteString(id)
+		}
+	}
+	return fmt.Sprintf("%s in [%s]", FieldID, strings.Join(values, ", "))
+}
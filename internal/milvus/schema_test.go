@@ -0,0 +1,114 @@
+package milvus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// describeResponse 產生 v2 describe API 的回應，欄位只有名稱，索引建立在 vector 上
+func describeResponse(metricType string, fields ...string) string {
+	items := make([]string, len(fields))
+	for i, field := range fields {
+		items[i] = fmt.Sprintf(`{"name": %q, "type": "Int64", "primaryKey": %t}`, field, field == FieldID)
+	}
+	return fmt.Sprintf(`{"code": 0, "data": {"collectionName": "documents_fake", "enableDynamicField": true, "fields": [%s], "indexes": [{"fieldName": "vector", "indexName": "vector", "metricType": %q}]}}`,
+		strings.Join(items, ", "), metricType)
+}
+
+// newDescribeClient 建立連到模擬 Milvus 的客戶端，describe API 固定返回 response
+func newDescribeClient(t *testing.T, response string) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/vectordb/collections/describe" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(&ClientConfig{Host: host, Port: port})
+}
+
+// TestCheckSchema 確認舊版 v1 快速建立的集合（只有 id、vector、text，以 L2 建立索引）被拒絕並說明重建步驟
+func TestCheckSchema(t *testing.T) {
+	current := []string{FieldID, FieldVector, FieldText, FieldSourceFile, FieldChunkIndex, FieldOffset, FieldOwnerID, FieldCreatedAt, FieldMetadata}
+
+	tests := []struct {
+		name       string
+		response   string
+		wantErr    error
+		wantDetail []string
+	}{
+		{
+			name:     "新版結構",
+			response: describeResponse("COSINE", current...),
+		},
+		{
+			name:       "舊版三欄位結構",
+			response:   describeResponse("L2", FieldID, FieldVector, FieldText),
+			wantErr:    ErrOutdatedSchema,
+			wantDetail: []string{"source_file、chunk_index、offset、owner_id、created_at、metadata", "L2", "DELETE /api/collections"},
+		},
+		{
+			name:       "欄位齊全但不是 COSINE",
+			response:   describeResponse("IP", current...),
+			wantErr:    ErrOutdatedSchema,
+			wantDetail: []string{"向量索引使用 IP"},
+		},
+		{
+			name:       "缺少部分欄位",
+			response:   describeResponse("COSINE", current[:len(current)-1]...),
+			wantErr:    ErrOutdatedSchema,
+			wantDetail: []string{"缺少欄位 metadata"},
+		},
+		{
+			name:       "集合不存在",
+			response:   `{"code": 100, "message": "collection not found"}`,
+			wantDetail: []string{"collection not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newDescribeClient(t, tt.response).CheckSchema(context.Background(), "documents_fake")
+			if len(tt.wantDetail) == 0 {
+				if err != nil {
+					t.Fatalf("檢查結構失敗: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("預期返回錯誤")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("錯誤為 %v，預期 %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && errors.Is(err, ErrOutdatedSchema) {
+				t.Errorf("查詢失敗不應視為舊版結構: %v", err)
+			}
+			for _, detail := range tt.wantDetail {
+				if !strings.Contains(err.Error(), detail) {
+					t.Errorf("錯誤 %q 未包含 %q", err, detail)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+/**
+* Conversation
+**/
+type Conversation struct {
+	BaseDBDateModel
+	UserID uuid.UUID `db:"user_id" json:"userId"`
+	Title  string    `db:"title" json:"title"`
+}
+
+/**
+* A single role-tagged turn inside a conversation. Role is one of "system",
+* "user" or "assistant".
+**/
+type ConversationMessage struct {
+	BaseIDModel
+	ConversationID uuid.UUID `db:"conversation_id" json:"conversationId"`
+	Role           string    `db:"role" json:"role"`
+	Content        string    `db:"content" json:"content"`
+}
@@ -0,0 +1,14 @@
+package models
+
+/**
+* Links an uploaded file to one of the Milvus vectors produced from it. A file
+* processed into N chunks owns N rows, one per vector.
+**/
+type FileVector struct {
+	BaseIDModel
+	FileName       string `db:"file_name" json:"fileName"`
+	CollectionName string `db:"collection_name" json:"collectionName"`
+	EmbeddingType  string `db:"embedding_type" json:"embeddingType"`
+	VectorID       string `db:"vector_id" json:"vectorId"`
+	ChunkIndex     int    `db:"chunk_index" json:"chunkIndex"`
+}
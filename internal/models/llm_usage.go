@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+/**
+* One llm provider call: the tokens it consumed, the model, how long it took and
+* who made it. UserID is nil for anonymous requests. Estimated is set when the
+* provider did not report usage and the token counts were computed locally.
+**/
+type LLMUsage struct {
+	BaseIDModel
+	UserID           *uuid.UUID `db:"user_id" json:"userId"`
+	Endpoint         string     `db:"endpoint" json:"endpoint"`
+	Provider         string     `db:"provider" json:"provider"`
+	Model            string     `db:"model" json:"model"`
+	Operation        string     `db:"operation" json:"operation"`
+	PromptTokens     int        `db:"prompt_tokens" json:"promptTokens"`
+	CompletionTokens int        `db:"completion_tokens" json:"completionTokens"`
+	EmbeddingTokens  int        `db:"embedding_tokens" json:"embeddingTokens"`
+	LatencyMs        int64      `db:"latency_ms" json:"latencyMs"`
+	Estimated        bool       `db:"estimated" json:"estimated"`
+	Success          bool       `db:"success" json:"success"`
+	Error            string     `db:"error" json:"error,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+/**
+* A named prompt template. ActiveVersion points at the version that chat and
+* rag requests naming this template are rendered with.
+**/
+type PromptTemplate struct {
+	BaseDBDateModel
+	Name          string `db:"name" json:"name"`
+	Description   string `db:"description" json:"description"`
+	ActiveVersion int    `db:"active_version" json:"activeVersion"`
+}
+
+/**
+* One immutable revision of a prompt template. System and Content use Go
+* text/template syntax; System is optional and sent as a system message.
+**/
+type PromptTemplateVersion struct {
+	BaseIDModel
+	TemplateID uuid.UUID  `db:"template_id" json:"templateId"`
+	Version    int        `db:"version" json:"version"`
+	System     string     `db:"system" json:"system"`
+	Content    string     `db:"content" json:"content"`
+	CreatedBy  *uuid.UUID `db:"created_by" json:"createdBy"`
+}
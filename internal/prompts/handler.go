@@ -0,0 +1,196 @@
+package prompts
+
+import (
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/utils/errorutils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// CreateTemplate creates a named template, its first version becomes the active one
+func (h *Handler) CreateTemplate(c *gin.Context) {
+	var req CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	template, err := h.service.CreateTemplate(c.Request.Context(), currentUser(c), req)
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to create prompt template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": template,
+	})
+}
+
+// ListTemplates lists all templates with their active version number
+func (h *Handler) ListTemplates(c *gin.Context) {
+	templates, err := h.service.ListTemplates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prompt templates: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": templates,
+	})
+}
+
+// GetTemplate returns a template with its active version and version history
+func (h *Handler) GetTemplate(c *gin.Context) {
+	template, err := h.service.GetTemplate(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to retrieve prompt template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": template,
+	})
+}
+
+// UpdateTemplate updates a template's description, content changes go through CreateVersion
+func (h *Handler) UpdateTemplate(c *gin.Context) {
+	var req UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	template, err := h.service.UpdateTemplate(c.Request.Context(), c.Param("name"), req)
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to update prompt template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": template,
+	})
+}
+
+// DeleteTemplate deletes a template and all of its versions
+func (h *Handler) DeleteTemplate(c *gin.Context) {
+	if err := h.service.DeleteTemplate(c.Request.Context(), c.Param("name")); err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to delete prompt template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Prompt template deleted successfully",
+	})
+}
+
+// ListVersions lists a template's versions, newest first
+func (h *Handler) ListVersions(c *gin.Context) {
+	versions, err := h.service.ListVersions(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to list prompt template versions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": versions,
+	})
+}
+
+// CreateVersion adds a new version, it only becomes active when activate is set
+func (h *Handler) CreateVersion(c *gin.Context) {
+	var req CreateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	version, err := h.service.CreateVersion(c.Request.Context(), currentUser(c), c.Param("name"), req)
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to create prompt template version: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": version,
+	})
+}
+
+// ActivateVersion points the template at an existing version
+func (h *Handler) ActivateVersion(c *gin.Context) {
+	var req ActivateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.service.ActivateVersion(c.Request.Context(), c.Param("name"), req.Version); err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to activate version " + strconv.Itoa(req.Version) + ": " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Prompt template version activated successfully",
+	})
+}
+
+// Preview renders a saved template or a draft against sample retrieval results
+func (h *Handler) Preview(c *gin.Context) {
+	var req PreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	template, rendered, err := h.service.Preview(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(ErrorStatus(err), gin.H{"error": "Failed to render prompt template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"name":            template.Name,
+			"version":         template.Version,
+			"system":          rendered.System,
+			"content":         rendered.Content,
+			"estimatedTokens": llm.EstimateTokens(rendered.System) + llm.EstimateTokens(rendered.Content),
+		},
+	})
+}
+
+// ErrorStatus maps prompt template errors to http status codes
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errorutils.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errorutils.ErrDuplicateResource):
+		return http.StatusConflict
+	case errors.Is(err, errorutils.ErrInvalidInput), errors.Is(err, ErrInvalidTemplate):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// currentUser returns the signed in user, the routes are behind AuthMiddleware
+func currentUser(c *gin.Context) *uuid.UUID {
+	userId, exists := c.Get("userId")
+	if !exists {
+		return nil
+	}
+	id := userId.(uuid.UUID)
+	return &id
+}
@@ -0,0 +1,45 @@
+package prompts
+
+import "ai-workshop/internal/models"
+
+type CreateTemplateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	System      string `json:"system"`
+	Content     string `json:"content" binding:"required"`
+}
+
+type UpdateTemplateRequest struct {
+	Description string `json:"description"`
+}
+
+type CreateVersionRequest struct {
+	System   string `json:"system"`
+	Content  string `json:"content" binding:"required"`
+	Activate bool   `json:"activate"`
+}
+
+type ActivateVersionRequest struct {
+	Version int `json:"version" binding:"required"`
+}
+
+/**
+* Renders a saved template (Name, optionally a Version, the active one
+* otherwise) or an unsaved draft (Content and System) against sample
+* retrieval results. Question and Documents default to built-in samples.
+**/
+type PreviewRequest struct {
+	Name      string            `json:"name"`
+	Version   int               `json:"version"`
+	System    string            `json:"system"`
+	Content   string            `json:"content"`
+	Question  string            `json:"question"`
+	Documents []Document        `json:"documents"`
+	Variables map[string]string `json:"variables"`
+}
+
+type TemplateDetail struct {
+	models.PromptTemplate
+	Active   *models.PromptTemplateVersion  `json:"active"`
+	Versions []models.PromptTemplateVersion `json:"versions"`
+}
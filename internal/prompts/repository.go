@@ -0,0 +1,254 @@
+package prompts
+
+import (
+	"ai-workshop/internal/models"
+	"ai-workshop/internal/utils/errorutils"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository interface {
+	Create(ctx context.Context, template *models.PromptTemplate, version *models.PromptTemplateVersion) error
+	List(ctx context.Context) ([]models.PromptTemplate, error)
+	GetByName(ctx context.Context, name string) (*models.PromptTemplate, error)
+	UpdateDescription(ctx context.Context, name, description string) (*models.PromptTemplate, error)
+	Delete(ctx context.Context, name string) error
+	ListVersions(ctx context.Context, templateID uuid.UUID) ([]models.PromptTemplateVersion, error)
+	GetVersion(ctx context.Context, name string, version int) (*models.PromptTemplateVersion, error)
+	GetActiveVersion(ctx context.Context, name string) (*models.PromptTemplateVersion, error)
+	AddVersion(ctx context.Context, name string, version *models.PromptTemplateVersion, activate bool) error
+	SetActiveVersion(ctx context.Context, name string, version int) error
+}
+
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+/**
+* Creates a template together with its first version, which becomes the
+* active one.
+**/
+func (r *PostgresRepository) Create(ctx context.Context, template *models.PromptTemplate, version *models.PromptTemplateVersion) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	template.ActiveVersion = 1
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO prompt_templates (name, description, active_version)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`, template.Name, template.Description, template.ActiveVersion).
+		Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	version.TemplateID = template.ID
+	version.Version = 1
+	if err := insertVersion(ctx, tx, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) List(ctx context.Context) ([]models.PromptTemplate, error) {
+	query := `
+		SELECT id, created_at, updated_at, name, description, active_version
+		FROM prompt_templates
+		ORDER BY name ASC
+	`
+
+	templates := []models.PromptTemplate{}
+	err := r.db.SelectContext(ctx, &templates, query)
+	return templates, err
+}
+
+func (r *PostgresRepository) GetByName(ctx context.Context, name string) (*models.PromptTemplate, error) {
+	query := `
+		SELECT id, created_at, updated_at, name, description, active_version
+		FROM prompt_templates
+		WHERE name = $1
+	`
+
+	var template models.PromptTemplate
+	if err := r.db.GetContext(ctx, &template, query, name); err != nil {
+		return nil, errorutils.AnalyzeDBErr(err)
+	}
+
+	return &template, nil
+}
+
+func (r *PostgresRepository) UpdateDescription(ctx context.Context, name, description string) (*models.PromptTemplate, error) {
+	query := `
+		UPDATE prompt_templates
+		SET description = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE name = $1
+		RETURNING id, created_at, updated_at, name, description, active_version
+	`
+
+	var template models.PromptTemplate
+	if err := r.db.GetContext(ctx, &template, query, name, description); err != nil {
+		return nil, errorutils.AnalyzeDBErr(err)
+	}
+
+	return &template, nil
+}
+
+// Delete removes a template, its versions are removed by the cascade
+func (r *PostgresRepository) Delete(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM prompt_templates WHERE name = $1`, name)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errorutils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) ListVersions(ctx context.Context, templateID uuid.UUID) ([]models.PromptTemplateVersion, error) {
+	query := `
+		SELECT id, created_at, template_id, version, system, content, created_by
+		FROM prompt_template_versions
+		WHERE template_id = $1
+		ORDER BY version DESC
+	`
+
+	versions := []models.PromptTemplateVersion{}
+	err := r.db.SelectContext(ctx, &versions, query, templateID)
+	return versions, err
+}
+
+func (r *PostgresRepository) GetVersion(ctx context.Context, name string, version int) (*models.PromptTemplateVersion, error) {
+	query := `
+		SELECT v.id, v.created_at, v.template_id, v.version, v.system, v.content, v.created_by
+		FROM prompt_template_versions v
+		JOIN prompt_templates t ON t.id = v.template_id
+		WHERE t.name = $1 AND v.version = $2
+	`
+
+	var templateVersion models.PromptTemplateVersion
+	if err := r.db.GetContext(ctx, &templateVersion, query, name, version); err != nil {
+		return nil, errorutils.AnalyzeDBErr(err)
+	}
+
+	return &templateVersion, nil
+}
+
+func (r *PostgresRepository) GetActiveVersion(ctx context.Context, name string) (*models.PromptTemplateVersion, error) {
+	query := `
+		SELECT v.id, v.created_at, v.template_id, v.version, v.system, v.content, v.created_by
+		FROM prompt_template_versions v
+		JOIN prompt_templates t ON t.id = v.template_id AND t.active_version = v.version
+		WHERE t.name = $1
+	`
+
+	var templateVersion models.PromptTemplateVersion
+	if err := r.db.GetContext(ctx, &templateVersion, query, name); err != nil {
+		return nil, errorutils.AnalyzeDBErr(err)
+	}
+
+	return &templateVersion, nil
+}
+
+/**
+* Adds the next version of a template. The template row is locked so that
+* concurrent writers get consecutive version numbers. When activate is set the
+* new version also becomes the active one.
+**/
+func (r *PostgresRepository) AddVersion(ctx context.Context, name string, version *models.PromptTemplateVersion, activate bool) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowxContext(ctx, `SELECT id FROM prompt_templates WHERE name = $1 FOR UPDATE`, name).
+		Scan(&version.TemplateID)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	err = tx.QueryRowxContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1
+		FROM prompt_template_versions
+		WHERE template_id = $1
+	`, version.TemplateID).Scan(&version.Version)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	if err := insertVersion(ctx, tx, version); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE prompt_templates
+		SET updated_at = CURRENT_TIMESTAMP,
+			active_version = CASE WHEN $2 THEN $3 ELSE active_version END
+		WHERE id = $1
+	`, version.TemplateID, activate, version.Version)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	return tx.Commit()
+}
+
+// SetActiveVersion points a template at one of its existing versions
+func (r *PostgresRepository) SetActiveVersion(ctx context.Context, name string, version int) error {
+	query := `
+		UPDATE prompt_templates t
+		SET active_version = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE t.name = $1 AND EXISTS (
+			SELECT 1 FROM prompt_template_versions v
+			WHERE v.template_id = t.id AND v.version = $2
+		)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, name, version)
+	if err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errorutils.ErrNotFound
+	}
+
+	return nil
+}
+
+func insertVersion(ctx context.Context, tx *sqlx.Tx, version *models.PromptTemplateVersion) error {
+	err := tx.QueryRowxContext(ctx, `
+		INSERT INTO prompt_template_versions (template_id, version, system, content, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, version.TemplateID, version.Version, version.System, version.Content, version.CreatedBy).
+		Scan(&version.ID, &version.CreatedAt)
+
+	return errorutils.AnalyzeDBErr(err)
+}
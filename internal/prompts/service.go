@@ -0,0 +1,207 @@
+package prompts
+
+import (
+	"ai-workshop/internal/models"
+	"ai-workshop/internal/utils/errorutils"
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// template names are used in urls and in chat requests, e.g. energy-analyst
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,99}$`)
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+/**
+* Creates a template with its first version. The template is rendered once
+* against the sample data so that broken templates are rejected when saved
+* rather than when a chat request uses them.
+**/
+func (s *Service) CreateTemplate(ctx context.Context, userID *uuid.UUID, req CreateTemplateRequest) (*TemplateDetail, error) {
+	if !namePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name may only contain letters, digits, '_', '-' and '.'", errorutils.ErrInvalidInput)
+	}
+	if err := validate(req.Name, req.System, req.Content); err != nil {
+		return nil, err
+	}
+
+	template := &models.PromptTemplate{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	version := &models.PromptTemplateVersion{
+		System:    req.System,
+		Content:   req.Content,
+		CreatedBy: userID,
+	}
+
+	if err := s.repo.Create(ctx, template, version); err != nil {
+		return nil, err
+	}
+
+	return &TemplateDetail{
+		PromptTemplate: *template,
+		Active:         version,
+		Versions:       []models.PromptTemplateVersion{*version},
+	}, nil
+}
+
+func (s *Service) ListTemplates(ctx context.Context) ([]models.PromptTemplate, error) {
+	return s.repo.List(ctx)
+}
+
+/**
+* Gets a template with its active version and all of its versions, newest
+* first.
+**/
+func (s *Service) GetTemplate(ctx context.Context, name string) (*TemplateDetail, error) {
+	template, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.repo.ListVersions(ctx, template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &TemplateDetail{
+		PromptTemplate: *template,
+		Versions:       versions,
+	}
+	for i := range versions {
+		if versions[i].Version == template.ActiveVersion {
+			detail.Active = &versions[i]
+		}
+	}
+
+	return detail, nil
+}
+
+func (s *Service) UpdateTemplate(ctx context.Context, name string, req UpdateTemplateRequest) (*models.PromptTemplate, error) {
+	return s.repo.UpdateDescription(ctx, name, req.Description)
+}
+
+func (s *Service) DeleteTemplate(ctx context.Context, name string) error {
+	return s.repo.Delete(ctx, name)
+}
+
+func (s *Service) ListVersions(ctx context.Context, name string) ([]models.PromptTemplateVersion, error) {
+	template, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListVersions(ctx, template.ID)
+}
+
+/**
+* Adds a new version to a template. Versions are never edited in place, so a
+* conversation can always be traced back to the exact prompt it was answered
+* with.
+**/
+func (s *Service) CreateVersion(ctx context.Context, userID *uuid.UUID, name string, req CreateVersionRequest) (*models.PromptTemplateVersion, error) {
+	if err := validate(name, req.System, req.Content); err != nil {
+		return nil, err
+	}
+
+	version := &models.PromptTemplateVersion{
+		System:    req.System,
+		Content:   req.Content,
+		CreatedBy: userID,
+	}
+
+	if err := s.repo.AddVersion(ctx, name, version, req.Activate); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+func (s *Service) ActivateVersion(ctx context.Context, name string, version int) error {
+	return s.repo.SetActiveVersion(ctx, name, version)
+}
+
+/**
+* Loads and parses a saved template, version 0 means the active version.
+**/
+func (s *Service) Resolve(ctx context.Context, name string, version int) (*Template, error) {
+	var stored *models.PromptTemplateVersion
+	var err error
+	if version > 0 {
+		stored, err = s.repo.GetVersion(ctx, name, version)
+	} else {
+		stored, err = s.repo.GetActiveVersion(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(name, stored.Version, stored.System, stored.Content)
+}
+
+/**
+* Renders a saved template or an unsaved draft against the request's
+* question and documents, falling back to the built-in samples.
+**/
+func (s *Service) Preview(ctx context.Context, req PreviewRequest) (*Template, Rendered, error) {
+	var template *Template
+	var err error
+	switch {
+	case req.Content != "":
+		template, err = Parse("preview", 0, req.System, req.Content)
+	case req.Name != "":
+		template, err = s.Resolve(ctx, req.Name, req.Version)
+	default:
+		template = Default()
+	}
+	if err != nil {
+		return nil, Rendered{}, err
+	}
+
+	data := Data{
+		Question:  req.Question,
+		Documents: req.Documents,
+		Vars:      req.Variables,
+	}
+	if data.Question == "" {
+		data.Question = SampleQuestion
+	}
+	if data.Documents == nil {
+		data.Documents = SampleDocuments()
+	}
+	for i := range data.Documents {
+		if data.Documents[i].Index == 0 {
+			data.Documents[i].Index = i + 1
+		}
+	}
+
+	rendered, err := template.Render(data)
+	if err != nil {
+		return nil, Rendered{}, err
+	}
+
+	return template, rendered, nil
+}
+
+// validate parses a template and renders it against the sample data
+func validate(name, system, content string) error {
+	template, err := Parse(name, 0, system, content)
+	if err != nil {
+		return err
+	}
+
+	_, err = template.Render(Data{Question: SampleQuestion, Documents: SampleDocuments()})
+	return err
+}
@@ -0,0 +1,155 @@
+package prompts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ErrInvalidTemplate is returned when a template does not parse or fails to render
+var ErrInvalidTemplate = errors.New("invalid prompt template")
+
+/**
+* The built-in rag prompt, used when a request does not name a template.
+* Documents are numbered so that citations like [1] in the answer can be
+* mapped back to the sources.
+**/
+const DefaultRAGContent = `你是一個智能助手。請基於以下提供的上下文資料來回答用戶的問題。如果無法從上下文中找到答案，請誠實地說明你不知道，不要編造答案。
+回答時請在引用資料的句子後標註對應的文檔編號，例如 [1] 或 [1][2]，只能使用下方列出的編號。
+
+### 上下文資料：
+{{range .Documents}}[{{.Index}}]{{if .SourceFile}}（來源：{{.SourceFile}}）{{else}} {{end}}{{.Text}}
+
+{{end}}### 用戶問題：
+{{.Question}}
+
+### 回答：
+`
+
+// Document is one retrieved chunk as seen by a template, Index starts at 1
+type Document struct {
+	Index      int     `json:"index"`
+	Text       string  `json:"text"`
+	SourceFile string  `json:"sourceFile,omitempty"`
+	Score      float64 `json:"score"`
+}
+
+/**
+* Data is what templates are rendered against. Documents is empty for plain
+* chat requests, Vars holds request supplied variables and missing keys
+* render as an empty string.
+**/
+type Data struct {
+	Question  string
+	Documents []Document
+	Vars      map[string]string
+	Today     string
+}
+
+// Rendered is a rendered template, System is empty when the template has none
+type Rendered struct {
+	System  string `json:"system"`
+	Content string `json:"content"`
+}
+
+// Template is a parsed prompt template ready to be rendered
+type Template struct {
+	Name    string
+	Version int
+	system  *template.Template
+	content *template.Template
+}
+
+/**
+* Parses the system and content parts of a template. The content part is
+* required, the system part is optional.
+**/
+func Parse(name string, version int, system, content string) (*Template, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidTemplate)
+	}
+
+	tmpl := &Template{Name: name, Version: version}
+
+	var err error
+	if tmpl.content, err = parsePart(name+".content", content); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(system) != "" {
+		if tmpl.system, err = parsePart(name+".system", system); err != nil {
+			return nil, err
+		}
+	}
+
+	return tmpl, nil
+}
+
+// the built-in template is parsed once, templates are safe for concurrent use
+var defaultTemplate = mustParse("default", DefaultRAGContent)
+
+// Default returns the built-in rag template
+func Default() *Template {
+	return defaultTemplate
+}
+
+func mustParse(name, content string) *Template {
+	tmpl, err := Parse(name, 0, "", content)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// Render executes the template, Today is filled in when the caller left it empty
+func (t *Template) Render(data Data) (Rendered, error) {
+	if data.Today == "" {
+		data.Today = time.Now().Format("2006-01-02")
+	}
+
+	var rendered Rendered
+	var err error
+	if rendered.Content, err = execute(t.content, data); err != nil {
+		return Rendered{}, err
+	}
+	if t.system != nil {
+		if rendered.System, err = execute(t.system, data); err != nil {
+			return Rendered{}, err
+		}
+	}
+
+	return rendered, nil
+}
+
+func parsePart(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return tmpl, nil
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return buf.String(), nil
+}
+
+/**
+* Sample retrieval results used by the preview endpoint when the request does
+* not bring its own documents.
+**/
+func SampleDocuments() []Document {
+	return []Document{
+		{Index: 1, Text: "2024 年 3 月總用電量為 12,450 kWh，較去年同期下降 8%。", SourceFile: "energy_report_2024.pdf", Score: 0.89},
+		{Index: 2, Text: "空調系統佔夏季尖峰用電的 45%，建議將設定溫度調高至 26°C。", SourceFile: "energy_saving_guide.docx", Score: 0.81},
+		{Index: 3, Text: "Employees may carry over up to five days of unused annual leave to the next year.", Score: 0.64},
+	}
+}
+
+// SampleQuestion is the question used by the preview endpoint when none is given
+const SampleQuestion = "上個月的用電量比去年同期少了多少？"
@@ -0,0 +1,115 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"ai-workshop/internal/documents"
+)
+
+// CrossEncoderReranker 呼叫 Cohere / Jina 相容的 rerank API（vLLM、Infinity、LocalAI 等也提供相同格式）
+// 請求為 {"model", "query", "documents", "top_n"}，回應為 {"results": [{"index", "relevance_score"}]}
+type CrossEncoderReranker struct {
+	endpoint string
+	apiKey   string
+	model    string
+	client   *http.Client
+}
+
+// NewCrossEncoderReranker 創建 cross-encoder 重排器，endpoint 為完整的 rerank 路徑，例如 https://api.jina.ai/v1/rerank
+func NewCrossEncoderReranker(endpoint, apiKey, model string, timeout time.Duration) *CrossEncoderReranker {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &CrossEncoderReranker{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		model:    model,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type crossEncoderRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+type crossEncoderResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// Rerank 依服務返回的 relevance_score 排序，服務只返回前 topK 筆
+func (r *CrossEncoderReranker) Rerank(ctx context.Context, query string, docs []documents.Document, topK int) ([]documents.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
+	}
+
+	body, err := json.Marshal(crossEncoderRequest{
+		Model:     r.model,
+		Query:     query,
+		Documents: texts,
+		TopN:      topK,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化重排請求失敗: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("創建重排請求失敗: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("發送重排請求失敗: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("讀取重排回應失敗: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("重排失敗: HTTP %d, 回應: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result crossEncoderResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析重排回應失敗: %v", err)
+	}
+
+	reranked := make([]documents.Document, 0, len(result.Results))
+	for _, item := range result.Results {
+		if item.Index < 0 || item.Index >= len(docs) {
+			return nil, fmt.Errorf("重排回應的索引 %d 超出範圍", item.Index)
+		}
+		doc := docs[item.Index]
+		doc.RerankScore = item.RelevanceScore
+		reranked = append(reranked, doc)
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].RerankScore > reranked[j].RerankScore
+	})
+
+	return keepTop(reranked, topK), nil
+}
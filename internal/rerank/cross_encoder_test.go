@@ -0,0 +1,100 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ai-workshop/internal/documents"
+)
+
+// TestCrossEncoderReranker 確認請求格式、依 relevance_score 排序，以及超出範圍的索引與錯誤狀態碼
+func TestCrossEncoderReranker(t *testing.T) {
+	docs := []documents.Document{
+		{ID: "1", Text: "一月用電量"},
+		{ID: "2", Text: "二月用電量"},
+		{ID: "3", Text: "三月用電量"},
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantIDs  []string
+		wantErr  string
+	}{
+		{
+			name:     "依分數排序",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 0, "relevance_score": 0.2}, {"index": 2, "relevance_score": 0.9}]}`,
+			wantIDs:  []string{"3", "1"},
+		},
+		{
+			name:     "索引超出範圍",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 3, "relevance_score": 0.9}]}`,
+			wantErr:  "超出範圍",
+		},
+		{
+			name:     "負數索引",
+			status:   http.StatusOK,
+			response: `{"results": [{"index": -1, "relevance_score": 0.9}]}`,
+			wantErr:  "超出範圍",
+		},
+		{
+			name:     "服務錯誤",
+			status:   http.StatusTooManyRequests,
+			response: `{"error": "rate limited"}`,
+			wantErr:  "HTTP 429",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization 為 %q", got)
+				}
+				var req crossEncoderRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("解析重排請求失敗: %v", err)
+				}
+				want := crossEncoderRequest{Model: "rerank-v1", Query: "用電量", Documents: []string{"一月用電量", "二月用電量", "三月用電量"}, TopN: 2}
+				if !reflect.DeepEqual(req, want) {
+					t.Errorf("重排請求為 %+v，預期 %+v", req, want)
+				}
+
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			reranker := NewCrossEncoderReranker(server.URL, "secret", "rerank-v1", 0)
+			reranked, err := reranker.Rerank(context.Background(), "用電量", docs, 2)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("錯誤為 %v，預期包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("重排失敗: %v", err)
+			}
+
+			ids := make([]string, len(reranked))
+			for i, doc := range reranked {
+				ids[i] = doc.ID
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("重排結果為 %v，預期 %v", ids, tt.wantIDs)
+			}
+			if reranked[0].RerankScore != 0.9 {
+				t.Errorf("第一筆的 RerankScore 為 %f，預期 0.9", reranked[0].RerankScore)
+			}
+		})
+	}
+}
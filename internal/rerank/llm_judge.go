@@ -0,0 +1,112 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// judgeMaxRunes 是每個片段放進評分提示詞的長度上限（字元），避免候選太多時超出模型的上下文
+const judgeMaxRunes = 800
+
+// judgeMaxScore 是評分的滿分，RerankScore 會除以滿分正規化為 0 到 1
+const judgeMaxScore = 10
+
+// judgeScorePattern 匹配評分回應中的「[3]: 8」、「3：7.5」等行
+var judgeScorePattern = regexp.MustCompile(`(?m)^\s*\[?(\d+)\]?\s*[:：]\s*(\d+(?:\.\d+)?)`)
+
+// LLMReranker 以 LLM 作為評審，一次請求為所有候選片段評分
+type LLMReranker struct {
+	provider llm.LLMProvider
+}
+
+func NewLLMReranker(provider llm.LLMProvider) *LLMReranker {
+	return &LLMReranker{
+		provider: provider,
+	}
+}
+
+// Rerank 依 LLM 給的分數排序，同分時保留檢索的順序；回應中沒有評到分的片段排在最後
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []documents.Document, topK int) ([]documents.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	response, err := r.provider.GenerateChatContent(ctx, []llm.Message{
+		{Role: llm.RoleUser, Content: buildJudgePrompt(query, docs)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LLM 評分失敗: %w", err)
+	}
+
+	scores := parseJudgeScores(response, len(docs))
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("無法解析 LLM 的評分: %q", response)
+	}
+
+	reranked := make([]documents.Document, len(docs))
+	copy(reranked, docs)
+	for i := range reranked {
+		reranked[i].RerankScore = -1
+		if score, ok := scores[i]; ok {
+			reranked[i].RerankScore = score / judgeMaxScore
+		}
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].RerankScore > reranked[j].RerankScore
+	})
+
+	for i := range reranked {
+		if reranked[i].RerankScore < 0 {
+			reranked[i].RerankScore = 0
+		}
+	}
+	return keepTop(reranked, topK), nil
+}
+
+// buildJudgePrompt 構建評分提示詞，片段以 [n] 編號
+func buildJudgePrompt(query string, docs []documents.Document) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("請評估以下每個文檔與問題的相關程度，以 0 到 %d 的整數評分：%d 表示文檔能直接回答問題，0 表示完全無關。\n", judgeMaxScore, judgeMaxScore))
+	sb.WriteString("每個文檔輸出一行「編號: 分數」，例如 [1]: 7，不要輸出其他內容。\n\n")
+
+	sb.WriteString("### 問題：\n")
+	sb.WriteString(query)
+	sb.WriteString("\n\n### 文檔：\n")
+	for i, doc := range docs {
+		text := []rune(doc.Text)
+		if len(text) > judgeMaxRunes {
+			text = append(text[:judgeMaxRunes], []rune("…")...)
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s\n\n", i+1, string(text)))
+	}
+
+	sb.WriteString("### 評分：\n")
+	return sb.String()
+}
+
+// parseJudgeScores 解析評分回應，返回以 0 起算的片段索引對應的分數，超出範圍的編號與分數會被略過
+func parseJudgeScores(response string, count int) map[int]float64 {
+	scores := make(map[int]float64)
+	for _, match := range judgeScorePattern.FindAllStringSubmatch(response, -1) {
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 || index > count {
+			continue
+		}
+		score, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || score > judgeMaxScore {
+			continue
+		}
+		if _, exists := scores[index-1]; !exists {
+			scores[index-1] = score
+		}
+	}
+	return scores
+}
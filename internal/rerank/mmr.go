@@ -0,0 +1,103 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// MMRReranker 以 Maximal Marginal Relevance 挑選片段：每一步選擇與問題最相關、同時與已選片段最不相似的片段，
+// 避免多個內容幾乎相同的片段（例如同一份文件的重複段落）佔滿上下文
+type MMRReranker struct {
+	embedder      llm.EmbeddingProvider
+	embeddingType llm.EmbeddingType
+	lambda        float64
+}
+
+func NewMMRReranker(embedder llm.EmbeddingProvider, embeddingType llm.EmbeddingType, lambda float64) *MMRReranker {
+	return &MMRReranker{
+		embedder:      embedder,
+		embeddingType: embeddingType,
+		lambda:        lambda,
+	}
+}
+
+// Rerank 依 MMR 的挑選順序返回前 topK 筆，RerankScore 為片段被選中時的 MMR 分數
+// 片段的向量以檢索使用的嵌入模型重新計算，寫入時已嵌入過的文字會命中嵌入快取
+func (r *MMRReranker) Rerank(ctx context.Context, query string, docs []documents.Document, topK int) ([]documents.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	texts := make([]string, 0, len(docs)+1)
+	texts = append(texts, query)
+	for _, doc := range docs {
+		texts = append(texts, doc.Text)
+	}
+	vectors, err := r.embedder.CreateBatchEmbeddingsWith(ctx, r.embeddingType, texts)
+	if err != nil {
+		return nil, fmt.Errorf("生成 MMR 嵌入向量失敗: %w", err)
+	}
+	queryVector, docVectors := vectors[0], vectors[1:]
+
+	relevance := make([]float64, len(docs))
+	for i, vector := range docVectors {
+		relevance[i] = cosineSimilarity(queryVector, vector)
+	}
+
+	if topK <= 0 || topK > len(docs) {
+		topK = len(docs)
+	}
+
+	selected := make([]int, 0, topK)
+	chosen := make([]bool, len(docs))
+	reranked := make([]documents.Document, 0, topK)
+	for len(selected) < topK {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range docs {
+			if chosen[i] {
+				continue
+			}
+
+			// 與已選片段的最大相似度
+			redundancy := 0.0
+			for _, j := range selected {
+				redundancy = math.Max(redundancy, cosineSimilarity(docVectors[i], docVectors[j]))
+			}
+
+			score := r.lambda*relevance[i] - (1-r.lambda)*redundancy
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		chosen[best] = true
+		selected = append(selected, best)
+		doc := docs[best]
+		doc.RerankScore = bestScore
+		reranked = append(reranked, doc)
+	}
+
+	return reranked, nil
+}
+
+// cosineSimilarity 計算兩個向量的餘弦相似度，長度不同或為零向量時返回 0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
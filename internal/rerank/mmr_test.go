@@ -0,0 +1,84 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// fakeEmbedder 依文字返回固定的向量
+type fakeEmbedder map[string][]float32
+
+func (e fakeEmbedder) CreateEmbeddingWith(ctx context.Context, embeddingType llm.EmbeddingType, text string) ([]float32, error) {
+	vector, ok := e[text]
+	if !ok {
+		return nil, fmt.Errorf("沒有 %q 的向量", text)
+	}
+	return vector, nil
+}
+
+func (e fakeEmbedder) CreateBatchEmbeddingsWith(ctx context.Context, embeddingType llm.EmbeddingType, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, err := e.CreateEmbeddingWith(ctx, embeddingType, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func (e fakeEmbedder) GetDimensionFor(embeddingType llm.EmbeddingType) (int, error) {
+	return 2, nil
+}
+
+// TestMMRRerankerOrder 確認 lambda 越小越會跳過與已選片段幾乎相同的片段
+func TestMMRRerankerOrder(t *testing.T) {
+	embedder := fakeEmbedder{
+		"用電量":    {1, 0},
+		"三月用電量":  {1, 0},
+		"三月的用電量": {0.99, 0.14}, // 與「三月用電量」幾乎相同
+		"節能建議":   {0.6, 0.8},
+	}
+	docs := []documents.Document{
+		{ID: "1", Text: "三月用電量"},
+		{ID: "2", Text: "三月的用電量"},
+		{ID: "3", Text: "節能建議"},
+	}
+
+	tests := []struct {
+		name   string
+		lambda float64
+		topK   int
+		want   []string
+	}{
+		{"只看相關性", 1, 0, []string{"1", "2", "3"}},
+		{"偏向多樣性", 0.3, 0, []string{"1", "3", "2"}},
+		{"只保留 topK 筆", 0.3, 2, []string{"1", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reranked, err := NewMMRReranker(embedder, llm.EmbeddingTypeFake, tt.lambda).Rerank(context.Background(), "用電量", docs, tt.topK)
+			if err != nil {
+				t.Fatalf("重排失敗: %v", err)
+			}
+
+			ids := make([]string, len(reranked))
+			for i, doc := range reranked {
+				ids[i] = doc.ID
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("挑選順序為 %v，預期 %v", ids, tt.want)
+			}
+			if reranked[0].RerankScore != tt.lambda {
+				t.Errorf("第一筆的 MMR 分數為 %f，預期 %f", reranked[0].RerankScore, tt.lambda)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package rerank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ai-workshop/internal/config"
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+)
+
+// Method 是重排檢索結果的方式
+type Method string
+
+const (
+	MethodNone         Method = "none"          // 不重排，直接使用檢索的排名
+	MethodLLM          Method = "llm"           // 由 LLM 評估每個片段與問題的相關程度
+	MethodCrossEncoder Method = "cross_encoder" // 呼叫 cross-encoder 重排服務
+	MethodMMR          Method = "mmr"           // 以嵌入向量做 Maximal Marginal Relevance，兼顧相關性與多樣性
+)
+
+const (
+	// DefaultCandidates 是重排前從檢索取回的候選數量
+	DefaultCandidates = 20
+	// MaxCandidates 是候選數量的上限，避免一次請求送出過多片段給重排器
+	MaxCandidates = 100
+	// DefaultLambda 是 MMR 中相關性的權重，1 為只看相關性，0 為只看多樣性
+	DefaultLambda = 0.7
+)
+
+var (
+	// ErrInvalidOptions 表示請求的重排設定無效
+	ErrInvalidOptions = errors.New("無效的重排設定")
+	// ErrCrossEncoderUnavailable 表示未設定 cross-encoder 重排服務
+	ErrCrossEncoderUnavailable = errors.New("未設定 cross-encoder 重排服務（RERANK_ENDPOINT）")
+)
+
+// Options 是單一請求的重排設定：先檢索 Candidates（N）筆候選，重排後保留 TopK（K）筆
+type Options struct {
+	Method     Method      `json:"method,omitempty"`
+	Candidates int         `json:"candidates,omitempty"` // N，預設 DefaultCandidates
+	TopK       int         `json:"top_k,omitempty"`      // K，預設由呼叫端決定
+	Lambda     float64     `json:"lambda,omitempty"`     // 只用於 mmr，預設 DefaultLambda
+	Model      llm.LLMType `json:"model,omitempty"`      // 只用於 llm，評分使用的模型，預設為回答問題的模型
+}
+
+// Enabled 表示是否需要重排
+func (o Options) Enabled() bool {
+	return o.Method != "" && o.Method != MethodNone
+}
+
+// Normalize 填入預設值並檢查設定，topK 為呼叫端預設保留的數量
+func (o Options) Normalize(topK int) (Options, error) {
+	o.Method = Method(strings.ToLower(strings.TrimSpace(string(o.Method))))
+	switch o.Method {
+	case "", MethodNone, MethodLLM, MethodCrossEncoder, MethodMMR:
+	default:
+		return o, fmt.Errorf("%w: 未知的重排方式 %s，可用 none、llm、cross_encoder 或 mmr", ErrInvalidOptions, o.Method)
+	}
+
+	if o.TopK <= 0 {
+		o.TopK = topK
+	}
+	if o.Candidates <= 0 {
+		o.Candidates = max(DefaultCandidates, o.TopK)
+	}
+	if o.Candidates > MaxCandidates {
+		return o, fmt.Errorf("%w: candidates 不可超過 %d", ErrInvalidOptions, MaxCandidates)
+	}
+	if o.Candidates < o.TopK {
+		return o, fmt.Errorf("%w: candidates（%d）不可小於 top_k（%d）", ErrInvalidOptions, o.Candidates, o.TopK)
+	}
+
+	if o.Lambda == 0 {
+		o.Lambda = DefaultLambda
+	}
+	if o.Lambda < 0 || o.Lambda > 1 {
+		return o, fmt.Errorf("%w: lambda 需介於 0 與 1 之間", ErrInvalidOptions)
+	}
+	return o, nil
+}
+
+// Reranker 將檢索到的候選片段依與問題的相關程度重新排序，返回前 topK 筆並填入 RerankScore
+type Reranker interface {
+	Rerank(ctx context.Context, query string, docs []documents.Document, topK int) ([]documents.Document, error)
+}
+
+// Rerankers 依請求的設定建立對應的重排器
+type Rerankers struct {
+	llmFactory   *llm.Factory
+	crossEncoder *CrossEncoderReranker // 未設定 RERANK_ENDPOINT 時為 nil
+}
+
+// NewRerankers 創建重排器集合，cross-encoder 只有在設定 RERANK_ENDPOINT 時可用
+func NewRerankers(llmFactory *llm.Factory, appConfig *config.Config) *Rerankers {
+	rerankers := &Rerankers{
+		llmFactory: llmFactory,
+	}
+	if appConfig.RerankEndpoint != "" {
+		rerankers.crossEncoder = NewCrossEncoderReranker(appConfig.RerankEndpoint, appConfig.RerankAPIKey, appConfig.RerankModel, appConfig.RerankTimeout)
+	}
+	return rerankers
+}
+
+// For 返回設定指定的重排器，opts 需先經過 Normalize；不需要重排時返回 nil
+// embeddingType 為檢索使用的嵌入模型，MMR 以同一個模型計算片段間的相似度
+func (r *Rerankers) For(opts Options, embeddingType llm.EmbeddingType) (Reranker, error) {
+	switch opts.Method {
+	case "", MethodNone:
+		return nil, nil
+	case MethodLLM:
+		provider, err := r.llmFactory.Get(opts.Model)
+		if err != nil {
+			return nil, fmt.Errorf("取得重排模型失敗: %w", err)
+		}
+		return NewLLMReranker(provider), nil
+	case MethodCrossEncoder:
+		if r.crossEncoder == nil {
+			return nil, ErrCrossEncoderUnavailable
+		}
+		return r.crossEncoder, nil
+	case MethodMMR:
+		embedder, err := r.llmFactory.EmbeddingProviderFor(embeddingType)
+		if err != nil {
+			return nil, fmt.Errorf("取得嵌入提供者失敗: %w", err)
+		}
+		return NewMMRReranker(embedder, embeddingType, opts.Lambda), nil
+	}
+	return nil, fmt.Errorf("%w: 未知的重排方式 %s", ErrInvalidOptions, opts.Method)
+}
+
+// HTTPStatus 返回重排錯誤對應的 HTTP 狀態碼：無效的設定為 400，未設定 cross-encoder 為 503，其餘依 llm.HTTPStatus
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidOptions):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrCrossEncoderUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return llm.HTTPStatus(err)
+}
+
+// keepTop 截取前 topK 筆
+func keepTop(docs []documents.Document, topK int) []documents.Document {
+	if topK > 0 && len(docs) > topK {
+		return docs[:topK]
+	}
+	return docs
+}
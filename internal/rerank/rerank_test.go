@@ -0,0 +1,103 @@
+package rerank
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestParseJudgeScores 確認評分回應的各種格式都能解析，超出範圍的編號與分數被略過
+func TestParseJudgeScores(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     map[int]float64
+	}{
+		{"方括號編號", "[1]: 8\n[2]: 3", map[int]float64{0: 8, 1: 3}},
+		{"全形冒號與小數", "1：7.5\n 2 : 0", map[int]float64{0: 7.5, 1: 0}},
+		{"編號超出範圍", "[0]: 5\n[4]: 6\n[3]: 9", map[int]float64{2: 9}},
+		{"分數超過滿分", "[1]: 11\n[2]: 10", map[int]float64{1: 10}},
+		{"重複的編號以第一個為準", "[1]: 4\n[1]: 9", map[int]float64{0: 4}},
+		{"忽略不是評分的行", "評分如下：\n[2]: 6\n以上", map[int]float64{1: 6}},
+		{"無法解析", "都很相關", map[int]float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseJudgeScores(tt.response, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("解析結果為 %v，預期 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOptionsNormalize 確認 N（candidates）與 K（top_k）的預設值與檢查
+func TestOptionsNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		topK    int
+		want    Options
+		wantErr bool
+	}{
+		{
+			name: "預設值",
+			opts: Options{Method: " MMR "},
+			topK: 5,
+			want: Options{Method: MethodMMR, Candidates: DefaultCandidates, TopK: 5, Lambda: DefaultLambda},
+		},
+		{
+			name: "top_k 大於預設候選數時候選數跟著放大",
+			opts: Options{Method: MethodLLM, TopK: 30},
+			topK: 5,
+			want: Options{Method: MethodLLM, Candidates: 30, TopK: 30, Lambda: DefaultLambda},
+		},
+		{
+			name: "保留指定的 N 與 K",
+			opts: Options{Method: MethodCrossEncoder, Candidates: 50, TopK: 10, Lambda: 0.3},
+			topK: 5,
+			want: Options{Method: MethodCrossEncoder, Candidates: 50, TopK: 10, Lambda: 0.3},
+		},
+		{
+			name:    "N 小於 K",
+			opts:    Options{Method: MethodLLM, Candidates: 3, TopK: 5},
+			wantErr: true,
+		},
+		{
+			name:    "N 超過上限",
+			opts:    Options{Method: MethodLLM, Candidates: MaxCandidates + 1},
+			topK:    5,
+			wantErr: true,
+		},
+		{
+			name:    "lambda 超出範圍",
+			opts:    Options{Method: MethodMMR, Lambda: 1.5},
+			topK:    5,
+			wantErr: true,
+		},
+		{
+			name:    "未知的方式",
+			opts:    Options{Method: "bm25"},
+			topK:    5,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.Normalize(tt.topK)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidOptions) {
+					t.Errorf("錯誤為 %v，預期 ErrInvalidOptions", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("檢查設定失敗: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("設定為 %+v，預期 %+v", got, tt.want)
+			}
+		})
+	}
+}
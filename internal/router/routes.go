@@ -4,10 +4,16 @@ import (
 	"ai-workshop/internal/auth"
 	"ai-workshop/internal/chat"
 	"ai-workshop/internal/config"
+	"ai-workshop/internal/conversation"
 	"ai-workshop/internal/documents"
 	"ai-workshop/internal/energy"
+	"ai-workshop/internal/health"
 	"ai-workshop/internal/llm"
+	"ai-workshop/internal/milvus"
+	"ai-workshop/internal/prompts"
+	"ai-workshop/internal/rerank"
 	"ai-workshop/internal/uploads"
+	"ai-workshop/internal/usage"
 	"ai-workshop/internal/user"
 	"fmt"
 
@@ -16,11 +22,6 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-// choose ai model
-const (
-	aiModel = llm.LLMTypeOpenAI
-)
-
 func SetupRoutes(config *config.Config, db *sqlx.DB) *gin.Engine {
 
 	// 設置 Gin 模式
@@ -42,26 +43,106 @@ func SetupRoutes(config *config.Config, db *sqlx.DB) *gin.Engine {
 	routes.StaticFile("/", "./static/index.html")
 	routes.StaticFile("/uploads", "./static/uploads.html")
 
-	// base route
+	// base route, the matched route is kept in the request context for llm usage accounting
 	api := routes.Group("/api")
+	api.Use(usage.Middleware())
+
+	// --- Conversations ---
+
+	// -- setup --
+	conversationRepo := conversation.NewRepository(db)
+	conversationService := conversation.NewService(conversationRepo)
+	conversationHandler := conversation.NewHandler(conversationService)
+
+	// -- routes --
+	conversationRoutes := api.Group("/conversations")
+	conversationRoutes.Use(auth.AuthMiddleware())
+	conversationRoutes.POST("", conversationHandler.CreateConversation)
+	conversationRoutes.GET("", conversationHandler.ListConversations)
+	conversationRoutes.GET("/:id", conversationHandler.GetConversation)
+	conversationRoutes.DELETE("/:id", conversationHandler.DeleteConversation)
+
+	// --- Vector store ---
+
+	// one llm factory and one milvus client shared by documents, chat and uploads
+	llmFactory := llm.NewFactory(config)
+	if config.EmbeddingCachePersist {
+		llmFactory.SetEmbeddingCacheStore(llm.NewPostgresEmbeddingCacheStore(db))
+	}
+
+	// every provider call is recorded in llm_usage with the calling user
+	usageService := usage.NewService(usage.NewRepository(db), usage.ParsePrices(config.LLMPrices))
+	if config.LLMUsageEnabled {
+		llmFactory.SetUsageRecorder(usageService)
+	}
+	milvusClient := milvus.NewClient(milvus.NewClientConfig(config))
+	documentService := documents.NewService(milvusClient, llmFactory)
+	// keyword index kept next to milvus for keyword / hybrid search
+	documentService.SetKeywordIndex(documents.NewPostgresKeywordIndex(db))
+
+	// --- Prompt templates ---
+
+	// -- setup --
+	promptService := prompts.NewService(prompts.NewRepository(db))
+	promptHandler := prompts.NewHandler(promptService)
+
+	// -- routes --
+	promptRoutes := api.Group("/prompts")
+	promptRoutes.Use(auth.AuthMiddleware())
+	promptRoutes.POST("", promptHandler.CreateTemplate)
+	promptRoutes.GET("", promptHandler.ListTemplates)
+	promptRoutes.POST("/preview", promptHandler.Preview)
+	promptRoutes.GET("/:name", promptHandler.GetTemplate)
+	promptRoutes.PUT("/:name", promptHandler.UpdateTemplate)
+	promptRoutes.DELETE("/:name", promptHandler.DeleteTemplate)
+	promptRoutes.GET("/:name/versions", promptHandler.ListVersions)
+	promptRoutes.POST("/:name/versions", promptHandler.CreateVersion)
+	promptRoutes.PUT("/:name/active", promptHandler.ActivateVersion)
 
 	// --- Chat ---
 
 	// -- setup --
-	chatService, err := chat.NewService(config)
+	chatService, err := chat.NewService(documentService, llmFactory, conversationService, rerank.NewRerankers(llmFactory, config), promptService)
 	if err != nil {
 		fmt.Printf("error when initiating chat handler: %v\n", err)
 	}
-	chatHandler := chat.NewHandler(chatService, aiModel, config)
+	// default ai model from config (DEFAULT_LLM), used when a chat request does not specify one;
+	// falls back to the first configured provider when that one is disabled
+	chatHandler := chat.NewHandler(chatService, llmFactory, llmFactory.DefaultModel(llm.LLMType(config.DefaultLLM)))
+
+	// -- routes --
+	// anonymous chat stays available, a token is only needed for conversation_id
+	chatRoutes := api.Group("")
+	chatRoutes.Use(auth.OptionalAuthMiddleware())
+	chatRoutes.POST("/chat", chatHandler.ChatHandler)
+	chatRoutes.POST("/rag", chatHandler.RagChatHandler)
+	chatRoutes.POST("/chat/stream", chatHandler.ChatStreamHandler)
+	chatRoutes.POST("/rag/stream", chatHandler.RagChatStreamHandler)
+	api.GET("/models", chatHandler.ListModels)
+	api.GET("/capabilities", chatHandler.Capabilities)
+
+	// --- Health ---
+
+	healthHandler := health.NewHandler(config, llmFactory)
+	api.GET("/health", healthHandler.Health)
+
+	// --- LLM usage ---
+
+	// -- setup --
+	usageHandler := usage.NewHandler(usageService)
 
 	// -- routes --
-	api.POST("/chat", chatHandler.ChatHandler)
-	api.POST("/rag", chatHandler.RagChatHandler)
+	usageRoutes := api.Group("/usage")
+	usageRoutes.Use(auth.AuthMiddleware())
+	usageRoutes.GET("/users", usageHandler.ByUser)
+	usageRoutes.GET("/models", usageHandler.ByModel)
+	usageRoutes.GET("/daily", usageHandler.ByDay)
+	usageRoutes.GET("/prices", usageHandler.ListPrices)
 
 	// --- Documents ---
 
 	// -- setup --
-	documentHandler := documents.NewHandler(config)
+	documentHandler := documents.NewHandler(documentService)
 
 	// -- routes --
 	// api.GET("/collections", documentHandler.ListCollections)
@@ -71,7 +152,8 @@ func SetupRoutes(config *config.Config, db *sqlx.DB) *gin.Engine {
 	api.POST("/documents/insert", documentHandler.InsertDocument)
 	api.POST("/documents/delete", documentHandler.DeleteDocument)
 	api.POST("/documents/delete/batch", documentHandler.DeleteDocuments)
-	api.POST("/documents/search", documentHandler.SearchDocuments)
+	api.POST("/documents/search", auth.OptionalAuthMiddleware(), documentHandler.SearchDocuments)
+	api.POST("/documents/keyword-index/rebuild", documentHandler.RebuildKeywordIndex)
 
 	// --- Energy (demo only) ---
 
@@ -98,9 +180,12 @@ func SetupRoutes(config *config.Config, db *sqlx.DB) *gin.Engine {
 				".pdf", ".doc", ".docx", ".txt", ".csv", ".xls", ".xlsx", ".json",
 				".jpg", ".jpeg", ".png", ".gif", ".mp3", ".mp4", ".html",
 			},
+			DefaultEmbeddingModel: llmFactory.DefaultEmbedding(),
 		},
 	)
-	uploadHandler := uploads.NewFileHandler(*uploadService, config)
+	vectorRepo := uploads.NewVectorRepository(db)
+	vectorIndexer := uploads.NewVectorIndexer(documentService, vectorRepo)
+	uploadHandler := uploads.NewFileHandler(*uploadService, config, llmFactory, vectorIndexer)
 
 	// -- routes --
 	api.POST("/upload", uploadHandler.UploadFile)
@@ -110,7 +195,9 @@ func SetupRoutes(config *config.Config, db *sqlx.DB) *gin.Engine {
 	api.GET("/download/:fileName", uploadHandler.HandleDownloadFile)
 	api.GET("/view/:fileName", uploadHandler.HandleServeFile)
 	api.GET("/embedding-models", uploadHandler.HandleGetEmbeddingModels)
-	api.POST("/process/:fileName", uploadHandler.HandleProcessFile)
+	api.POST("/process/:fileName", auth.OptionalAuthMiddleware(), uploadHandler.HandleProcessFile)
+	api.GET("/process/:fileName", uploadHandler.HandleListFileVectors)
+	api.DELETE("/process/:fileName", uploadHandler.HandleRemoveFileVectors)
 
 	// --- USER ---
 
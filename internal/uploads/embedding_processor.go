@@ -1,75 +1,99 @@
 package uploads
 
 import (
+	"ai-workshop/internal/chunking"
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/extractor"
 	"ai-workshop/internal/llm"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
 // EmbeddingProcessor 處理不同類型檔案的嵌入向量生成
 type EmbeddingProcessor struct {
-	openAIProvider *llm.OpenAIProvider
+	llmFactory *llm.Factory
+	indexer    *VectorIndexer // 為 nil 時只產生預覽，不寫入向量資料庫
 }
 
-// NewEmbeddingProcessor 創建新的嵌入處理器
-func NewEmbeddingProcessor(openAIKey string) *EmbeddingProcessor {
+// NewEmbeddingProcessor 創建新的嵌入處理器，嵌入提供者依嵌入類型從 llmFactory 取得
+func NewEmbeddingProcessor(llmFactory *llm.Factory, indexer *VectorIndexer) *EmbeddingProcessor {
 	return &EmbeddingProcessor{
-		openAIProvider: llm.NewOpenAiProvider(openAIKey),
+		llmFactory: llmFactory,
+		indexer:    indexer,
 	}
 }
 
-// ProcessFile 根據檔案類型和指定的模型處理檔案
-func (p *EmbeddingProcessor) ProcessFile(filePath string, fileType string, modelName string) (interface{}, error) {
+// ProcessOptions 是處理檔案時的設定
+type ProcessOptions struct {
+	Chunking chunking.Options // 切塊設定
+	OwnerID  string           // 上傳者的使用者 ID，匿名時為空字串
+	Tags     []string         // 寫入每個片段 metadata 的標籤，可用於過濾搜尋
+}
+
+// ProcessFile 根據檔案類型和指定的模型處理檔案，文字與文件類型會切塊後再生成嵌入向量並寫入向量資料庫
+func (p *EmbeddingProcessor) ProcessFile(ctx context.Context, filePath string, fileType string, modelName string, opts ProcessOptions) (interface{}, error) {
 	switch fileType {
 	case FileTypeText:
-		return p.processTextFile(filePath, modelName)
+		return p.processTextFile(ctx, filePath, modelName, opts)
 	case FileTypeAudio:
-		return p.processAudioFile(filePath, modelName)
+		return p.processAudioFile(ctx, filePath, modelName)
 	case FileTypeImage:
 		return p.processImageFile(filePath, modelName)
 	case FileTypeVideo:
 		return p.processVideoFile(filePath, modelName)
 	case FileTypeDocument:
-		return p.processDocumentFile(filePath, modelName)
+		return p.processDocumentFile(ctx, filePath, modelName, opts)
 	default:
 		return nil, fmt.Errorf("不支援的檔案類型：%s", fileType)
 	}
 }
 
 // processTextFile 處理文字類型檔案
-func (p *EmbeddingProcessor) processTextFile(filePath string, modelName string) (interface{}, error) {
-	// 讀取檔案內容
-	content, err := os.ReadFile(filePath)
+func (p *EmbeddingProcessor) processTextFile(ctx context.Context, filePath string, modelName string, opts ProcessOptions) (interface{}, error) {
+	// 抽取文字內容（CSV、HTML 等使用對應的抽取器，其餘直接讀取）
+	sections, err := extractor.Extract(filePath)
+	if errors.Is(err, extractor.ErrUnsupportedType) {
+		content, readErr := os.ReadFile(filePath)
+		if readErr != nil {
+			return nil, fmt.Errorf("讀取檔案失敗：%v", readErr)
+		}
+		sections, err = []extractor.Section{{Text: string(content)}}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("讀取檔案失敗：%v", err)
+		return nil, err
 	}
 
-	textContent := string(content)
+	textContent := extractor.JoinText(sections)
 
 	// 選擇合適的嵌入模型
-	var embeddingType llm.EmbeddingType
-	switch modelName {
-	case "text-embedding-3-small":
-		embeddingType = llm.EmbeddingTypeOpenAI3Small
-	case "text-embedding-3-large":
-		embeddingType = llm.EmbeddingTypeOpenAI3Large
-	case "text-embedding-ada-002":
-		embeddingType = llm.EmbeddingTypeOpenAI
-	default:
-		// 預設使用 OpenAI 的 3-small 模型
-		embeddingType = llm.EmbeddingTypeOpenAI3Small
+	embeddingType, err := p.embeddingTypeForModel(modelName)
+	if err != nil {
+		return nil, err
 	}
 
-	// 產生嵌入向量
-	embedding, err := p.openAIProvider.CreateEmbeddingWith(embeddingType, textContent)
+	// 切塊後逐塊產生嵌入向量
+	chunks, err := chunkSections(filepath.Base(filePath), sections, opts)
+	if err != nil {
+		return nil, err
+	}
+	chunkResults, vectors, err := p.embedChunks(ctx, embeddingType, chunks)
 	if err != nil {
-		return nil, fmt.Errorf("生成嵌入向量失敗：%v", err)
+		return nil, err
+	}
+
+	// 寫入向量資料庫，讓檔案內容可被 RAG 檢索
+	index, err := p.indexChunks(ctx, filePath, chunks, vectors, embeddingType)
+	if err != nil {
+		return nil, err
 	}
 
 	// 獲取模型維度
-	dimension, _ := p.openAIProvider.GetDimensionFor(embeddingType)
+	dimension, _ := p.dimensionFor(embeddingType)
 
 	// 返回結果
 	result := map[string]interface{}{
@@ -77,21 +101,131 @@ func (p *EmbeddingProcessor) processTextFile(filePath string, modelName string)
 		"fileType":    FileTypeText,
 		"contentSize": len(textContent),
 		"dimension":   dimension,
-		"embedding":   embedding[:10],                 // 只返回前10個元素作為預覽，避免過大的響應
+		"chunking":    opts.Chunking,
+		"chunkCount":  len(chunks),
+		"chunks":      chunkResults,
+		"index":       index,
 		"textPreview": truncateText(textContent, 200), // 截取前200個字符作為預覽
 	}
 
 	return result, nil
 }
 
-// truncateText 截取文本並確保不會中斷單詞
+// embeddingTypeForModel 以嵌入模型註冊表將上傳頁面使用的模型名稱（API 名稱或嵌入類型）對應到嵌入類型
+// 未指定時使用預設嵌入模型（DEFAULT_EMBEDDING_MODEL）
+func (p *EmbeddingProcessor) embeddingTypeForModel(modelName string) (llm.EmbeddingType, error) {
+	if modelName == "" {
+		return p.llmFactory.DefaultEmbedding(), nil
+	}
+	model, err := llm.EmbeddingModelByName(modelName)
+	if err != nil {
+		return "", fmt.Errorf("不支援的嵌入模型：%s", modelName)
+	}
+	return model.Type, nil
+}
+
+// chunkSections 將抽取出的段落依設定切塊，片段保留所屬段落的結構資訊、擁有者與標籤
+// 位置以 extractor.JoinText 串接後的全文計算，段落之間以兩個換行分隔
+func chunkSections(sourceFile string, sections []extractor.Section, opts ProcessOptions) ([]documents.Chunk, error) {
+	var chunks []documents.Chunk
+	base := 0
+
+	for _, section := range sections {
+		textChunks, err := chunking.Split(section.Text, opts.Chunking)
+		if err != nil {
+			return nil, fmt.Errorf("文本切塊失敗：%v", err)
+		}
+
+		for _, c := range textChunks {
+			metadata := section.Metadata()
+			if c.Heading != "" {
+				metadata["heading"] = c.Heading
+			}
+			if len(opts.Tags) > 0 {
+				metadata["tags"] = opts.Tags
+			}
+			chunks = append(chunks, documents.Chunk{
+				Text:       c.Text,
+				SourceFile: sourceFile,
+				ChunkIndex: len(chunks),
+				Offset:     base + c.Offset,
+				OwnerID:    opts.OwnerID,
+				Metadata:   metadata,
+			})
+		}
+
+		base += utf8.RuneCountInString(section.Text) + 2
+	}
+
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("檔案中沒有可抽取的文字內容")
+	}
+	return chunks, nil
+}
+
+// embedChunks 為每個片段生成嵌入向量，返回片段預覽（含結構資訊）與完整的向量
+func (p *EmbeddingProcessor) embedChunks(ctx context.Context, embeddingType llm.EmbeddingType, chunks []documents.Chunk) ([]map[string]interface{}, [][]float32, error) {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embedder, err := p.llmFactory.EmbeddingProviderFor(embeddingType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("取得嵌入提供者失敗：%w", err)
+	}
+
+	embeddings, err := embedder.CreateBatchEmbeddingsWith(ctx, embeddingType, texts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成嵌入向量失敗：%w", err)
+	}
+
+	results := make([]map[string]interface{}, len(chunks))
+	for i, chunk := range chunks {
+		results[i] = map[string]interface{}{
+			"chunkIndex":  chunk.ChunkIndex,
+			"offset":      chunk.Offset,
+			"length":      utf8.RuneCountInString(chunk.Text),
+			"textPreview": truncateText(chunk.Text, 200),
+			"metadata":    chunk.Metadata,
+			"embedding":   embeddings[i][:min(10, len(embeddings[i]))], // 只返回前10個元素作為預覽，避免過大的響應
+		}
+	}
+
+	return results, embeddings, nil
+}
+
+// dimensionFor 獲取嵌入類型的向量維度
+func (p *EmbeddingProcessor) dimensionFor(embeddingType llm.EmbeddingType) (int, error) {
+	embedder, err := p.llmFactory.EmbeddingProviderFor(embeddingType)
+	if err != nil {
+		return 0, err
+	}
+	return embedder.GetDimensionFor(embeddingType)
+}
+
+// indexChunks 將片段向量寫入向量資料庫，未設定索引器時不寫入
+func (p *EmbeddingProcessor) indexChunks(ctx context.Context, filePath string, chunks []documents.Chunk, vectors [][]float32, embeddingType llm.EmbeddingType) (*IndexResult, error) {
+	if p.indexer == nil {
+		return nil, nil
+	}
+
+	index, err := p.indexer.IndexFile(ctx, filepath.Base(filePath), chunks, vectors, embeddingType)
+	if err != nil {
+		return nil, fmt.Errorf("寫入向量資料庫失敗：%v", err)
+	}
+	return index, nil
+}
+
+// truncateText 截取前 maxLength 個字元（rune）並確保不會中斷單詞，中日韓文字不會被切壞
 func truncateText(text string, maxLength int) string {
-	if len(text) <= maxLength {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
 		return text
 	}
 
 	// 尋找最後一個空格，確保不會切斷詞彙
-	truncated := text[:maxLength]
+	truncated := string(runes[:maxLength])
 	lastSpace := strings.LastIndex(truncated, " ")
 
 	if lastSpace > 0 {
@@ -102,7 +236,7 @@ func truncateText(text string, maxLength int) string {
 }
 
 // processAudioFile 處理音訊類型檔案
-func (p *EmbeddingProcessor) processAudioFile(filePath string, modelName string) (interface{}, error) {
+func (p *EmbeddingProcessor) processAudioFile(ctx context.Context, filePath string, modelName string) (interface{}, error) {
 	// 獲取檔案資訊
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -120,13 +254,19 @@ func (p *EmbeddingProcessor) processAudioFile(filePath string, modelName string)
 	transcription := fmt.Sprintf("這是從音訊檔案 %s 生成的模擬轉錄文字。實際應用中，此處應為 Whisper API 的轉錄結果。", filepath.Base(filePath))
 
 	// 使用轉錄文本生成嵌入向量
-	embedding, err := p.openAIProvider.CreateEmbeddingWith(llm.EmbeddingTypeOpenAI3Small, transcription)
+	embeddingType := p.llmFactory.DefaultEmbedding()
+	embedder, err := p.llmFactory.EmbeddingProviderFor(embeddingType)
+	if err != nil {
+		return nil, fmt.Errorf("取得嵌入提供者失敗：%w", err)
+	}
+
+	embedding, err := embedder.CreateEmbeddingWith(ctx, embeddingType, transcription)
 	if err != nil {
-		return nil, fmt.Errorf("生成嵌入向量失敗：%v", err)
+		return nil, fmt.Errorf("生成嵌入向量失敗：%w", err)
 	}
 
 	// 獲取模型維度
-	dimension, _ := p.openAIProvider.GetDimensionFor(llm.EmbeddingTypeOpenAI3Small)
+	dimension, _ := embedder.GetDimensionFor(embeddingType)
 
 	// 返回結果
 	result := map[string]interface{}{
@@ -135,7 +275,7 @@ func (p *EmbeddingProcessor) processAudioFile(filePath string, modelName string)
 		"fileSize":      fileInfo.Size(),
 		"transcription": transcription,
 		"dimension":     dimension,
-		"embedding":     embedding[:10], // 只返回前10個元素作為預覽
+		"embedding":     embedding[:min(10, len(embedding))], // 只返回前10個元素作為預覽
 	}
 
 	return result, nil
@@ -184,42 +324,61 @@ func (p *EmbeddingProcessor) processVideoFile(filePath string, modelName string)
 }
 
 // processDocumentFile 處理文件類型檔案
-func (p *EmbeddingProcessor) processDocumentFile(filePath string, modelName string) (interface{}, error) {
+func (p *EmbeddingProcessor) processDocumentFile(ctx context.Context, filePath string, modelName string, opts ProcessOptions) (interface{}, error) {
 	// 獲取檔案資訊
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("獲取檔案資訊失敗：%v", err)
 	}
 
-	// 對於文件檔案，實際實現中需要：
-	// 1. 根據文件類型(PDF、DOCX、XLSX等)提取文本內容
-	// 2. 對提取的文本生成嵌入向量
-
-	// 根據檔案副檔名決定處理方式
+	// 根據檔案副檔名選擇抽取器（PDF 逐頁、DOCX 依標題、XLSX 依工作表）
 	ext := strings.ToLower(filepath.Ext(filePath))
 
-	// 模擬文本提取 (實際應該使用專門的庫進行處理)
-	extractedText := fmt.Sprintf("這是從%s檔案提取的模擬文本內容。實際應用中，應根據檔案類型(%s)使用相應的庫提取文本。",
-		filepath.Base(filePath), ext)
+	sections, err := extractor.Extract(filePath)
+	if errors.Is(err, extractor.ErrUnsupportedType) {
+		return nil, fmt.Errorf("不支援抽取 %s 檔案的文字內容", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	extractedText := extractor.JoinText(sections)
+
+	// 切塊後逐塊生成嵌入向量
+	embeddingType, err := p.embeddingTypeForModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := chunkSections(filepath.Base(filePath), sections, opts)
+	if err != nil {
+		return nil, err
+	}
+	chunkResults, vectors, err := p.embedChunks(ctx, embeddingType, chunks)
+	if err != nil {
+		return nil, err
+	}
 
-	// 使用文本生成嵌入向量
-	embedding, err := p.openAIProvider.CreateEmbeddingWith(llm.EmbeddingTypeOpenAI3Small, extractedText)
+	// 寫入向量資料庫，讓檔案內容可被 RAG 檢索
+	index, err := p.indexChunks(ctx, filePath, chunks, vectors, embeddingType)
 	if err != nil {
-		return nil, fmt.Errorf("生成嵌入向量失敗：%v", err)
+		return nil, err
 	}
 
 	// 獲取模型維度
-	dimension, _ := p.openAIProvider.GetDimensionFor(llm.EmbeddingTypeOpenAI3Small)
+	dimension, _ := p.dimensionFor(embeddingType)
 
 	// 返回結果
 	result := map[string]interface{}{
-		"model":     modelName,
-		"fileType":  FileTypeDocument,
-		"fileSize":  fileInfo.Size(),
-		"content":   truncateText(extractedText, 200), // 截取前200個字符作為預覽
-		"dimension": dimension,
-		"embedding": embedding[:10], // 只返回前10個元素作為預覽
-		"docType":   ext,
+		"model":      modelName,
+		"fileType":   FileTypeDocument,
+		"fileSize":   fileInfo.Size(),
+		"content":    truncateText(extractedText, 200), // 截取前200個字符作為預覽
+		"dimension":  dimension,
+		"chunking":   opts.Chunking,
+		"chunkCount": len(chunks),
+		"chunks":     chunkResults,
+		"index":      index,
+		"docType":    ext,
 	}
 
 	return result, nil
@@ -0,0 +1,33 @@
+package uploads
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+// TestTruncateText 確認以字元截取，中文不會被切成無效的 UTF-8，英文在空格處截斷
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		want      string
+	}{
+		{"未超過長度", "三月用電量", 5, "三月用電量"},
+		{"中文以字元截取", "三月用電量較上月增加", 4, "三月用電..."},
+		{"英文在空格處截斷", "monthly electricity usage", 12, "monthly..."},
+		{"中英混合在空格處截斷", "用電量 report 摘要", 9, "用電量..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateText(tt.text, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("截取結果為 %q，預期 %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("截取結果不是有效的 UTF-8: %q", got)
+			}
+		})
+	}
+}
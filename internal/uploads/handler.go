@@ -1,23 +1,32 @@
 package uploads
 
 import (
+	"ai-workshop/internal/chunking"
 	"ai-workshop/internal/config"
+	"ai-workshop/internal/llm"
+	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type FileHandler struct {
-	service FileUploadService
-	config  *config.Config
+	service    FileUploadService
+	config     *config.Config
+	llmFactory *llm.Factory
+	indexer    *VectorIndexer
 }
 
-func NewFileHandler(service FileUploadService, config *config.Config) *FileHandler {
+func NewFileHandler(service FileUploadService, config *config.Config, llmFactory *llm.Factory, indexer *VectorIndexer) *FileHandler {
 	return &FileHandler{
-		service: service,
-		config:  config,
+		service:    service,
+		config:     config,
+		llmFactory: llmFactory,
+		indexer:    indexer,
 	}
 }
 
@@ -91,6 +100,13 @@ func (h *FileHandler) HandleDeleteFile(c *gin.Context) {
 	// 記錄嘗試刪除的檔案
 	println("嘗試刪除檔案:", fileName)
 
+	// 先刪除檔案的向量，失敗時保留檔案以便重試
+	removed, err := h.indexer.RemoveFile(c.Request.Context(), fileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除檔案向量失敗: " + err.Error()})
+		return
+	}
+
 	if err := h.service.DeleteFile(fileName); err != nil {
 		println("刪除檔案失敗:", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "刪除檔案失敗: " + err.Error()})
@@ -100,7 +116,8 @@ func (h *FileHandler) HandleDeleteFile(c *gin.Context) {
 	println("檔案成功刪除:", fileName)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "檔案已成功刪除",
+		"message":        "檔案已成功刪除",
+		"removedVectors": removed,
 	})
 }
 
@@ -194,10 +211,12 @@ func getContentType(ext string) string {
 	}
 }
 
-// HandleGetEmbeddingModels 獲取所有支援的嵌入模型
+// HandleGetEmbeddingModels 獲取所有支援的嵌入模型（由嵌入模型註冊表產生）以及各檔案類型的預設模型
 func (h *FileHandler) HandleGetEmbeddingModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"models": defaultEmbeddingModels,
+		"models":    llm.EmbeddingModels(),
+		"default":   h.llmFactory.DefaultEmbedding(),
+		"fileTypes": h.service.EmbeddingModels(),
 	})
 }
 
@@ -212,6 +231,13 @@ func (h *FileHandler) HandleProcessFile(c *gin.Context) {
 	// 自定義嵌入模型
 	customModel := c.Query("model")
 
+	// 切塊設定
+	chunkOptions, err := parseChunkOptions(c, fileName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "切塊設定錯誤: " + err.Error()})
+		return
+	}
+
 	// 獲取檔案路徑
 	filePath, err := h.service.GetFilePath(fileName)
 	if err != nil {
@@ -234,24 +260,17 @@ func (h *FileHandler) HandleProcessFile(c *gin.Context) {
 		embeddingModel = h.service.GetEmbeddingModel(fileType)
 	}
 
-	// 確認 OpenAI API Key
-	openaiAPIKey := ""
-	if h.config != nil && h.config.OpenAiAPIKey != "" {
-		openaiAPIKey = h.config.OpenAiAPIKey
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "未設定 OpenAI API Key",
-		})
-		return
-	}
-
-	// 創建嵌入處理器
-	processor := NewEmbeddingProcessor(openaiAPIKey)
+	// 創建嵌入處理器，嵌入提供者依模型從工廠取得（提供者未設定時回傳 503）
+	processor := NewEmbeddingProcessor(h.llmFactory, h.indexer)
 
-	// 處理檔案並生成嵌入向量
-	result, err := processor.ProcessFile(filePath, fileType, embeddingModel.Name)
+	// 處理檔案、生成嵌入向量並寫入向量資料庫（重新處理時取代舊向量）
+	result, err := processor.ProcessFile(c.Request.Context(), filePath, fileType, embeddingModel.Name, ProcessOptions{
+		Chunking: chunkOptions,
+		OwnerID:  ownerID(c),
+		Tags:     parseTags(c.Query("tags")),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(llm.HTTPStatus(err), gin.H{
 			"error": "處理檔案失敗: " + err.Error(),
 		})
 		return
@@ -267,3 +286,92 @@ func (h *FileHandler) HandleProcessFile(c *gin.Context) {
 		"message":        "檔案處理完成，使用 " + embeddingModel.Name + " 模型",
 	})
 }
+
+// HandleListFileVectors 列出檔案寫入向量資料庫的向量
+func (h *FileHandler) HandleListFileVectors(c *gin.Context) {
+	fileName := c.Param("fileName")
+
+	vectors, err := h.indexer.ListFileVectors(c.Request.Context(), fileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取得檔案向量失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"fileName": fileName,
+		"vectors":  vectors,
+	})
+}
+
+// HandleRemoveFileVectors 從向量資料庫移除檔案的向量，檔案本身保留
+func (h *FileHandler) HandleRemoveFileVectors(c *gin.Context) {
+	fileName := c.Param("fileName")
+
+	removed, err := h.indexer.RemoveFile(c.Request.Context(), fileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除檔案向量失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "已移除檔案向量",
+		"removedVectors": removed,
+	})
+}
+
+// ownerID 返回登入使用者的 ID，匿名請求返回空字串
+func ownerID(c *gin.Context) string {
+	if userId, ok := c.Get("userId"); ok {
+		if id, ok := userId.(uuid.UUID); ok {
+			return id.String()
+		}
+	}
+	return ""
+}
+
+// parseTags 解析以逗號分隔的標籤，去除空白與重複
+func parseTags(raw string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// parseChunkOptions 從查詢參數讀取切塊設定（chunk_strategy、chunk_size、chunk_overlap）
+// 未指定策略時 Markdown 檔案依標題切塊，其餘以句子切塊
+func parseChunkOptions(c *gin.Context, fileName string) (chunking.Options, error) {
+	opts := chunking.DefaultOptions()
+	if strings.EqualFold(filepath.Ext(fileName), ".md") {
+		opts.Strategy = chunking.StrategyMarkdown
+	}
+
+	if strategy := c.Query("chunk_strategy"); strategy != "" {
+		opts.Strategy = chunking.Strategy(strategy)
+	}
+	if size := c.Query("chunk_size"); size != "" {
+		value, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, fmt.Errorf("chunk_size 必須是整數")
+		}
+		opts.Size = value
+	}
+	if overlap := c.Query("chunk_overlap"); overlap != "" {
+		value, err := strconv.Atoi(overlap)
+		if err != nil {
+			return opts, fmt.Errorf("chunk_overlap 必須是整數")
+		}
+		opts.Overlap = value
+	} else if opts.Overlap >= opts.Size {
+		// 只縮小切塊大小時，預設重疊跟著縮小
+		opts.Overlap = opts.Size / 8
+	}
+
+	return opts, opts.Validate()
+}
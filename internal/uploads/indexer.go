@@ -0,0 +1,115 @@
+package uploads
+
+import (
+	"ai-workshop/internal/documents"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/models"
+	"context"
+	"fmt"
+	"log"
+)
+
+// VectorIndexer 將處理後的檔案片段寫入向量資料庫，並記錄檔案與向量 ID 的對應
+type VectorIndexer struct {
+	docService *documents.Service
+	repo       VectorRepository
+}
+
+// IndexResult 是一次寫入的結果
+type IndexResult struct {
+	Collection      string   `json:"collection"`
+	VectorIDs       []string `json:"vectorIds"`
+	ReplacedVectors int      `json:"replacedVectors"` // 重新處理時被取代的舊向量數量
+}
+
+// NewVectorIndexer 創建向量索引器
+func NewVectorIndexer(docService *documents.Service, repo VectorRepository) *VectorIndexer {
+	return &VectorIndexer{
+		docService: docService,
+		repo:       repo,
+	}
+}
+
+// IndexFile 寫入檔案的片段向量；檔案若曾處理過，先寫入新向量再刪除舊向量，避免中途失敗時檔案無法被檢索
+func (i *VectorIndexer) IndexFile(ctx context.Context, fileName string, chunks []documents.Chunk, vectors [][]float32, embeddingType llm.EmbeddingType) (*IndexResult, error) {
+	previous, err := i.repo.ListByFile(ctx, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("查詢檔案既有向量失敗：%v", err)
+	}
+
+	ids, err := i.docService.InsertChunkVectors(ctx, chunks, vectors, embeddingType)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionName := documents.CollectionNameFor(embeddingType)
+	records := make([]models.FileVector, len(ids))
+	for idx, id := range ids {
+		records[idx] = models.FileVector{
+			FileName:       fileName,
+			CollectionName: collectionName,
+			EmbeddingType:  string(embeddingType),
+			VectorID:       id,
+			ChunkIndex:     chunks[idx].ChunkIndex,
+		}
+	}
+
+	if err := i.repo.ReplaceForFile(ctx, fileName, records); err != nil {
+		// 紀錄失敗時撤回剛寫入的向量，保持兩邊一致
+		if deleteErr := i.docService.DeleteDocumentsWithEmbedding(ctx, ids, embeddingType); deleteErr != nil {
+			log.Printf("撤回檔案 %s 的向量失敗: %v", fileName, deleteErr)
+		}
+		return nil, fmt.Errorf("記錄檔案向量失敗：%v", err)
+	}
+
+	if err := i.deleteVectors(ctx, previous); err != nil {
+		return nil, fmt.Errorf("刪除檔案舊向量失敗：%v", err)
+	}
+
+	return &IndexResult{
+		Collection:      collectionName,
+		VectorIDs:       ids,
+		ReplacedVectors: len(previous),
+	}, nil
+}
+
+// RemoveFile 刪除檔案在向量資料庫中的所有向量，返回刪除的數量
+func (i *VectorIndexer) RemoveFile(ctx context.Context, fileName string) (int, error) {
+	vectors, err := i.repo.ListByFile(ctx, fileName)
+	if err != nil {
+		return 0, fmt.Errorf("查詢檔案既有向量失敗：%v", err)
+	}
+	if len(vectors) == 0 {
+		return 0, nil
+	}
+
+	if err := i.deleteVectors(ctx, vectors); err != nil {
+		return 0, err
+	}
+
+	if err := i.repo.DeleteByFile(ctx, fileName); err != nil {
+		return 0, fmt.Errorf("刪除檔案向量紀錄失敗：%v", err)
+	}
+	return len(vectors), nil
+}
+
+// ListFileVectors 列出檔案對應的向量紀錄
+func (i *VectorIndexer) ListFileVectors(ctx context.Context, fileName string) ([]models.FileVector, error) {
+	return i.repo.ListByFile(ctx, fileName)
+}
+
+// deleteVectors 依集合分組刪除向量
+func (i *VectorIndexer) deleteVectors(ctx context.Context, vectors []models.FileVector) error {
+	idsByType := make(map[llm.EmbeddingType][]string)
+	for _, v := range vectors {
+		embeddingType := llm.EmbeddingType(v.EmbeddingType)
+		idsByType[embeddingType] = append(idsByType[embeddingType], v.VectorID)
+	}
+
+	for embeddingType, ids := range idsByType {
+		if err := i.docService.DeleteDocumentsWithEmbedding(ctx, ids, embeddingType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
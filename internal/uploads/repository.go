@@ -0,0 +1,69 @@
+package uploads
+
+import (
+	"ai-workshop/internal/models"
+	"ai-workshop/internal/utils/errorutils"
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// VectorRepository 記錄每個上傳檔案寫入了哪些 Milvus 向量
+type VectorRepository interface {
+	ListByFile(ctx context.Context, fileName string) ([]models.FileVector, error)
+	ReplaceForFile(ctx context.Context, fileName string, vectors []models.FileVector) error
+	DeleteByFile(ctx context.Context, fileName string) error
+}
+
+type PostgresVectorRepository struct {
+	db *sqlx.DB
+}
+
+func NewVectorRepository(db *sqlx.DB) VectorRepository {
+	return &PostgresVectorRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresVectorRepository) ListByFile(ctx context.Context, fileName string) ([]models.FileVector, error) {
+	query := `
+		SELECT id, created_at, file_name, collection_name, embedding_type, vector_id, chunk_index
+		FROM file_vectors
+		WHERE file_name = $1
+		ORDER BY chunk_index ASC
+	`
+
+	vectors := []models.FileVector{}
+	err := r.db.SelectContext(ctx, &vectors, query, fileName)
+	return vectors, err
+}
+
+// ReplaceForFile 在同一個交易中以新的向量紀錄取代檔案原有的紀錄
+func (r *PostgresVectorRepository) ReplaceForFile(ctx context.Context, fileName string, vectors []models.FileVector) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM file_vectors WHERE file_name = $1`, fileName); err != nil {
+		return errorutils.AnalyzeDBErr(err)
+	}
+
+	for _, vector := range vectors {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO file_vectors (file_name, collection_name, embedding_type, vector_id, chunk_index)
+			VALUES ($1, $2, $3, $4, $5)
+		`, fileName, vector.CollectionName, vector.EmbeddingType, vector.VectorID, vector.ChunkIndex)
+		if err != nil {
+			return errorutils.AnalyzeDBErr(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresVectorRepository) DeleteByFile(ctx context.Context, fileName string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM file_vectors WHERE file_name = $1`, fileName)
+	return errorutils.AnalyzeDBErr(err)
+}
@@ -1,6 +1,7 @@
 package uploads
 
 import (
+	"ai-workshop/internal/llm"
 	"errors"
 	"fmt"
 	"io"
@@ -27,21 +28,30 @@ type EmbeddingModel struct {
 	Description string `json:"description"` // 模型描述
 }
 
-// 預設嵌入模型映射表
-var defaultEmbeddingModels = map[string]EmbeddingModel{
-	FileTypeText:     {Name: "text-embedding-3-small", Description: "適用於文字檔案的嵌入模型"},
-	FileTypeAudio:    {Name: "openai/whisper-base", Description: "適用於音訊檔案的嵌入模型"},
-	FileTypeImage:    {Name: "clip", Description: "適用於圖片檔案的嵌入模型"},
-	FileTypeVideo:    {Name: "openai/whisper-base", Description: "適用於影片檔案的嵌入模型，處理音訊部分"},
-	FileTypeDocument: {Name: "text-embedding-3-small", Description: "適用於文件檔案的嵌入模型"},
-	FileTypeOther:    {Name: "text-embedding-3-small", Description: "適用於其他類型檔案的嵌入模型"},
+// EmbeddingModels 返回各檔案類型的預設嵌入模型，文字類檔案使用設定的預設嵌入模型（DEFAULT_EMBEDDING_MODEL）
+func (s *FileUploadService) EmbeddingModels() map[string]EmbeddingModel {
+	return map[string]EmbeddingModel{
+		FileTypeText:     s.textEmbeddingModel("適用於文字檔案的嵌入模型"),
+		FileTypeAudio:    {Name: "openai/whisper-base", Description: "適用於音訊檔案的嵌入模型"},
+		FileTypeImage:    {Name: "clip", Description: "適用於圖片檔案的嵌入模型"},
+		FileTypeVideo:    {Name: "openai/whisper-base", Description: "適用於影片檔案的嵌入模型，處理音訊部分"},
+		FileTypeDocument: s.textEmbeddingModel("適用於文件檔案的嵌入模型"),
+		FileTypeOther:    s.textEmbeddingModel("適用於其他類型檔案的嵌入模型"),
+	}
+}
+
+// textEmbeddingModel 以註冊表中預設嵌入模型的 API 名稱建立模型配置
+func (s *FileUploadService) textEmbeddingModel(description string) EmbeddingModel {
+	model, _ := llm.LookupEmbeddingModel(s.config.DefaultEmbeddingModel)
+	return EmbeddingModel{Name: model.APIModel, Description: description}
 }
 
 // ServiceConfig 代表上傳服務的配置選項
 type ServiceConfig struct {
-	UploadDir        string   // 上傳檔案的儲存目錄
-	MaxFileSize      int64    // 允許的最大檔案大小
-	AllowedFileTypes []string // 允許的檔案類型
+	UploadDir             string            // 上傳檔案的儲存目錄
+	MaxFileSize           int64             // 允許的最大檔案大小
+	AllowedFileTypes      []string          // 允許的檔案類型
+	DefaultEmbeddingModel llm.EmbeddingType // 文字類檔案的預設嵌入模型
 }
 
 // UploadedFile 代表已上傳的檔案信息
@@ -293,8 +303,9 @@ func (s *FileUploadService) GetFileType(ext string) string {
 
 // GetEmbeddingModel 根據檔案類型獲取對應的嵌入模型
 func (s *FileUploadService) GetEmbeddingModel(fileType string) EmbeddingModel {
-	if model, exists := defaultEmbeddingModels[fileType]; exists {
+	models := s.EmbeddingModels()
+	if model, exists := models[fileType]; exists {
 		return model
 	}
-	return defaultEmbeddingModels[FileTypeOther]
+	return models[FileTypeOther]
 }
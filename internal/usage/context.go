@@ -0,0 +1,31 @@
+package usage
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+type endpointKey struct{}
+
+// ContextWithEndpoint stores the API route that triggered the llm calls
+func ContextWithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// EndpointFromContext returns the API route stored by Middleware, "" outside a request
+func EndpointFromContext(ctx context.Context) string {
+	endpoint, _ := ctx.Value(endpointKey{}).(string)
+	return endpoint
+}
+
+/**
+* Records the matched route (e.g. "/api/process/:fileName") in the request context
+* so usage rows can tell /api/chat, /api/rag and /api/process apart.
+**/
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(ContextWithEndpoint(c.Request.Context(), c.FullPath()))
+		c.Next()
+	}
+}
@@ -0,0 +1,96 @@
+package usage
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// dates in query parameters, e.g. from=2025-01-01
+const dateLayout = "2006-01-02"
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// ByUser reports usage per user, anonymous requests are grouped under an empty key
+func (h *Handler) ByUser(c *gin.Context) {
+	h.report(c, GroupByUser)
+}
+
+// ByModel reports usage per model
+func (h *Handler) ByModel(c *gin.Context) {
+	h.report(c, GroupByModel)
+}
+
+// ByDay reports usage per day
+func (h *Handler) ByDay(c *gin.Context) {
+	h.report(c, GroupByDay)
+}
+
+// ListPrices returns the model prices used for cost estimates, in USD per 1M tokens
+func (h *Handler) ListPrices(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": h.service.Prices(),
+	})
+}
+
+func (h *Handler) report(c *gin.Context, groupBy GroupBy) {
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.service.Aggregate(c.Request.Context(), groupBy, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate usage: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": report,
+	})
+}
+
+/**
+* Reads the optional from / to (YYYY-MM-DD, both inclusive), user_id and model
+* query parameters.
+**/
+func parseFilter(c *gin.Context) (Filter, error) {
+	var filter Filter
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid from date, expected YYYY-MM-DD")
+		}
+		filter.From = date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid to date, expected YYYY-MM-DD")
+		}
+		filter.To = date.AddDate(0, 0, 1)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid user_id")
+		}
+		filter.UserID = &id
+	}
+	filter.Model = c.Query("model")
+
+	return filter, nil
+}
@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Price is the cost of a model in USD per one million tokens. Embedding tokens are
+// charged at the input price.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices maps a model name (or model name prefix) to its price
+type Prices map[string]Price
+
+// DefaultPrices are the list prices of the models this service calls by default,
+// LLM_PRICES overrides or extends them
+func DefaultPrices() Prices {
+	return Prices{
+		"gpt-4o":                 {Input: 2.50, Output: 10.00},
+		"gpt-4o-mini":            {Input: 0.15, Output: 0.60},
+		"gemini-2.0-flash":       {Input: 0.10, Output: 0.40},
+		"text-embedding-3-small": {Input: 0.02},
+		"text-embedding-3-large": {Input: 0.13},
+		"text-embedding-ada-002": {Input: 0.10},
+	}
+}
+
+/**
+* Parses "gpt-4o=2.5/10,text-embedding-3-small=0.02" on top of the default prices.
+* A price is "input/output" or just "input" (output then costs nothing).
+**/
+func ParsePrices(raw string) Prices {
+	prices := DefaultPrices()
+	for _, entry := range strings.Split(raw, ",") {
+		model, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+
+		input, output, _ := strings.Cut(value, "/")
+		var price Price
+		var err error
+		if price.Input, err = strconv.ParseFloat(strings.TrimSpace(input), 64); err != nil {
+			log.Printf("ignoring invalid price %q: %v", entry, err)
+			continue
+		}
+		if strings.TrimSpace(output) != "" {
+			if price.Output, err = strconv.ParseFloat(strings.TrimSpace(output), 64); err != nil {
+				log.Printf("ignoring invalid price %q: %v", entry, err)
+				continue
+			}
+		}
+		prices[strings.TrimSpace(model)] = price
+	}
+	return prices
+}
+
+// Lookup finds the price of a model, by exact name first and then by the longest
+// matching prefix (e.g. "gpt-4o" for "gpt-4o-2024-08-06")
+func (p Prices) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// Cost estimates the cost in USD of the given token counts
+func (p Price) Cost(promptTokens, completionTokens, embeddingTokens int64) float64 {
+	return (float64(promptTokens+embeddingTokens)*p.Input + float64(completionTokens)*p.Output) / 1_000_000
+}
@@ -0,0 +1,57 @@
+package usage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrices(t *testing.T) {
+	prices := ParsePrices("gpt-4o=2.5/12, llama3.1=0,invalid, broken=abc, half=1/zz, text-embedding-3-small = 0.03 ,")
+
+	want := DefaultPrices()
+	want["gpt-4o"] = Price{Input: 2.5, Output: 12}
+	want["llama3.1"] = Price{}
+	want["text-embedding-3-small"] = Price{Input: 0.03}
+	if !reflect.DeepEqual(prices, want) {
+		t.Errorf("got prices %v, want %v", prices, want)
+	}
+
+	if got := ParsePrices(""); !reflect.DeepEqual(got, DefaultPrices()) {
+		t.Errorf("empty LLM_PRICES should keep the defaults, got %v", got)
+	}
+}
+
+func TestPricesLookup(t *testing.T) {
+	prices := Prices{
+		"gpt-4o":      {Input: 2.5, Output: 10},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+		"llama":       {},
+	}
+
+	tests := []struct {
+		model  string
+		want   Price
+		wantOK bool
+	}{
+		{"gpt-4o", Price{Input: 2.5, Output: 10}, true},
+		{"gpt-4o-2024-08-06", Price{Input: 2.5, Output: 10}, true},
+		{"gpt-4o-mini-2024-07-18", Price{Input: 0.15, Output: 0.6}, true}, // longest prefix wins
+		{"llama3.1:8b", Price{}, true},
+		{"gpt-4", Price{}, false},
+		{"claude-3", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := prices.Lookup(tt.model)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Lookup(%q) = %v, %v; want %v, %v", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestPriceCost(t *testing.T) {
+	price := Price{Input: 2, Output: 8}
+	// embedding tokens are charged at the input price
+	if got := price.Cost(500_000, 250_000, 500_000); got != 4 {
+		t.Errorf("got cost %v, want 4", got)
+	}
+}
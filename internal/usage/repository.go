@@ -0,0 +1,136 @@
+package usage
+
+import (
+	"ai-workshop/internal/models"
+	"ai-workshop/internal/utils/errorutils"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// GroupBy is the dimension usage is aggregated over
+type GroupBy string
+
+const (
+	GroupByUser  GroupBy = "user"
+	GroupByModel GroupBy = "model"
+	GroupByDay   GroupBy = "day"
+)
+
+// groupKeys maps every GroupBy to the SQL expression of its key; only these are ever
+// interpolated into the query
+var groupKeys = map[GroupBy]string{
+	GroupByUser:  `COALESCE(user_id::text, '')`,
+	GroupByModel: `model`,
+	GroupByDay:   `to_char(created_at, 'YYYY-MM-DD')`,
+}
+
+// Filter narrows the usage rows being aggregated, zero values are ignored
+type Filter struct {
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	UserID *uuid.UUID
+	Model  string
+}
+
+/**
+* One aggregated row. Rows are always split per provider/model as well so that the
+* service can price them.
+**/
+type AggregateRow struct {
+	Key              string `db:"key"`
+	Provider         string `db:"provider"`
+	Model            string `db:"model"`
+	Calls            int64  `db:"calls"`
+	Failures         int64  `db:"failures"`
+	PromptTokens     int64  `db:"prompt_tokens"`
+	CompletionTokens int64  `db:"completion_tokens"`
+	EmbeddingTokens  int64  `db:"embedding_tokens"`
+	TotalLatencyMs   int64  `db:"total_latency_ms"`
+}
+
+type Repository interface {
+	Insert(ctx context.Context, usage *models.LLMUsage) error
+	Aggregate(ctx context.Context, groupBy GroupBy, filter Filter) ([]AggregateRow, error)
+}
+
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRepository) Insert(ctx context.Context, usage *models.LLMUsage) error {
+	query := `
+		INSERT INTO llm_usage (
+			user_id, endpoint, provider, model, operation,
+			prompt_tokens, completion_tokens, embedding_tokens, latency_ms, estimated,
+			success, error
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		usage.UserID, usage.Endpoint, usage.Provider, usage.Model, usage.Operation,
+		usage.PromptTokens, usage.CompletionTokens, usage.EmbeddingTokens, usage.LatencyMs, usage.Estimated,
+		usage.Success, usage.Error,
+	)
+	return errorutils.AnalyzeDBErr(err)
+}
+
+func (r *PostgresRepository) Aggregate(ctx context.Context, groupBy GroupBy, filter Filter) ([]AggregateRow, error) {
+	key, ok := groupKeys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: group by %q", errorutils.ErrInvalidInput, groupBy)
+	}
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+	if filter.UserID != nil {
+		addCondition("user_id = $%d", *filter.UserID)
+	}
+	if filter.Model != "" {
+		addCondition("model = $%d", filter.Model)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s AS key, provider, model,
+			COUNT(*) AS calls,
+			COUNT(*) FILTER (WHERE NOT success) AS failures,
+			COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+			COALESCE(SUM(embedding_tokens), 0) AS embedding_tokens,
+			COALESCE(SUM(latency_ms), 0) AS total_latency_ms
+		FROM llm_usage
+		%s
+		GROUP BY 1, provider, model
+		ORDER BY 1, provider, model
+	`, key, where)
+
+	rows := []AggregateRow{}
+	err := r.db.SelectContext(ctx, &rows, query, args...)
+	return rows, err
+}
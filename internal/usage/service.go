@@ -0,0 +1,162 @@
+package usage
+
+import (
+	"ai-workshop/internal/auth"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/models"
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// number of usage rows buffered before new ones are dropped
+const queueSize = 1000
+
+// upper bound for writing one usage row
+const insertTimeout = 5 * time.Second
+
+/**
+* Records llm usage and aggregates it. Rows are written by a background worker so
+* that accounting never slows down or fails a user request.
+**/
+type Service struct {
+	repo   Repository
+	prices Prices
+	queue  chan *models.LLMUsage
+}
+
+func NewService(repo Repository, prices Prices) *Service {
+	s := &Service{
+		repo:   repo,
+		prices: prices,
+		queue:  make(chan *models.LLMUsage, queueSize),
+	}
+	go s.run()
+	return s
+}
+
+// RecordUsage implements llm.UsageRecorder, the caller is taken from the request context
+func (s *Service) RecordUsage(ctx context.Context, event llm.UsageEvent) {
+	usage := &models.LLMUsage{
+		Endpoint:         EndpointFromContext(ctx),
+		Provider:         string(event.Provider),
+		Model:            event.Model,
+		Operation:        string(event.Operation),
+		PromptTokens:     event.PromptTokens,
+		CompletionTokens: event.CompletionTokens,
+		EmbeddingTokens:  event.EmbeddingTokens,
+		LatencyMs:        event.Latency.Milliseconds(),
+		Estimated:        event.Estimated,
+		Success:          event.Err == nil,
+	}
+	if userID, ok := auth.UserIDFromContext(ctx); ok {
+		usage.UserID = &userID
+	}
+	if event.Err != nil {
+		usage.Error = event.Err.Error()
+	}
+
+	select {
+	case s.queue <- usage:
+	default:
+		log.Printf("llm usage queue is full, dropping usage of %s/%s", usage.Provider, usage.Model)
+	}
+}
+
+func (s *Service) run() {
+	for usage := range s.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), insertTimeout)
+		if err := s.repo.Insert(ctx, usage); err != nil {
+			log.Printf("failed to record llm usage: %v", err)
+		}
+		cancel()
+	}
+}
+
+/**
+* Usage of one user, model or day. EstimatedCost only covers priced models, the
+* others are listed in UnpricedModels.
+**/
+type Summary struct {
+	Key              string   `json:"key"`
+	Calls            int64    `json:"calls"`
+	Failures         int64    `json:"failures"`
+	PromptTokens     int64    `json:"promptTokens"`
+	CompletionTokens int64    `json:"completionTokens"`
+	EmbeddingTokens  int64    `json:"embeddingTokens"`
+	AvgLatencyMs     int64    `json:"avgLatencyMs"`
+	EstimatedCost    float64  `json:"estimatedCost"` // USD
+	UnpricedModels   []string `json:"unpricedModels,omitempty"`
+}
+
+// Report is an aggregation plus its grand total
+type Report struct {
+	GroupBy GroupBy   `json:"groupBy"`
+	Items   []Summary `json:"items"`
+	Total   Summary   `json:"total"`
+}
+
+// Aggregate sums usage per user, model or day and estimates the cost of each group
+func (s *Service) Aggregate(ctx context.Context, groupBy GroupBy, filter Filter) (*Report, error) {
+	rows, err := s.repo.Aggregate(ctx, groupBy, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{GroupBy: groupBy, Items: []Summary{}}
+	var totalLatency int64
+	latencies := map[string]int64{}
+	for _, row := range rows {
+		if len(report.Items) == 0 || report.Items[len(report.Items)-1].Key != row.Key {
+			report.Items = append(report.Items, Summary{Key: row.Key})
+		}
+		item := &report.Items[len(report.Items)-1]
+
+		s.add(item, row)
+		s.add(&report.Total, row)
+		latencies[row.Key] += row.TotalLatencyMs
+		totalLatency += row.TotalLatencyMs
+	}
+
+	for i := range report.Items {
+		item := &report.Items[i]
+		item.AvgLatencyMs = latencies[item.Key] / max(item.Calls, 1)
+	}
+	report.Total.Key = "total"
+	report.Total.AvgLatencyMs = totalLatency / max(report.Total.Calls, 1)
+
+	return report, nil
+}
+
+// add adds one provider/model row to a summary and prices it
+func (s *Service) add(summary *Summary, row AggregateRow) {
+	summary.Calls += row.Calls
+	summary.Failures += row.Failures
+	summary.PromptTokens += row.PromptTokens
+	summary.CompletionTokens += row.CompletionTokens
+	summary.EmbeddingTokens += row.EmbeddingTokens
+
+	price, ok := s.prices.Lookup(row.Model)
+	if !ok {
+		summary.UnpricedModels = appendUnique(summary.UnpricedModels, row.Model)
+		return
+	}
+	summary.EstimatedCost += price.Cost(row.PromptTokens, row.CompletionTokens, row.EmbeddingTokens)
+}
+
+// Prices returns the configured model prices
+func (s *Service) Prices() Prices {
+	return s.prices
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	values = append(values, value)
+	sort.Strings(values)
+	return values
+}
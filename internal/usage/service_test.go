@@ -0,0 +1,131 @@
+package usage
+
+import (
+	"ai-workshop/internal/auth"
+	"ai-workshop/internal/llm"
+	"ai-workshop/internal/models"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepository returns fixed aggregate rows and hands inserted rows to the test
+type fakeRepository struct {
+	rows     []AggregateRow
+	err      error
+	inserted chan *models.LLMUsage
+}
+
+func (r *fakeRepository) Insert(ctx context.Context, usage *models.LLMUsage) error {
+	r.inserted <- usage
+	return nil
+}
+
+func (r *fakeRepository) Aggregate(ctx context.Context, groupBy GroupBy, filter Filter) ([]AggregateRow, error) {
+	return r.rows, r.err
+}
+
+func TestServiceAggregate(t *testing.T) {
+	repo := &fakeRepository{rows: []AggregateRow{
+		{Key: "alice", Provider: "openai", Model: "gpt-4o-2024-08-06", Calls: 3, Failures: 1, PromptTokens: 1_000_000, CompletionTokens: 500_000, TotalLatencyMs: 900},
+		{Key: "alice", Provider: "openai", Model: "text-embedding-3-small", Calls: 1, EmbeddingTokens: 1_000_000, TotalLatencyMs: 100},
+		{Key: "bob", Provider: "local", Model: "llama3.1", Calls: 2, PromptTokens: 100, CompletionTokens: 50, TotalLatencyMs: 400},
+		{Key: "bob", Provider: "gemini", Model: "gemini-2.0-flash", Calls: 2, PromptTokens: 1_000_000, TotalLatencyMs: 200},
+		{Key: "bob", Provider: "local", Model: "llama3.1", Calls: 1, TotalLatencyMs: 300},
+	}}
+	service := &Service{repo: repo, prices: DefaultPrices()}
+
+	report, err := service.Aggregate(context.Background(), GroupByUser, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Summary{
+		{Key: "alice", Calls: 4, Failures: 1, PromptTokens: 1_000_000, CompletionTokens: 500_000, EmbeddingTokens: 1_000_000, AvgLatencyMs: 250, EstimatedCost: 7.52},
+		{Key: "bob", Calls: 5, PromptTokens: 1_000_100, CompletionTokens: 50, AvgLatencyMs: 180, EstimatedCost: 0.1, UnpricedModels: []string{"llama3.1"}},
+	}
+	wantTotal := Summary{Key: "total", Calls: 9, Failures: 1, PromptTokens: 2_000_100, CompletionTokens: 500_050, EmbeddingTokens: 1_000_000, AvgLatencyMs: 211, EstimatedCost: 7.62, UnpricedModels: []string{"llama3.1"}}
+
+	if len(report.Items) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(report.Items), len(want), report.Items)
+	}
+	for i := range want {
+		assertSummary(t, report.Items[i], want[i])
+	}
+	assertSummary(t, report.Total, wantTotal)
+	if report.GroupBy != GroupByUser {
+		t.Errorf("got groupBy %s, want %s", report.GroupBy, GroupByUser)
+	}
+}
+
+func TestServiceAggregateEmpty(t *testing.T) {
+	service := &Service{repo: &fakeRepository{}, prices: DefaultPrices()}
+
+	report, err := service.Aggregate(context.Background(), GroupByDay, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Items == nil || len(report.Items) != 0 {
+		t.Errorf("got items %v, want an empty list", report.Items)
+	}
+	assertSummary(t, report.Total, Summary{Key: "total"})
+
+	service.repo = &fakeRepository{err: errors.New("connection refused")}
+	if _, err := service.Aggregate(context.Background(), GroupByDay, Filter{}); err == nil {
+		t.Error("expected the repository error")
+	}
+}
+
+func TestServiceRecordUsage(t *testing.T) {
+	repo := &fakeRepository{inserted: make(chan *models.LLMUsage, 1)}
+	service := NewService(repo, DefaultPrices())
+
+	userID := uuid.New()
+	ctx := auth.ContextWithUserID(ContextWithEndpoint(context.Background(), "/api/rag"), userID)
+	service.RecordUsage(ctx, llm.UsageEvent{
+		Provider:   llm.LLMTypeOpenAI,
+		Model:      "gpt-4o",
+		Operation:  llm.OpChat,
+		TokenUsage: llm.TokenUsage{PromptTokens: 12, CompletionTokens: 3},
+		Latency:    1500 * time.Millisecond,
+		Err:        errors.New("rate limited"),
+	})
+
+	select {
+	case usage := <-repo.inserted:
+		want := &models.LLMUsage{
+			UserID:           &userID,
+			Endpoint:         "/api/rag",
+			Provider:         "openai",
+			Model:            "gpt-4o",
+			Operation:        "chat",
+			PromptTokens:     12,
+			CompletionTokens: 3,
+			LatencyMs:        1500,
+			Success:          false,
+			Error:            "rate limited",
+		}
+		if !reflect.DeepEqual(usage, want) {
+			t.Errorf("got usage %+v, want %+v", usage, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("usage was not written")
+	}
+}
+
+func assertSummary(t *testing.T, got, want Summary) {
+	t.Helper()
+
+	if math.Abs(got.EstimatedCost-want.EstimatedCost) > 1e-9 {
+		t.Errorf("%s: got cost %v, want %v", want.Key, got.EstimatedCost, want.EstimatedCost)
+	}
+	got.EstimatedCost, want.EstimatedCost = 0, 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got summary %+v, want %+v", got, want)
+	}
+}
@@ -3,6 +3,8 @@ package util
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 func GetEnvString(key, fallback string) string {
@@ -17,3 +19,71 @@ func GetEnvString(key, fallback string) string {
 
 	return env
 }
+
+/**
+* Reads a secret env variable such as an API key or password. Unlike
+* GetEnvString it never prints the value, only whether it is set.
+**/
+func GetEnvSecret(key, fallback string) string {
+	env := os.Getenv(key)
+
+	if env == "" {
+		fmt.Printf("env key %s is not set\n", key)
+		return fallback
+	}
+
+	fmt.Printf("env key %s is set\n", key)
+	return env
+}
+
+/**
+* Parses a boolean env variable ("true", "1", ...), returning the fallback when
+* it is unset or invalid.
+**/
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(GetEnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+/**
+* Parses an integer env variable, returning the fallback when it is unset or
+* invalid.
+**/
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(GetEnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+/**
+* Parses a float env variable, returning the fallback when it is unset or
+* invalid.
+**/
+func GetEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(GetEnvString(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+/**
+* Parses a duration env variable such as "10s" or "1m", returning the fallback
+* when it is unset or invalid.
+**/
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetEnvString(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}